@@ -0,0 +1,46 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSONSink_Audit(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewJSONSink(&buffer)
+	now := time.Date(2019, 3, 10, 8, 0, 0, 0, time.UTC)
+
+	sink.Audit(Event{Type: TokenIssued, Time: now, UserID: `1`, TokenID: `1`})
+	sink.Audit(Event{Type: TokenRejected, Time: now, ClientIP: `10.0.0.1`, Reason: `JWT: invalid token`})
+
+	assert := assert.New(t)
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Equal(2, len(lines))
+
+	var event Event
+	assert.NoError(json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(TokenRejected, event.Type)
+	assert.Equal(`10.0.0.1`, event.ClientIP)
+	assert.Equal(`JWT: invalid token`, event.Reason)
+	assert.True(now.Equal(event.Time))
+	assert.Contains(lines[0], `"jti":"1"`)
+}
+
+func TestSlogSink_Audit(t *testing.T) {
+	var buffer bytes.Buffer
+	sink := NewSlogSink(slog.New(slog.NewTextHandler(&buffer, nil)))
+
+	sink.Audit(Event{Type: AccessDenied, Resource: `/data/image`, RoleID: []int64{3}})
+
+	assert := assert.New(t)
+	assert.Contains(buffer.String(), `level=WARN`)
+	assert.Contains(buffer.String(), `type=access_denied`)
+	assert.Contains(buffer.String(), `resource=/data/image`)
+	assert.NotContains(buffer.String(), `user_id`)
+}
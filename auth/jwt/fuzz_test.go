@@ -0,0 +1,92 @@
+package jwt_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/auth/jwt"
+	"github.com/go-pandora/pkg/auth/jwt/jwttest"
+)
+
+func addSeeds(f *testing.F) {
+	f.Add(jwttest.NewBuilder(Jwt.SigningMethodHS256, now).Sign(f))
+	f.Add(jwttest.NewBuilder(Jwt.SigningMethodHS256, now).Expired().Sign(f))
+	f.Add(jwttest.NewBuilder(Jwt.SigningMethodHS256, now).WrongKey().Sign(f))
+	f.Add(jwttest.NewBuilder(Jwt.SigningMethodHS256, now).Data(map[string]interface{}{"role_id": 1}).Sign(f))
+	f.Add(`eyJhbGciOiJub25lIn0.e30.`)
+	f.Add(`eyJhbGciOiJIUzI1NiJ9.bnVsbA.`)
+	f.Add(`eyJhbGciOiJIUzI1NiJ9.eyJqdGkiOjEsImlhdCI6IngiLCJleHAiOltdfQ.`)
+	f.Add(`..`)
+	f.Add(``)
+}
+
+// checkError fails the test when err is not a *jwt.ValidationError.
+func checkError(t *testing.T, err error) {
+	if err == nil {
+		return
+	}
+	var validationErr *jwt.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("unexpected error type %T: %v", err, err)
+	}
+}
+
+func FuzzGetToken(f *testing.F) {
+	addSeeds(f)
+	f.Add(`Bearer `)
+	f.Add(`bearer x.y.z`)
+	options := jwttest.Options(f, Jwt.SigningMethodHS256)
+	options.IsBearerToken = true
+	token, err := jwt.NewTokenConfig(options, nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	f.Fuzz(func(t *testing.T, header string) {
+		r, _ := http.NewRequest(http.MethodGet, "/", nil)
+		r.Header[jwttest.Header] = []string{header}
+		got, err := token.GetToken(r)
+		if err != nil {
+			if got != "" {
+				t.Fatalf("token %q returned with error %v", got, err)
+			}
+			return
+		}
+		if len(got) >= len(header) {
+			t.Fatalf("bearer prefix is not removed from %q", header)
+		}
+	})
+}
+
+func FuzzValidateToken(f *testing.F) {
+	addSeeds(f)
+	token := jwttest.NewToken(f, Jwt.SigningMethodHS256, nil, jwttest.NewClock(now))
+
+	f.Fuzz(func(t *testing.T, s string) {
+		info, err := token.ValidateToken(s)
+		checkError(t, err)
+		if err == nil && info == nil {
+			t.Fatal("no information returned for a valid token")
+		}
+		_, err = token.GetTokenData(s)
+		checkError(t, err)
+	})
+}
+
+func FuzzCheckToken(f *testing.F) {
+	addSeeds(f)
+	store := jwttest.NewStore()
+	token := jwttest.NewToken(f, Jwt.SigningMethodHS256, store, jwttest.NewClock(now))
+
+	f.Fuzz(func(t *testing.T, s string) {
+		info, err := token.CheckToken(s)
+		if err == nil && info == nil {
+			t.Fatal("no user returned for a valid token")
+		}
+		if err != nil && !errors.Is(err, jwttest.ErrRevoked) {
+			checkError(t, err)
+		}
+	})
+}
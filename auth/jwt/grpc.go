@@ -0,0 +1,138 @@
+package jwt
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-pandora/pkg/audit"
+	"github.com/go-pandora/pkg/internal/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey struct{}
+
+// TokenSource returns the token which should be attached to an outgoing call.
+type TokenSource func(ctx context.Context) (string, error)
+
+// StaticToken returns a TokenSource which always attaches the same token.
+func StaticToken(token string) TokenSource {
+	return func(context.Context) (string, error) {
+		return token, nil
+	}
+}
+
+// NewContext returns a copy of ctx which carries information of an authenticated user.
+func NewContext(ctx context.Context, info *UserInfo) context.Context {
+	return context.WithValue(ctx, contextKey{}, info)
+}
+
+// FromContext returns information of the user authenticated by the gRPC interceptors.
+func FromContext(ctx context.Context) (*UserInfo, bool) {
+	info, ok := ctx.Value(contextKey{}).(*UserInfo)
+	return info, ok
+}
+
+// UnaryServerInterceptor checks whether the caller of a unary RPC is authenticated.
+// Methods listed in skip are called without authentication.
+func (t *Token) UnaryServerInterceptor(skip ...string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if contains(skip, info.FullMethod) {
+			return handler(ctx, req)
+		}
+		ctx, err := t.authenticate(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor checks whether the caller of a streaming RPC is authenticated.
+// Methods listed in skip are called without authentication.
+func (t *Token) StreamServerInterceptor(skip ...string) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if contains(skip, info.FullMethod) {
+			return handler(srv, ss)
+		}
+		ctx, err := t.authenticate(ss.Context())
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ss, ctx})
+	}
+}
+
+// UnaryClientInterceptor attaches the token returned by source to every unary call.
+func UnaryClientInterceptor(header string, isBearerToken bool, source TokenSource) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := attachToken(ctx, header, isBearerToken, source)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor attaches the token returned by source to every streaming call.
+func StreamClientInterceptor(header string, isBearerToken bool, source TokenSource) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := attachToken(ctx, header, isBearerToken, source)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// authenticate reads a token from the incoming metadata and stores the checked user in ctx.
+func (t *Token) authenticate(ctx context.Context) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(strings.ToLower(t.options.Header)); len(values) != 0 {
+			header = values[0]
+		}
+	}
+	token, err := t.extractToken(header)
+	if err != nil {
+		t.audit(audit.Event{Type: audit.TokenRejected, ClientIP: grpcutil.PeerIP(ctx), Reason: err.Error()})
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	userInfo, _, err := t.checkToken(ctx, token, grpcutil.PeerIP(ctx), true)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return NewContext(ctx, userInfo), nil
+}
+
+func attachToken(ctx context.Context, header string, isBearerToken bool, source TokenSource) (context.Context, error) {
+	token, err := source(ctx)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if isBearerToken {
+		token = bearerPrefix + token
+	}
+	return metadata.AppendToOutgoingContext(ctx, strings.ToLower(header), token), nil
+}
+
+// serverStream overrides the context of a grpc.ServerStream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func contains(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package jwt_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/auth/jwt"
+	"github.com/go-pandora/pkg/auth/jwt/jwttest"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func bearerToken(t *testing.T) *jwt.Token {
+	options := jwttest.Options(t, Jwt.SigningMethodHS256)
+	options.IsBearerToken = true
+	options.Clock = jwttest.NewClock(now)
+	token, err := jwt.NewTokenConfig(options, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// incoming returns a context carrying header as incoming metadata, or none if header is empty.
+func incoming(header string) context.Context {
+	if header == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(`authorization`, header))
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func TestToken_ServerInterceptors(t *testing.T) {
+	token := bearerToken(t)
+	valid := jwttest.NewBuilder(Jwt.SigningMethodHS256, now).ID(`7`).Sign(t)
+	expired := jwttest.NewBuilder(Jwt.SigningMethodHS256, now).ID(`7`).Expired().Sign(t)
+
+	var users []string
+	unary := token.UnaryServerInterceptor(`/pandora.v1.AuthService/Login`)
+	callUnary := func(ctx context.Context, method string) codes.Code {
+		_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			if info, ok := jwt.FromContext(ctx); ok {
+				users = append(users, info.Id)
+			}
+			return "ok", nil
+		})
+		return status.Code(err)
+	}
+	stream := token.StreamServerInterceptor(`/pandora.v1.AuthService/Login`)
+	callStream := func(ctx context.Context, method string) codes.Code {
+		err := stream(nil, &serverStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: method}, func(srv interface{}, ss grpc.ServerStream) error {
+			if info, ok := jwt.FromContext(ss.Context()); ok {
+				users = append(users, info.Id)
+			}
+			return nil
+		})
+		return status.Code(err)
+	}
+
+	assert := assert.New(t)
+	for _, call := range []func(context.Context, string) codes.Code{callUnary, callStream} {
+		assert.Equal(codes.OK, call(context.Background(), `/pandora.v1.AuthService/Login`))
+		assert.Equal(codes.Unauthenticated, call(context.Background(), `/pandora.v1.UserService/GetUser`))
+		assert.Equal(codes.Unauthenticated, call(incoming(`bearer`), `/pandora.v1.UserService/GetUser`))
+		assert.Equal(codes.Unauthenticated, call(incoming(`Basic `+valid), `/pandora.v1.UserService/GetUser`))
+		assert.Equal(codes.Unauthenticated, call(incoming(`Bearer not.a.token`), `/pandora.v1.UserService/GetUser`))
+		assert.Equal(codes.Unauthenticated, call(incoming(`Bearer `+expired), `/pandora.v1.UserService/GetUser`))
+		assert.Equal(codes.OK, call(incoming(`Bearer `+valid), `/pandora.v1.UserService/GetUser`))
+	}
+	assert.Equal([]string{`7`, `7`}, users)
+
+	_, err := unary(incoming(`Bearer `+expired), nil, &grpc.UnaryServerInfo{FullMethod: `/pandora.v1.UserService/GetUser`}, nil)
+	assert.Contains(status.Convert(err).Message(), jwt.ErrTokenExpired.Error())
+}
+
+func TestClientInterceptors(t *testing.T) {
+	token := bearerToken(t)
+	valid := jwttest.NewBuilder(Jwt.SigningMethodHS256, now).ID(`7`).Sign(t)
+
+	var sent []string
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = append(sent, md.Get(`authorization`)...)
+		// The server reads what the client sends.
+		server := token.UnaryServerInterceptor()
+		_, err := server(metadata.NewIncomingContext(ctx, md), req, &grpc.UnaryServerInfo{FullMethod: method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return nil, nil
+		})
+		return err
+	}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		sent = append(sent, md.Get(`authorization`)...)
+		return nil, nil
+	}
+
+	assert := assert.New(t)
+	unary := jwt.UnaryClientInterceptor(jwttest.Header, true, jwt.StaticToken(valid))
+	assert.NoError(unary(context.Background(), `/pandora.v1.UserService/GetUser`, nil, nil, nil, invoker))
+	stream := jwt.StreamClientInterceptor(jwttest.Header, false, jwt.StaticToken(valid))
+	_, err := stream(context.Background(), &grpc.StreamDesc{}, nil, `/pandora.v1.UserService/Watch`, streamer)
+	assert.NoError(err)
+	assert.Equal([]string{`Bearer ` + valid, valid}, sent)
+
+	// a token which can not be obtained fails the call before it is sent
+	failing := func(context.Context) (string, error) {
+		return "", errors.New(`no token`)
+	}
+	err = jwt.UnaryClientInterceptor(jwttest.Header, true, failing)(context.Background(), `/pandora.v1.UserService/GetUser`, nil, nil, nil, invoker)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	_, err = jwt.StreamClientInterceptor(jwttest.Header, true, failing)(context.Background(), &grpc.StreamDesc{}, nil, `/pandora.v1.UserService/Watch`, streamer)
+	assert.Equal(codes.Unauthenticated, status.Code(err))
+	assert.Equal(2, len(sent))
+}
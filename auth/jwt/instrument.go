@@ -0,0 +1,38 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/go-pandora/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/go-pandora/pkg/auth/jwt"
+
+const (
+	metricValidations        = "jwt_validations_total"
+	metricValidationDuration = "jwt_validation_duration_seconds"
+)
+
+func (t *Token) tracer() trace.Tracer {
+	if t.options.TracerProvider != nil {
+		return t.options.TracerProvider.Tracer(instrumentationName)
+	}
+	return otel.Tracer(instrumentationName)
+}
+
+// observeValidation records the result and the latency of a token validation which started at start.
+func (t *Token) observeValidation(span trace.Span, start time.Time, err error) {
+	result := "valid"
+	if err != nil {
+		result = "rejected"
+		span.SetStatus(codes.Error, err.Error())
+	}
+	if t.options.Metrics == nil {
+		return
+	}
+	t.options.Metrics.Inc(metricValidations, metrics.Labels{"result": result})
+	t.options.Metrics.Observe(metricValidationDuration, time.Since(start).Seconds(), metrics.Labels{"result": result})
+}
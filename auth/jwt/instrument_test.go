@@ -0,0 +1,49 @@
+package jwt
+
+import (
+	"testing"
+	"time"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestToken_Instrument(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	recorder := metrics.NewMemory()
+	token, err := NewTokenConfig(Options{
+		HMACKey:        []byte(`secret`),
+		SigningMethod:  Jwt.SigningMethodHS256,
+		TokenDuration:  time.Hour,
+		Header:         `Authorization`,
+		Metrics:        recorder,
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)),
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := token.GenerateToken(`1`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	_, err = token.CheckToken(signed)
+	assert.NoError(err)
+	_, err = token.CheckToken(signed + `x`)
+	assert.Error(err)
+
+	assert.Equal(float64(1), recorder.Counter(metricValidations, metrics.Labels{"result": "valid"}))
+	assert.Equal(float64(1), recorder.Counter(metricValidations, metrics.Labels{"result": "rejected"}))
+
+	spans := exporter.GetSpans()
+	assert.Equal(2, len(spans))
+	assert.Equal(`jwt.CheckToken`, spans[0].Name)
+	assert.Equal(codes.Unset, spans[0].Status.Code)
+	assert.Equal(codes.Error, spans[1].Status.Code)
+}
@@ -0,0 +1,91 @@
+package jwttest
+
+import (
+	"testing"
+	"time"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/auth/jwt"
+)
+
+// Builder builds tokens which are valid, expired, not yet valid or signed with a wrong key.
+type Builder struct {
+	method   Jwt.SigningMethod
+	now      time.Time
+	claims   jwt.JWTClaims
+	wrongKey bool
+}
+
+// NewBuilder returns a Builder of a token with id "1" which is issued now and expires in an hour.
+func NewBuilder(method Jwt.SigningMethod, now time.Time) *Builder {
+	return &Builder{
+		method: method,
+		now:    now,
+		claims: jwt.JWTClaims{
+			StandardClaims: Jwt.StandardClaims{
+				Id:        "1",
+				IssuedAt:  now.Unix(),
+				ExpiresAt: now.Add(time.Hour).Unix(),
+			},
+		},
+	}
+}
+
+func (b *Builder) ID(id string) *Builder {
+	b.claims.Id = id
+	return b
+}
+
+func (b *Builder) Data(data map[string]interface{}) *Builder {
+	b.claims.Data = data
+	return b
+}
+
+func (b *Builder) IssuedAt(t time.Time) *Builder {
+	b.claims.IssuedAt = t.Unix()
+	return b
+}
+
+func (b *Builder) ExpiresAt(t time.Time) *Builder {
+	b.claims.ExpiresAt = t.Unix()
+	return b
+}
+
+func (b *Builder) NotBefore(t time.Time) *Builder {
+	b.claims.NotBefore = t.Unix()
+	return b
+}
+
+// Expired makes a token which was issued two hours ago and expired an hour ago.
+func (b *Builder) Expired() *Builder {
+	b.claims.IssuedAt = b.now.Add(-2 * time.Hour).Unix()
+	b.claims.ExpiresAt = b.now.Add(-time.Hour).Unix()
+	return b
+}
+
+// NotYetValid makes a token which can not be used until an hour later.
+func (b *Builder) NotYetValid() *Builder {
+	b.claims.NotBefore = b.now.Add(time.Hour).Unix()
+	b.claims.ExpiresAt = b.now.Add(2 * time.Hour).Unix()
+	return b
+}
+
+// WrongKey makes a token signed with a key which is not the fixture.
+func (b *Builder) WrongKey() *Builder {
+	b.wrongKey = true
+	return b
+}
+
+// Sign returns the signed token.
+func (b *Builder) Sign(tb testing.TB) string {
+	tb.Helper()
+	key := signingKey(tb, b.method)
+	if b.wrongKey {
+		key = wrongKey(tb, b.method)
+	}
+	token, err := Jwt.NewWithClaims(b.method, b.claims).SignedString(key)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return token
+}
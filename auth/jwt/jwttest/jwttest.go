@@ -0,0 +1,161 @@
+// Package jwttest provides key fixtures, a fake clock, a token builder and a fake Store,
+// so that code depending on package jwt can be tested without sleeping or real keys.
+package jwttest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/auth/jwt"
+)
+
+// Header is the header of tokens in Options.
+const Header = "Authorization"
+
+// Options returns options which sign tokens by method with the fixture keys.
+// Keys of RSA and EC are written into a temporary directory of tb.
+func Options(tb testing.TB, method Jwt.SigningMethod) jwt.Options {
+	tb.Helper()
+	options := jwt.Options{
+		SigningMethod: method,
+		TokenDuration: time.Hour,
+		Header:        Header,
+	}
+	switch method.(type) {
+	case *Jwt.SigningMethodHMAC:
+		options.HMACKey = HMACKey
+	case *Jwt.SigningMethodRSA, *Jwt.SigningMethodECDSA:
+		private, public := pemKeys(tb, method)
+		dir := tb.TempDir()
+		options.PrivateKeyLocation = filepath.Join(dir, "private.pem")
+		options.PublicKeyLocation = filepath.Join(dir, "public.pem")
+		if err := os.WriteFile(options.PrivateKeyLocation, []byte(private), 0600); err != nil {
+			tb.Fatal(err)
+		}
+		if err := os.WriteFile(options.PublicKeyLocation, []byte(public), 0600); err != nil {
+			tb.Fatal(err)
+		}
+	default:
+		tb.Fatalf("jwttest: unsupported signing method %s", method.Alg())
+	}
+	return options
+}
+
+// NewToken returns a jwt.Token which signs tokens by method with the fixture keys.
+// store and clock may be nil.
+func NewToken(tb testing.TB, method Jwt.SigningMethod, store jwt.Store, clock jwt.Clock) *jwt.Token {
+	tb.Helper()
+	options := Options(tb, method)
+	options.Clock = clock
+	token, err := jwt.NewTokenConfig(options, store)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return token
+}
+
+// Clock is a jwt.Clock which only moves when it is told to.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to now.
+func (c *Clock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = now
+}
+
+func pemKeys(tb testing.TB, method Jwt.SigningMethod) (private, public string) {
+	switch method.Alg() {
+	case "RS256", "RS384", "RS512":
+		return RSAPrivateKey, RSAPublicKey
+	case "ES256":
+		return ECP256PrivateKey, ECP256PublicKey
+	case "ES384":
+		return ECP384PrivateKey, ECP384PublicKey
+	case "ES512":
+		return ECP521PrivateKey, ECP521PublicKey
+	}
+	tb.Fatalf("jwttest: no key fixture for signing method %s", method.Alg())
+	return "", ""
+}
+
+// signingKey returns the fixture key used to sign tokens by method.
+func signingKey(tb testing.TB, method Jwt.SigningMethod) interface{} {
+	if _, ok := method.(*Jwt.SigningMethodHMAC); ok {
+		return HMACKey
+	}
+	private, _ := pemKeys(tb, method)
+	var (
+		key interface{}
+		err error
+	)
+	if _, ok := method.(*Jwt.SigningMethodRSA); ok {
+		key, err = Jwt.ParseRSAPrivateKeyFromPEM([]byte(private))
+	} else {
+		key, err = Jwt.ParseECPrivateKeyFromPEM([]byte(private))
+	}
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return key
+}
+
+var (
+	wrongRSAKeyOnce sync.Once
+	wrongRSAKey     *rsa.PrivateKey
+)
+
+// wrongKey returns a key of the same type as the fixture of method but which is not the fixture.
+func wrongKey(tb testing.TB, method Jwt.SigningMethod) interface{} {
+	switch method.Alg() {
+	case "HS256", "HS384", "HS512":
+		return []byte(`pandora-jwttest-wrong-key`)
+	case "RS256", "RS384", "RS512":
+		wrongRSAKeyOnce.Do(func() {
+			wrongRSAKey, _ = rsa.GenerateKey(rand.Reader, 2048)
+		})
+		return wrongRSAKey
+	}
+	curves := map[string]elliptic.Curve{
+		"ES256": elliptic.P256(),
+		"ES384": elliptic.P384(),
+		"ES512": elliptic.P521(),
+	}
+	curve, ok := curves[method.Alg()]
+	if !ok {
+		tb.Fatalf("jwttest: unsupported signing method %s", method.Alg())
+	}
+	key, err := ecdsa.GenerateKey(curve, rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return key
+}
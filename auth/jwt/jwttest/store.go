@@ -0,0 +1,69 @@
+package jwttest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/go-pandora/pkg/auth/jwt"
+)
+
+var ErrRevoked = errors.New("jwttest: token has been revoked")
+
+// CheckCall records arguments of a call of Store.Check.
+type CheckCall struct {
+	TokenID  string
+	IssuedAt int64
+}
+
+// Store is a jwt.Store in memory which records all calls.
+// Users returned by Check can be registered in Users; otherwise a user with the token id is returned.
+type Store struct {
+	Users map[string]*jwt.UserInfo
+
+	mu      sync.Mutex
+	checks  []CheckCall
+	revokes []string
+	revoked map[string]bool
+}
+
+func NewStore() *Store {
+	return &Store{
+		Users:   make(map[string]*jwt.UserInfo),
+		revoked: make(map[string]bool),
+	}
+}
+
+func (s *Store) Check(tokenId string, issuedAt int64) (*jwt.UserInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checks = append(s.checks, CheckCall{tokenId, issuedAt})
+	if s.revoked[tokenId] {
+		return nil, ErrRevoked
+	}
+	if info, ok := s.Users[tokenId]; ok {
+		return info, nil
+	}
+	return &jwt.UserInfo{Id: tokenId}, nil
+}
+
+func (s *Store) Revoke(tokenId string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revokes = append(s.revokes, tokenId)
+	s.revoked[tokenId] = true
+	return nil
+}
+
+// Checks returns all calls of Check in order.
+func (s *Store) Checks() []CheckCall {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]CheckCall(nil), s.checks...)
+}
+
+// Revokes returns ids of all revoked tokens in order.
+func (s *Store) Revokes() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.revokes...)
+}
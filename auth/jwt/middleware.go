@@ -2,23 +2,31 @@ package jwt
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/audit"
 	"net/http"
 )
 
-// Authenticator checks whether user is authenticated.
+// Authenticator checks whether user is authenticated, and sets "user_id" and "user_info" of the user.
+// GET requests are let through without a valid token, so that public resources can be read,
+// but the user of a valid token is set all the same, so that middlewares authorizing users,
+// such as rbac.AccessControl.Enforcer, can be used after it for every method.
 func (t *Token) Authenticator() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		if c.Request.Method == "GET" {
-			return
-		}
+		optional := c.Request.Method == "GET"
 		token, err := t.GetToken(c.Request)
 		if err != nil {
+			if optional {
+				return
+			}
+			t.audit(audit.Event{Type: audit.TokenRejected, ClientIP: c.ClientIP(), Reason: err.Error()})
 			c.AbortWithStatus(http.StatusUnauthorized)
 			return
 		}
-		userInfo, err := t.CheckToken(token)
+		userInfo, _, err := t.checkToken(c.Request.Context(), token, c.ClientIP(), true)
 		if err != nil {
-			c.AbortWithStatus(http.StatusUnauthorized)
+			if !optional {
+				c.AbortWithStatus(http.StatusUnauthorized)
+			}
 			return
 		}
 		c.Set("user_id", userInfo.Id)
@@ -2,6 +2,9 @@ package jwt
 
 import (
 	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/audit"
+	"github.com/go-pandora/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
 	"time"
 )
 
@@ -13,4 +16,31 @@ type Options struct {
 	TokenDuration      time.Duration
 	IsBearerToken      bool
 	Header             string
+	// Audit receives events of issued, validated, rejected, revoked and refreshed tokens.
+	Audit audit.Sink
+	// Metrics receives the count and latency of token validations.
+	Metrics metrics.Recorder
+	// TracerProvider creates spans around token validations.
+	// The global TracerProvider of OpenTelemetry is used if it is nil.
+	TracerProvider trace.TracerProvider
+	// Clock tells the time when tokens are issued and validated.
+	// The system clock is used if it is nil.
+	Clock Clock
+	// MaxTokenSize is the maximum length of a token. It is 8192 if it is not set.
+	MaxTokenSize int
+	// MaxHeaderSize is the maximum length of the encoded header of a token. It is 1024 if it is not set.
+	MaxHeaderSize int
+	// RequiredClaims lists claims which a token must carry besides jti, iat and exp.
+	RequiredClaims []string
+}
+
+// Clock tells the current time, so that tests can control the expiry of tokens.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
 }
@@ -3,10 +3,15 @@
 package jwt
 
 import (
+	"context"
 	"errors"
 	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/audit"
+	"go.opentelemetry.io/otel/attribute"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
 type Token struct {
@@ -16,6 +21,8 @@ type Token struct {
 	store      Store
 }
 
+const bearerPrefix = "Bearer "
+
 var (
 	ErrNoSigningMethod      = errors.New("JWT: no JWT signing method")
 	ErrNoHMACKey            = errors.New("JWT: you must provide a HMAC Key")
@@ -78,44 +85,80 @@ func NewTokenConfig(options Options, store Store) (*Token, error) {
 		return nil, ErrNoHeader
 	}
 
+	if options.Clock == nil {
+		options.Clock = systemClock{}
+	}
+
+	if options.MaxTokenSize <= 0 {
+		options.MaxTokenSize = defaultMaxTokenSize
+	}
+
+	if options.MaxHeaderSize <= 0 {
+		options.MaxHeaderSize = defaultMaxHeaderSize
+	}
+
 	return &Token{privateKey, publicKey, options, store}, nil
 }
 
 func (t *Token) GetToken(r *http.Request) (string, error) {
-	header := r.Header.Get(t.options.Header)
+	return t.extractToken(r.Header.Get(t.options.Header))
+}
+
+// extractToken gets a token from the value of the configured header.
+func (t *Token) extractToken(header string) (string, error) {
 	if header == "" {
 		return "", ErrTokenNotFound
 	}
+	if len(header) > len(bearerPrefix)+t.options.MaxTokenSize {
+		return "", invalid(ErrTokenTooLarge, "")
+	}
 	if t.options.IsBearerToken {
-		token := header[7:]
-		return token, nil
+		if len(header) <= len(bearerPrefix) || !strings.EqualFold(header[:len(bearerPrefix)], bearerPrefix) {
+			return "", ErrTokenNotFound
+		}
+		return header[len(bearerPrefix):], nil
 	}
 	return header, nil
 }
 
 func (t *Token) GenerateToken(id string, data map[string]interface{}) (string, error) {
-	return t.generateJWT(id, data)
+	token, err := t.generateJWT(id, data)
+	if err == nil {
+		t.audit(audit.Event{Type: audit.TokenIssued, UserID: id, TokenID: id})
+	}
+	return token, err
 }
 
 func (t *Token) ValidateToken(token string) (*TokenInfo, error) {
-	return t.validateJWT(token)
+	_, tokenInfo, err := t.checkToken(context.Background(), token, "", false)
+	return tokenInfo, err
 }
 
 func (t *Token) GetTokenData(token string) (map[string]interface{}, error) {
 	tokenInfo, err := t.validateJWT(token)
-	return tokenInfo.Data, err
+	if err != nil {
+		return nil, err
+	}
+	return tokenInfo.Data, nil
 }
 
 func (t *Token) CheckToken(token string) (*UserInfo, error) {
-	tokenInfo, err := t.validateJWT(token)
+	userInfo, _, err := t.checkToken(context.Background(), token, "", true)
+	return userInfo, err
+}
+
+// RefreshToken checks a token and issues a new one with the same id and data.
+func (t *Token) RefreshToken(token string) (string, error) {
+	userInfo, tokenInfo, err := t.checkToken(context.Background(), token, "", true)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	// When there is no storage, we would like to return information from token as UserInfo.
-	if t.store == nil {
-		return &UserInfo{tokenInfo.Id, tokenInfo.Data}, nil
+	refreshed, err := t.generateJWT(tokenInfo.Id, tokenInfo.Data)
+	if err != nil {
+		return "", err
 	}
-	return t.store.Check(tokenInfo.Id, tokenInfo.IssuedAt)
+	t.audit(audit.Event{Type: audit.TokenRefreshed, UserID: userInfo.Id, TokenID: tokenInfo.Id})
+	return refreshed, nil
 }
 
 func (t *Token) RevokeToken(id string) error {
@@ -123,5 +166,47 @@ func (t *Token) RevokeToken(id string) error {
 	if t.store == nil {
 		log.Panicf("JWT: no storage provided, please check your storage setting")
 	}
-	return t.store.Revoke(id)
+	if err := t.store.Revoke(id); err != nil {
+		return err
+	}
+	t.audit(audit.Event{Type: audit.TokenRevoked, TokenID: id})
+	return nil
+}
+
+// checkToken validates a token sent from clientIP.
+// If withStore is true, the token is also checked with the storage.
+func (t *Token) checkToken(ctx context.Context, token, clientIP string, withStore bool) (*UserInfo, *TokenInfo, error) {
+	_, span := t.tracer().Start(ctx, "jwt.CheckToken")
+	defer span.End()
+	start := time.Now()
+
+	tokenInfo, err := t.validateJWT(token)
+	if err != nil {
+		t.observeValidation(span, start, err)
+		t.audit(audit.Event{Type: audit.TokenRejected, ClientIP: clientIP, Reason: err.Error()})
+		return nil, nil, err
+	}
+	span.SetAttributes(attribute.String("jwt.id", tokenInfo.Id))
+	// When there is no storage, we would like to return information from token as UserInfo.
+	userInfo := &UserInfo{tokenInfo.Id, tokenInfo.Data}
+	if withStore && t.store != nil {
+		userInfo, err = t.store.Check(tokenInfo.Id, tokenInfo.IssuedAt)
+		if err != nil {
+			t.observeValidation(span, start, err)
+			t.audit(audit.Event{Type: audit.TokenRejected, TokenID: tokenInfo.Id, ClientIP: clientIP, Reason: err.Error()})
+			return nil, nil, err
+		}
+	}
+	t.observeValidation(span, start, nil)
+	t.audit(audit.Event{Type: audit.TokenValidated, UserID: userInfo.Id, TokenID: tokenInfo.Id, ClientIP: clientIP})
+	return userInfo, tokenInfo, nil
+}
+
+// audit sends an event to the audit sink, if there is one.
+func (t *Token) audit(e audit.Event) {
+	if t.options.Audit == nil {
+		return
+	}
+	e.Time = t.options.Clock.Now()
+	t.options.Audit.Audit(e)
 }
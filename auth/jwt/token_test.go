@@ -0,0 +1,178 @@
+package jwt_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/go-pandora/pkg/audit"
+	"github.com/go-pandora/pkg/auth/jwt"
+	"github.com/go-pandora/pkg/auth/jwt/jwttest"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2019, 3, 10, 8, 0, 0, 0, time.UTC)
+
+func TestToken_SigningMethods(t *testing.T) {
+	methods := []Jwt.SigningMethod{
+		Jwt.SigningMethodHS256, Jwt.SigningMethodHS512,
+		Jwt.SigningMethodRS256, Jwt.SigningMethodRS512,
+		Jwt.SigningMethodES256, Jwt.SigningMethodES384, Jwt.SigningMethodES512,
+	}
+	for _, method := range methods {
+		t.Run(method.Alg(), func(t *testing.T) {
+			token := jwttest.NewToken(t, method, nil, jwttest.NewClock(now))
+
+			assert := assert.New(t)
+			info, err := token.ValidateToken(jwttest.NewBuilder(method, now).ID(`7`).Sign(t))
+			assert.NoError(err)
+			assert.Equal(`7`, info.Id)
+
+			_, err = token.ValidateToken(jwttest.NewBuilder(method, now).WrongKey().Sign(t))
+			assert.Error(err)
+		})
+	}
+}
+
+func TestToken_Expiry(t *testing.T) {
+	clock := jwttest.NewClock(now)
+	token := jwttest.NewToken(t, Jwt.SigningMethodHS256, nil, clock)
+
+	signed, err := token.GenerateToken(`1`, map[string]interface{}{"role_id": float64(3)})
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	info, err := token.CheckToken(signed)
+	assert.NoError(err)
+	assert.Equal(float64(3), info.Info["role_id"])
+
+	clock.Advance(2 * time.Hour)
+	_, err = token.CheckToken(signed)
+	assert.ErrorIs(err, jwt.ErrTokenExpired)
+
+	_, err = token.CheckToken(jwttest.NewBuilder(Jwt.SigningMethodHS256, clock.Now()).Expired().Sign(t))
+	assert.ErrorIs(err, jwt.ErrTokenExpired)
+
+	_, err = token.CheckToken(jwttest.NewBuilder(Jwt.SigningMethodHS256, clock.Now()).NotYetValid().Sign(t))
+	assert.ErrorIs(err, jwt.ErrTokenNotValidYet)
+}
+
+func TestToken_RefreshAndRevoke(t *testing.T) {
+	clock := jwttest.NewClock(now)
+	store := jwttest.NewStore()
+	token := jwttest.NewToken(t, Jwt.SigningMethodHS256, store, clock)
+
+	signed, err := token.GenerateToken(`1`, nil)
+	assert := assert.New(t)
+	assert.NoError(err)
+
+	clock.Advance(50 * time.Minute)
+	refreshed, err := token.RefreshToken(signed)
+	assert.NoError(err)
+
+	clock.Advance(20 * time.Minute)
+	_, err = token.CheckToken(signed)
+	assert.ErrorIs(err, jwt.ErrTokenExpired)
+	_, err = token.CheckToken(refreshed)
+	assert.NoError(err)
+
+	assert.NoError(token.RevokeToken(`1`))
+	_, err = token.CheckToken(refreshed)
+	assert.Equal(jwttest.ErrRevoked, err)
+
+	assert.Equal([]string{`1`}, store.Revokes())
+	assert.Equal([]jwttest.CheckCall{
+		{TokenID: `1`, IssuedAt: now.Unix()},
+		{TokenID: `1`, IssuedAt: now.Add(50 * time.Minute).Unix()},
+		{TokenID: `1`, IssuedAt: now.Add(50 * time.Minute).Unix()},
+	}, store.Checks())
+}
+
+func TestToken_Audit(t *testing.T) {
+	clock := jwttest.NewClock(now)
+	var events []audit.Event
+	options := jwttest.Options(t, Jwt.SigningMethodHS256)
+	options.Clock = clock
+	options.Audit = audit.SinkFunc(func(e audit.Event) {
+		events = append(events, e)
+	})
+	token, err := jwt.NewTokenConfig(options, jwttest.NewStore())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert := assert.New(t)
+	signed, err := token.GenerateToken(`1`, nil)
+	assert.NoError(err)
+	clock.Advance(time.Minute)
+	refreshed, err := token.RefreshToken(signed)
+	assert.NoError(err)
+	assert.NoError(token.RevokeToken(`1`))
+	_, err = token.CheckToken(refreshed)
+	assert.Error(err)
+	_, err = token.CheckToken(`malformed`)
+	assert.Error(err)
+
+	types := make([]audit.Type, len(events))
+	for i, e := range events {
+		types[i] = e.Type
+	}
+	assert.Equal([]audit.Type{
+		audit.TokenIssued,
+		audit.TokenValidated,
+		audit.TokenRefreshed,
+		audit.TokenRevoked,
+		audit.TokenRejected,
+		audit.TokenRejected,
+	}, types)
+	assert.Equal(audit.Event{Type: audit.TokenIssued, Time: now, UserID: `1`, TokenID: `1`}, events[0])
+	assert.Equal(audit.Event{Type: audit.TokenRefreshed, Time: now.Add(time.Minute), UserID: `1`, TokenID: `1`}, events[2])
+	assert.Equal(audit.Event{Type: audit.TokenRevoked, Time: now.Add(time.Minute), TokenID: `1`}, events[3])
+	assert.Equal(`1`, events[4].TokenID)
+	assert.Equal(jwttest.ErrRevoked.Error(), events[4].Reason)
+	assert.Empty(events[5].TokenID)
+	assert.NotEmpty(events[5].Reason)
+}
+
+func TestToken_ValidateTokenHardening(t *testing.T) {
+	token := jwttest.NewToken(t, Jwt.SigningMethodHS256, nil, jwttest.NewClock(now))
+	unsigned, err := Jwt.NewWithClaims(Jwt.SigningMethodNone, jwt.JWTClaims{
+		StandardClaims: Jwt.StandardClaims{Id: `1`, IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+	}).SignedString(Jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutExpiry, err := Jwt.NewWithClaims(Jwt.SigningMethodHS256, Jwt.MapClaims{
+		"jti": `1`, "iat": now.Unix(),
+	}).SignedString(jwttest.HMACKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		token string
+		err   error
+	}{
+		{``, jwt.ErrMalformedToken},
+		{`garbage`, jwt.ErrMalformedToken},
+		{`a.b.c`, jwt.ErrMalformedToken},
+		{`e30.e30.`, jwt.ErrAlgNone},
+		{unsigned, jwt.ErrAlgNone},
+		{jwttest.NewBuilder(Jwt.SigningMethodRS256, now).Sign(t), jwt.ErrUnexpectedSigningMethod},
+		{jwttest.NewBuilder(Jwt.SigningMethodHS256, now).WrongKey().Sign(t), jwt.ErrInvalidToken},
+		{withoutExpiry, jwt.ErrMissingClaim},
+		{strings.Repeat(`a`, 10000), jwt.ErrTokenTooLarge},
+	}
+
+	assert := assert.New(t)
+	for _, c := range cases {
+		_, err := token.ValidateToken(c.token)
+		assert.ErrorIs(err, c.err, c.token)
+		var validationErr *jwt.ValidationError
+		assert.ErrorAs(err, &validationErr)
+
+		_, err = token.GetTokenData(c.token)
+		assert.ErrorIs(err, c.err)
+	}
+}
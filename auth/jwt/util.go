@@ -5,7 +5,6 @@ import (
 	"fmt"
 	Jwt "github.com/dgrijalva/jwt-go"
 	"io/ioutil"
-	"time"
 )
 
 type JWTClaims struct {
@@ -24,17 +23,29 @@ var (
 	ErrGetTokenId    = errors.New("JWT: can not get id from token")
 	ErrGetIssuedTime = errors.New("JWT: can not get issued time from token")
 	ErrGetData       = errors.New("JWT: can not get data from token")
+
+	ErrTokenExpired          = errors.New("JWT: token is expired")
+	ErrTokenUsedBeforeIssued = errors.New("JWT: token is used before issued")
+	ErrTokenNotValidYet      = errors.New("JWT: token is not valid yet")
+
+	ErrTokenTooLarge           = errors.New("JWT: token is too large")
+	ErrMalformedToken          = errors.New("JWT: token is malformed")
+	ErrAlgNone                 = errors.New("JWT: unsigned token is not accepted")
+	ErrUnexpectedSigningMethod = errors.New("JWT: unexpected signing method")
+	ErrMissingClaim            = errors.New("JWT: required claim is missing")
+	ErrInvalidClaim            = errors.New("JWT: claim has an invalid type")
 )
 
 // generateJWT generates a Json Web Token.
 // Here we use id to specifies a token and add data(whatever you need) to the token.
 // Please do not add important information such as password to payload of JWT.
 func (t *Token) generateJWT(id string, data map[string]interface{}) (token string, err error) {
+	now := t.options.Clock.Now()
 	claim := JWTClaims{
 		StandardClaims: Jwt.StandardClaims{
-			ExpiresAt: time.Now().Add(t.options.TokenDuration).Unix(),
+			ExpiresAt: now.Add(t.options.TokenDuration).Unix(),
 			Id:        id,
-			IssuedAt:  time.Now().Unix(),
+			IssuedAt:  now.Unix(),
 		},
 		Data: data,
 	}
@@ -46,28 +57,51 @@ func (t *Token) generateJWT(id string, data map[string]interface{}) (token strin
 
 // validateJWT validates whether a jwt is valid.
 // If so, it returns information included in the token and nil.
+// Every error it returns is a *ValidationError.
 func (t *Token) validateJWT(tokenString string) (*TokenInfo, error) {
-	token, err := Jwt.Parse(tokenString, func(token *Jwt.Token) (interface{}, error) {
+	// Check the size and the algorithm before the token is parsed or any key is used.
+	if err := t.checkRaw(tokenString); err != nil {
+		return nil, err
+	}
+
+	// Time based claims are verified by verifyTime with the clock of Token instead of the parser.
+	parser := Jwt.Parser{
+		ValidMethods:         []string{t.options.SigningMethod.Alg()},
+		SkipClaimsValidation: true,
+	}
+	token, err := parser.Parse(tokenString, func(token *Jwt.Token) (interface{}, error) {
 		// Don't forget to validation the alg is what you expect:
 		if token.Method.Alg() != t.options.SigningMethod.Alg() {
 			return nil, fmt.Errorf("JWT: unexpected signing method %v", token.Header["alg"])
 		}
 		return t.publicKey, nil
 	})
+	if err != nil {
+		return nil, invalid(ErrInvalidToken, err.Error())
+	}
+	if token == nil || !token.Valid {
+		return nil, invalid(ErrInvalidToken, "")
+	}
 
-	claims := token.Claims.(Jwt.MapClaims)
-	if claims["jti"] == nil || claims["iat"] == nil || err != nil {
-		return nil, ErrInvalidToken
+	claims, ok := token.Claims.(Jwt.MapClaims)
+	if !ok {
+		return nil, invalid(ErrInvalidToken, "unexpected claims")
+	}
+	if err := t.verifyClaims(claims); err != nil {
+		return nil, err
+	}
+	if err := t.verifyTime(claims); err != nil {
+		return nil, err
 	}
 
 	id, ok := claims["jti"].(string)
 	if !ok {
-		return nil, ErrGetTokenId
+		return nil, invalid(ErrGetTokenId, "")
 	}
 
 	iat, ok := claims["iat"].(float64)
 	if !ok {
-		return nil, ErrGetIssuedTime
+		return nil, invalid(ErrGetIssuedTime, "")
 	}
 
 	if claims["data"] == nil {
@@ -76,11 +110,26 @@ func (t *Token) validateJWT(tokenString string) (*TokenInfo, error) {
 
 	data, ok := claims["data"].(map[string]interface{})
 	if !ok {
-		return nil, ErrGetData
+		return nil, invalid(ErrGetData, "")
 	}
 	return &TokenInfo{Id: id, IssuedAt: int64(iat), Data: data}, nil
 }
 
+// verifyTime verifies exp, iat and nbf of claims with the clock of Token.
+func (t *Token) verifyTime(claims Jwt.MapClaims) error {
+	now := t.options.Clock.Now().Unix()
+	if !claims.VerifyExpiresAt(now, false) {
+		return invalid(ErrTokenExpired, "")
+	}
+	if !claims.VerifyIssuedAt(now, false) {
+		return invalid(ErrTokenUsedBeforeIssued, "")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return invalid(ErrTokenNotValidYet, "")
+	}
+	return nil
+}
+
 func SetSigningMethod(method string) Jwt.SigningMethod {
 	switch method {
 	case "HS256":
@@ -0,0 +1,88 @@
+package jwt
+
+import (
+	"encoding/json"
+	"strings"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+)
+
+const (
+	defaultMaxTokenSize  = 8192
+	defaultMaxHeaderSize = 1024
+)
+
+// claims which every token must carry in addition to Options.RequiredClaims.
+var requiredClaims = []string{"jti", "iat", "exp"}
+
+// ValidationError is the error returned when a token is rejected.
+// Err is one of the errors of this package, so it can be checked with errors.Is.
+type ValidationError struct {
+	Err    error
+	Detail string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Detail == "" {
+		return e.Err.Error()
+	}
+	return e.Err.Error() + ": " + e.Detail
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+func invalid(err error, detail string) error {
+	return &ValidationError{Err: err, Detail: detail}
+}
+
+// checkRaw checks the size and the algorithm of a token before it is parsed.
+func (t *Token) checkRaw(tokenString string) error {
+	if len(tokenString) > t.options.MaxTokenSize {
+		return invalid(ErrTokenTooLarge, "")
+	}
+	if strings.Count(tokenString, ".") != 2 {
+		return invalid(ErrMalformedToken, "a token must have three segments")
+	}
+	segment := tokenString[:strings.IndexByte(tokenString, '.')]
+	if len(segment) > t.options.MaxHeaderSize {
+		return invalid(ErrTokenTooLarge, "header")
+	}
+	raw, err := Jwt.DecodeSegment(segment)
+	if err != nil {
+		return invalid(ErrMalformedToken, "header is not base64url encoded")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return invalid(ErrMalformedToken, "header is not a JSON object")
+	}
+	if header.Alg == "" || strings.EqualFold(header.Alg, "none") {
+		return invalid(ErrAlgNone, "")
+	}
+	if header.Alg != t.options.SigningMethod.Alg() {
+		return invalid(ErrUnexpectedSigningMethod, header.Alg)
+	}
+	return nil
+}
+
+// verifyClaims verifies that all required claims exist and that registered claims have the right type.
+func (t *Token) verifyClaims(claims Jwt.MapClaims) error {
+	for _, required := range [][]string{requiredClaims, t.options.RequiredClaims} {
+		for _, claim := range required {
+			if claims[claim] == nil {
+				return invalid(ErrMissingClaim, claim)
+			}
+		}
+	}
+	for _, claim := range []string{"exp", "iat", "nbf"} {
+		if v, ok := claims[claim]; ok {
+			if _, ok := v.(float64); !ok {
+				return invalid(ErrInvalidClaim, claim)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Command rbacctl loads a policy file and answers queries against it, explains its decisions,
+// or runs a table of expected decisions as a test suite of the policies.
+//
+//	rbacctl query   -policies policies.yaml -uri /articles/1 -op read -roles editor
+//	rbacctl explain -policies policies.yaml -uri /articles/1 -op read -roles editor,3
+//	rbacctl test    -policies policies.yaml cases.yaml...
+//	rbacctl lint    -policies policies.yaml
+//
+// Conditions of policies can not be evaluated out of an application, so they fail unless they are passed
+// by -pass, or by "pass" of a case.
+// query exits with 1 if the request is denied, test if any case fails, and lint if it finds any warning.
+// They exit with 2 on errors.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-pandora/pkg/rbac"
+	"github.com/go-pandora/pkg/rbac/policyfile"
+)
+
+const usage = `usage: rbacctl <command> [flags]
+
+commands:
+  query    decide a request
+  explain  explain how a request is decided
+  test     run files of expected decisions
+  lint     find problems of policies and roles
+`
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+	command, args := args[0], args[1:]
+	flags := flag.NewFlagSet("rbacctl "+command, flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	var (
+		path    = flags.String("policies", "", "policy file in YAML, JSON or TOML")
+		inherit = flags.String("inherit", "none", "inheritance of permissions along roles: none, parent or child")
+		uri     = flags.String("uri", "", "URI of the request")
+		op      = flags.String("op", "read", "operation of the request, like read or CR")
+		roles   = flags.String("roles", "", "names or ids of roles of the subject, separated by commas")
+		user    = flags.String("user", "", "user id of the subject")
+		tenant  = flags.String("tenant", "", "tenant of the subject")
+		pass    = flags.String("pass", "", "conditions which pass, separated by commas; the others fail")
+	)
+	switch command {
+	case "query", "explain", "test", "lint":
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	default:
+		fmt.Fprintf(stderr, "rbacctl: unknown command %q\n%s", command, usage)
+		return 2
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *path == "" {
+		fmt.Fprintln(stderr, "rbacctl: -policies is required")
+		return 2
+	}
+	engine, err := load(*path, *inherit)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+
+	if command == "lint" {
+		return engine.lint(stdout)
+	}
+	if command == "test" {
+		if flags.NArg() == 0 {
+			fmt.Fprintln(stderr, "rbacctl: no test file")
+			return 2
+		}
+		return engine.test(flags.Args(), stdout, stderr)
+	}
+
+	operation, err := rbac.ParseOperation(*op)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var refs []string
+	if *roles != "" {
+		refs = strings.Split(*roles, ",")
+	}
+	roleID, err := engine.roleIDs(refs)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var passed []string
+	if *pass != "" {
+		passed = strings.Split(*pass, ",")
+	}
+	engine.stubConditions(passed)
+	e := engine.Explain(*uri, operation, rbac.Subject{UserID: *user, Tenant: *tenant, RoleID: roleID})
+	if command == "explain" {
+		fmt.Fprint(stdout, e)
+	} else if e.Decision.Granted {
+		fmt.Fprintf(stdout, "granted: %s\n", e.Decision.Reason)
+	} else {
+		fmt.Fprintf(stdout, "denied: %s\n", e.Decision.Reason)
+	}
+	if !e.Decision.Granted {
+		return 1
+	}
+	return 0
+}
+
+// engine is an access control loaded from a policy file.
+type engine struct {
+	*rbac.AccessControl
+	document    *policyfile.Document
+	names       map[string]int64
+	inheritance rbac.Inheritance
+}
+
+func load(path, inherit string) (*engine, error) {
+	var inheritance rbac.Inheritance
+	switch inherit {
+	case "none":
+		inheritance = rbac.NoInheritance
+	case "parent":
+		inheritance = rbac.ParentInherits
+	case "child":
+		inheritance = rbac.ChildInherits
+	default:
+		return nil, fmt.Errorf("rbacctl: invalid inheritance %q", inherit)
+	}
+	document, err := policyfile.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tree, roles := rbac.NewPolicyTree(), rbac.NewRoleManager()
+	if err := tree.SetHierarchy(roles, inheritance); err != nil {
+		return nil, err
+	}
+	document.Apply(tree, roles)
+
+	e := &engine{AccessControl: rbac.NewAccessControl(tree, roles), document: document, names: make(map[string]int64), inheritance: inheritance}
+	for _, role := range document.Roles {
+		if role.Name != "" {
+			e.names[role.Name] = role.Id
+		}
+	}
+	return e, nil
+}
+
+// roleIDs resolves names or ids of roles.
+func (e *engine) roleIDs(refs []string) ([]int64, error) {
+	roleID := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		ref = strings.TrimSpace(ref)
+		if id, ok := e.names[ref]; ok {
+			roleID = append(roleID, id)
+			continue
+		}
+		id, err := strconv.ParseInt(ref, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q", policyfile.ErrUnknownRole, ref)
+		}
+		roleID = append(roleID, id)
+	}
+	return roleID, nil
+}
+
+// lint prints findings of the policy file.
+func (e *engine) lint(stdout io.Writer) int {
+	roles := make([]rbac.Role, len(e.document.Roles))
+	for i, role := range e.document.Roles {
+		roles[i] = role
+	}
+	findings := rbac.Lint(e.document.Policies, e.document.Algorithm, roles, e.inheritance)
+	for _, f := range findings {
+		fmt.Fprintln(stdout, f)
+	}
+	if len(findings.Filter(rbac.Warning)) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// stubConditions makes the conditions of passed pass, and any other condition fail,
+// since conditions of an application can not be evaluated out of it.
+func (e *engine) stubConditions(passed []string) {
+	e.Conditions = rbac.NewConditions()
+	for _, name := range passed {
+		e.Conditions.Register(strings.TrimSpace(name), func(*rbac.Request) (bool, error) {
+			return true, nil
+		})
+	}
+}
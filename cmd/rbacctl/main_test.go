@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const policies = `roles:
+  - id: 1
+    name: admin
+  - id: 2
+    name: editor
+    parent: admin
+policies:
+  - uri: /**
+    groups:
+      - operation: CRUD
+        roles: [admin]
+  - uri: /articles/:id
+    groups:
+      - operation: read
+        roles: [editor]
+      - operation: update
+        roles: [editor]
+        conditions: [owner]
+`
+
+const cases = `cases:
+  - name: editors read articles
+    uri: /articles/1
+    operation: read
+    roles: [editor]
+    expect: allow
+  - uri: /articles/1
+    operation: update
+    roles: [editor]
+    pass: [owner]
+    expect: allow
+  - name: only owners update articles
+    uri: /articles/1
+    operation: update
+    roles: [editor]
+    expect: deny
+  - name: editors delete articles
+    uri: /articles/1
+    operation: delete
+    roles: [2]
+    expect: allow
+`
+
+func write(t *testing.T, name, data string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun_Query(t *testing.T) {
+	path := write(t, `policies.yaml`, policies)
+	var stdout, stderr bytes.Buffer
+
+	assert := assert.New(t)
+	assert.Equal(0, run([]string{`query`, `-policies`, path, `-uri`, `/articles/1`, `-roles`, `editor`}, &stdout, &stderr))
+	assert.Equal("granted: role 2 is granted by /articles/:id\n", stdout.String())
+
+	stdout.Reset()
+	assert.Equal(1, run([]string{`query`, `-policies`, path, `-uri`, `/articles/1`, `-op`, `U`, `-roles`, `editor`},
+		&stdout, &stderr))
+	assert.Equal("denied: condition \"owner\" failed\n", stdout.String())
+	assert.Equal(0, run([]string{`query`, `-policies`, path, `-uri`, `/articles/1`, `-op`, `U`, `-roles`, `editor`,
+		`-pass`, `owner`}, &stdout, &stderr))
+
+	stdout.Reset()
+	assert.Equal(1, run([]string{`explain`, `-policies`, path, `-uri`, `/articles/1`, `-op`, `delete`, `-roles`, `2`},
+		&stdout, &stderr))
+	assert.Equal(`delete /articles/1 (most-specific)
+  /articles/:id {id=1}
+    read [2]
+    update [2] if owner
+  /**
+    create|read|update|delete [1] considered
+required roles: [1]
+denied: no required role
+`, stdout.String())
+
+	assert.Equal(2, run([]string{`query`, `-policies`, path, `-roles`, `nobody`}, &stdout, &stderr))
+	assert.Equal(2, run([]string{`query`, `-policies`, `missing.yaml`}, &stdout, &stderr))
+	assert.Equal(2, run([]string{`fly`}, &stdout, &stderr))
+}
+
+func TestRun_Test(t *testing.T) {
+	path := write(t, `policies.yaml`, policies)
+	suite := write(t, `cases.yaml`, cases)
+	var stdout, stderr bytes.Buffer
+
+	assert := assert.New(t)
+	assert.Equal(1, run([]string{`test`, `-policies`, path, suite}, &stdout, &stderr))
+	assert.Contains(stdout.String(), `FAIL `+suite+`: editors delete articles: expected allow`)
+	assert.Contains(stdout.String(), "3 passed, 1 failed\n")
+
+	stdout.Reset()
+	assert.Equal(0, run([]string{`test`, `-policies`, path, `-inherit`, `child`, suite}, &stdout, &stderr))
+	assert.Equal("4 passed, 0 failed\n", stdout.String())
+
+	invalid := write(t, `invalid.yaml`, "cases:\n  - uri: /a\n    expected: allow\n")
+	assert.Equal(2, run([]string{`test`, `-policies`, path, invalid}, &stdout, &stderr))
+}
+
+func TestRun_Lint(t *testing.T) {
+	path := write(t, `policies.yaml`, policies)
+	var stdout, stderr bytes.Buffer
+
+	assert := assert.New(t)
+	assert.Equal(1, run([]string{`lint`, `-policies`, path}, &stdout, &stderr))
+	assert.Equal("warning: /**: group 0 grants create|read|update|delete on every uri to [1] [broad-grant]\n", stdout.String())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/go-pandora/pkg/rbac"
+	"gopkg.in/yaml.v3"
+)
+
+// suite is a file of expected decisions in YAML or JSON:
+//
+//	cases:
+//	  - name: editors read articles
+//	    uri: /articles/1
+//	    operation: read
+//	    roles: [editor]
+//	    user: alice
+//	    tenant: acme
+//	    attributes: {department: news}
+//	    pass: [owner]
+//	    expect: allow
+type suite struct {
+	Cases []testCase `yaml:"cases"`
+}
+
+type testCase struct {
+	Name       string                 `yaml:"name"`
+	URI        string                 `yaml:"uri"`
+	Operation  string                 `yaml:"operation"`
+	Roles      []string               `yaml:"roles"`
+	User       string                 `yaml:"user"`
+	Tenant     string                 `yaml:"tenant"`
+	Attributes map[string]interface{} `yaml:"attributes"`
+	Pass       []string               `yaml:"pass"`
+	Expect     string                 `yaml:"expect"`
+}
+
+func (c *testCase) String() string {
+	if c.Name != "" {
+		return c.Name
+	}
+	return fmt.Sprintf("%s %s by %v", c.Operation, c.URI, c.Roles)
+}
+
+func loadSuite(path string) (*suite, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var s suite
+	if err := decoder.Decode(&s); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("rbacctl: %s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// test runs the cases of files, and prints every failure with the explanation of its decision.
+func (e *engine) test(paths []string, stdout, stderr io.Writer) int {
+	var passed, failed int
+	for _, path := range paths {
+		s, err := loadSuite(path)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+		for i := range s.Cases {
+			c := &s.Cases[i]
+			explanation, err := e.run(c)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s: case %d (%s): %s\n", path, i+1, c, err)
+				return 2
+			}
+			if explanation == nil {
+				passed++
+				continue
+			}
+			failed++
+			fmt.Fprintf(stdout, "FAIL %s: %s: expected %s\n%s\n", path, c, c.Expect, explanation)
+		}
+	}
+	fmt.Fprintf(stdout, "%d passed, %d failed\n", passed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// run decides a case, and returns the explanation of the decision if it is not the expected one.
+func (e *engine) run(c *testCase) (*rbac.Explanation, error) {
+	operation, err := rbac.ParseOperation(c.Operation)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := rbac.ParseEffect(c.Expect)
+	if err != nil || c.Expect == "" {
+		return nil, fmt.Errorf("%w: expect %q", rbac.ErrInvalidEffect, c.Expect)
+	}
+	roleID, err := e.roleIDs(c.Roles)
+	if err != nil {
+		return nil, err
+	}
+	e.stubConditions(c.Pass)
+	explanation := e.Explain(c.URI, operation, rbac.Subject{
+		UserID:     c.User,
+		Tenant:     c.Tenant,
+		RoleID:     roleID,
+		Attributes: c.Attributes,
+	})
+	if explanation.Decision.Granted == (expected == rbac.Allow) {
+		return nil, nil
+	}
+	return &explanation, nil
+}
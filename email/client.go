@@ -1,14 +1,31 @@
 package email
 
 import (
+	"context"
 	"errors"
 	"net"
 	"net/smtp"
+	"time"
+
+	"github.com/go-pandora/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/go-pandora/pkg/email"
+
+const (
+	metricSent         = "email_sent_total"
+	metricSendDuration = "email_send_duration_seconds"
 )
 
 type Client struct {
-	addr string
-	auth smtp.Auth
+	addr           string
+	auth           smtp.Auth
+	metrics        metrics.Recorder
+	tracerProvider trace.TracerProvider
 }
 
 func NewClient(username, password, host, port string) *Client {
@@ -26,14 +43,56 @@ func newAuth(username, password, host string) smtp.Auth {
 	return smtp.PlainAuth("", username, password, host)
 }
 
+// SetMetrics sets a Recorder which receives the count and latency of deliveries.
+func (c *Client) SetMetrics(recorder metrics.Recorder) {
+	c.metrics = recorder
+}
+
+// SetTracerProvider sets a TracerProvider which creates spans around deliveries.
+// The global TracerProvider of OpenTelemetry is used if it is not set.
+func (c *Client) SetTracerProvider(provider trace.TracerProvider) {
+	c.tracerProvider = provider
+}
+
 func (c *Client) Send(r *Request) error {
+	return c.SendContext(context.Background(), r)
+}
+
+// SendContext sends an email like Send, and the span of the delivery is a child of ctx.
+func (c *Client) SendContext(ctx context.Context, r *Request) error {
 	//body = "To: " + r.to[0] + "\r\nSubject: " + r.subject + "\r\n" + MIME + "\r\n" + body
 
+	_, span := c.tracer().Start(ctx, "email.Send", trace.WithAttributes(
+		attribute.String("email.smtp_addr", c.addr),
+		attribute.Int("email.recipients", len(r.to)+len(r.cc)+len(r.bcc)),
+	))
+	defer span.End()
+	start := time.Now()
+
 	body := r.defaultHeader() + r.body
 	r.to = append(r.to, r.cc...)
 	r.to = append(r.to, r.bcc...)
 	if err := smtp.SendMail(c.addr, c.auth, r.from, r.to, []byte(body)); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		c.observe(start, "failed")
 		return errors.New("failed to send this email, error: " + err.Error())
 	}
+	c.observe(start, "sent")
 	return nil
 }
+
+func (c *Client) tracer() trace.Tracer {
+	if c.tracerProvider != nil {
+		return c.tracerProvider.Tracer(instrumentationName)
+	}
+	return otel.Tracer(instrumentationName)
+}
+
+// observe records the result and the latency of a delivery which started at start.
+func (c *Client) observe(start time.Time, result string) {
+	if c.metrics == nil {
+		return
+	}
+	c.metrics.Inc(metricSent, metrics.Labels{"result": result})
+	c.metrics.Observe(metricSendDuration, time.Since(start).Seconds(), metrics.Labels{"result": result})
+}
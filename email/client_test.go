@@ -0,0 +1,41 @@
+package email
+
+import (
+	"net"
+	"testing"
+
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestClient_SendFailure(t *testing.T) {
+	// Take a free port and close it, so that the delivery fails immediately.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	listener.Close()
+
+	exporter := tracetest.NewInMemoryExporter()
+	recorder := metrics.NewMemory()
+	client := NewClient("user", "password", host, port)
+	client.SetMetrics(recorder)
+	client.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter)))
+
+	request := NewRequest("from@example.com", "subject")
+	request.SetTo([]string{"to@example.com"})
+
+	assert := assert.New(t)
+	assert.Error(client.Send(request))
+	assert.Equal(float64(1), recorder.Counter(metricSent, metrics.Labels{"result": "failed"}))
+	assert.Equal(1, len(recorder.Histogram(metricSendDuration, metrics.Labels{"result": "failed"})))
+
+	spans := exporter.GetSpans()
+	assert.Equal(1, len(spans))
+	assert.Equal(`email.Send`, spans[0].Name)
+	assert.Equal(codes.Error, spans[0].Status.Code)
+}
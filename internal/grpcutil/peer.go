@@ -0,0 +1,21 @@
+// Package grpcutil provides helpers shared by the gRPC interceptors of the packages.
+package grpcutil
+
+import (
+	"context"
+	"net"
+
+	"google.golang.org/grpc/peer"
+)
+
+// PeerIP returns the ip address of the client of a RPC.
+func PeerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
@@ -0,0 +1,88 @@
+// Package metrics defines a small interface of counters and histograms,
+// so that packages can be instrumented without depending on a monitoring system.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Labels map[string]string
+
+type Recorder interface {
+	// Inc should increase the counter called name by one.
+	Inc(name string, labels Labels)
+
+	// Observe should record a value into the histogram called name.
+	Observe(name string, value float64, labels Labels)
+}
+
+// Nop is a Recorder which drops everything.
+var Nop Recorder = nop{}
+
+type nop struct{}
+
+func (nop) Inc(string, Labels) {}
+
+func (nop) Observe(string, float64, Labels) {}
+
+// Memory keeps all metrics in memory. It is mainly used by tests.
+type Memory struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	histograms map[string][]float64
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		counters:   make(map[string]float64),
+		histograms: make(map[string][]float64),
+	}
+}
+
+func (m *Memory) Inc(name string, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.counters[key(name, labels)]++
+}
+
+func (m *Memory) Observe(name string, value float64, labels Labels) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k := key(name, labels)
+	m.histograms[k] = append(m.histograms[k], value)
+}
+
+// Counter returns the value of a counter with exactly the given labels.
+func (m *Memory) Counter(name string, labels Labels) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[key(name, labels)]
+}
+
+// Histogram returns all values observed by a histogram with exactly the given labels.
+func (m *Memory) Histogram(name string, labels Labels) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]float64(nil), m.histograms[key(name, labels)]...)
+}
+
+// LabelNames returns the sorted names of labels.
+func LabelNames(labels Labels) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func key(name string, labels Labels) string {
+	var builder strings.Builder
+	builder.WriteString(name)
+	for _, label := range LabelNames(labels) {
+		builder.WriteString(`,` + label + `=` + labels[label])
+	}
+	return builder.String()
+}
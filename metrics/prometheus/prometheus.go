@@ -0,0 +1,88 @@
+// Package prometheus adapts metrics.Recorder to Prometheus collectors.
+package prometheus
+
+import (
+	"sync"
+
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder creates a Prometheus counter or histogram the first time a metric is recorded.
+// Label names of a metric are fixed by its first record.
+type Recorder struct {
+	registerer prometheus.Registerer
+	namespace  string
+	buckets    []float64
+
+	mu         sync.Mutex
+	counters   map[string]*prometheus.CounterVec
+	histograms map[string]*prometheus.HistogramVec
+}
+
+// NewRecorder returns a Recorder which registers collectors to registerer.
+// If buckets is empty, prometheus.DefBuckets is used for histograms.
+func NewRecorder(registerer prometheus.Registerer, namespace string, buckets []float64) *Recorder {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	return &Recorder{
+		registerer: registerer,
+		namespace:  namespace,
+		buckets:    buckets,
+		counters:   make(map[string]*prometheus.CounterVec),
+		histograms: make(map[string]*prometheus.HistogramVec),
+	}
+}
+
+func (r *Recorder) Inc(name string, labels metrics.Labels) {
+	r.mu.Lock()
+	counter, ok := r.counters[name]
+	if !ok {
+		counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: r.namespace,
+			Name:      name,
+			Help:      name,
+		}, metrics.LabelNames(labels))
+		counter = register(r.registerer, counter).(*prometheus.CounterVec)
+		r.counters[name] = counter
+	}
+	r.mu.Unlock()
+
+	if c, err := counter.GetMetricWith(prometheus.Labels(labels)); err == nil {
+		c.Inc()
+	}
+}
+
+func (r *Recorder) Observe(name string, value float64, labels metrics.Labels) {
+	r.mu.Lock()
+	histogram, ok := r.histograms[name]
+	if !ok {
+		histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: r.namespace,
+			Name:      name,
+			Help:      name,
+			Buckets:   r.buckets,
+		}, metrics.LabelNames(labels))
+		histogram = register(r.registerer, histogram).(*prometheus.HistogramVec)
+		r.histograms[name] = histogram
+	}
+	r.mu.Unlock()
+
+	if h, err := histogram.GetMetricWith(prometheus.Labels(labels)); err == nil {
+		h.Observe(value)
+	}
+}
+
+// register registers a collector and returns the one already registered, if there is one.
+func register(registerer prometheus.Registerer, collector prometheus.Collector) prometheus.Collector {
+	if err := registerer.Register(collector); err != nil {
+		if already, ok := err.(prometheus.AlreadyRegisteredError); ok {
+			return already.ExistingCollector
+		}
+	}
+	return collector
+}
@@ -0,0 +1,25 @@
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecorder(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	recorder := NewRecorder(registry, `pandora`, nil)
+
+	recorder.Inc(`jwt_validations_total`, metrics.Labels{"result": "valid"})
+	recorder.Inc(`jwt_validations_total`, metrics.Labels{"result": "valid"})
+	recorder.Inc(`jwt_validations_total`, metrics.Labels{"result": "rejected"})
+	recorder.Observe(`jwt_validation_duration_seconds`, 0.01, metrics.Labels{"result": "valid"})
+
+	assert := assert.New(t)
+	assert.Equal(float64(2), testutil.ToFloat64(recorder.counters[`jwt_validations_total`].WithLabelValues("valid")))
+	assert.Equal(float64(1), testutil.ToFloat64(recorder.counters[`jwt_validations_total`].WithLabelValues("rejected")))
+	assert.Equal(3, testutil.CollectAndCount(registry))
+}
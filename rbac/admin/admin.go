@@ -0,0 +1,166 @@
+// Package admin provides gin handlers which manage roles and policies of rbac at runtime.
+//
+// Every request is authorized by the access control it manages, against a meta-resource under Prefix
+// with the operation MethodOperations of the access control maps its method onto, such as Read for "/rbac/roles" or Update for "/rbac/roles/2/permissions".
+// A request is rejected unless a policy covers its meta-resource, so the API is closed until it is granted, e.g.
+//
+//	{URI: "/rbac/**", Groups: []rbac.PermissionGroup{{Operation: rbac.CRUD, RoleID: []int64{1}}}}
+//
+// Changes are applied to the RoleManager and the PolicyManager at once. A change of policies is rejected
+// with 409 if another source, such as PolicyManager.Watch, has loaded policies since the API read them.
+package admin
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/rbac"
+)
+
+// Prefix is the prefix of meta-resources the API is authorized against, no matter where it is mounted.
+const Prefix = "/rbac"
+
+var (
+	ErrInvalidInput   = errors.New("RBAC: invalid input")
+	ErrRoleNotFound   = rbac.ErrRoleNotFound
+	ErrRoleExists     = errors.New("RBAC: role already exists")
+	ErrRoleCycle      = rbac.ErrRoleCycle
+	ErrRoleHasChild   = rbac.ErrRoleHasChildren
+	ErrPolicyNotFound = errors.New("RBAC: policy is not found")
+	ErrPolicyExists   = errors.New("RBAC: policy already exists")
+	ErrConflict       = rbac.ErrVersionConflict
+)
+
+// Handler serves the API.
+type Handler struct {
+	// AccessControl authorizes requests to the API.
+	AccessControl *rbac.AccessControl
+	Policies      *rbac.PolicyManager
+	Roles         *rbac.RoleManager
+
+	// Extract returns roles of the user who sends a request.
+	Extract rbac.RoleExtractor
+
+	// mu serializes changes, which read and write roles or policies as a whole.
+	mu sync.Mutex
+}
+
+func New(ac *rbac.AccessControl, policies *rbac.PolicyManager, roles *rbac.RoleManager, extract rbac.RoleExtractor) *Handler {
+	return &Handler{AccessControl: ac, Policies: policies, Roles: roles, Extract: extract}
+}
+
+// Register mounts the API on r:
+//
+//	GET, POST          /roles
+//	GET, PUT, DELETE   /roles/:id (PUT keeps the name, parent and permissions it omits)
+//	DELETE             /roles/:id?children=cascade|reparent
+//	PUT, DELETE        /roles/:id/parent
+//	GET, POST, PUT     /roles/:id/permissions
+//	DELETE             /roles/:id/permissions?uri=
+//	GET, POST          /policies
+//	GET, PUT, DELETE   /policies/*uri
+func (h *Handler) Register(r gin.IRoutes) {
+	r.GET("/roles", h.authorize(rolesResource), h.listRoles)
+	r.POST("/roles", h.authorize(rolesResource), h.createRole)
+	r.GET("/roles/:id", h.authorize(roleResource), h.getRole)
+	r.PUT("/roles/:id", h.authorize(roleResource), h.updateRole)
+	r.DELETE("/roles/:id", h.authorize(roleResource), h.deleteRole)
+	r.PUT("/roles/:id/parent", h.authorize(parentResource), h.setParent)
+	r.DELETE("/roles/:id/parent", h.authorize(parentResource), h.removeParent)
+	r.GET("/roles/:id/permissions", h.authorize(permissionsResource), h.listPermissions)
+	r.POST("/roles/:id/permissions", h.authorize(permissionsResource), h.addPermission)
+	r.PUT("/roles/:id/permissions", h.authorize(permissionsResource), h.setPermissions)
+	r.DELETE("/roles/:id/permissions", h.authorize(permissionsResource), h.removePermissions)
+	r.GET("/policies", h.authorize(policiesResource), h.listPolicies)
+	r.POST("/policies", h.authorize(policiesResource), h.createPolicy)
+	r.GET("/policies/*uri", h.authorize(policyResource), h.getPolicy)
+	r.PUT("/policies/*uri", h.authorize(policyResource), h.putPolicy)
+	r.DELETE("/policies/*uri", h.authorize(policyResource), h.deletePolicy)
+}
+
+func rolesResource(*gin.Context) string {
+	return Prefix + "/roles"
+}
+
+func roleResource(c *gin.Context) string {
+	return Prefix + "/roles/" + c.Param("id")
+}
+
+func parentResource(c *gin.Context) string {
+	return roleResource(c) + "/parent"
+}
+
+func permissionsResource(c *gin.Context) string {
+	return roleResource(c) + "/permissions"
+}
+
+func policiesResource(*gin.Context) string {
+	return Prefix + "/policies"
+}
+
+func policyResource(c *gin.Context) string {
+	return Prefix + "/policies" + c.Param("uri")
+}
+
+// authorize aborts with 401 if roles of the user can not be extracted,
+// and with 403 unless a policy covers the meta-resource and grants one of the roles.
+func (h *Handler) authorize(resource func(*gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		operation, ok := h.AccessControl.MethodOperation(c.Request.Method)
+		if !ok {
+			c.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+		roleID, ok := h.Extract(c)
+		if !ok {
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		decision := h.AccessControl.Authorize(c.Request.Context(), &rbac.Request{
+			URI:       resource(c),
+			Operation: operation,
+			Subject:   rbac.GinSubject(c, roleID),
+			Env:       rbac.Environment{Time: time.Now(), IP: net.ParseIP(c.ClientIP())},
+		})
+		if !decision.Required || !decision.Granted {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+	}
+}
+
+// fail aborts with the status of err and its message.
+func fail(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidInput), errors.Is(err, ErrRoleCycle):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrRoleNotFound), errors.Is(err, ErrPolicyNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrRoleExists), errors.Is(err, ErrPolicyExists), errors.Is(err, ErrRoleHasChild),
+		errors.Is(err, rbac.ErrRoleImmutable), errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
+// bind decodes the JSON body of a request into v.
+func bind(c *gin.Context, v interface{}) error {
+	if err := c.ShouldBindJSON(v); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidInput, err)
+	}
+	return nil
+}
+
+func roleID(c *gin.Context) (int64, error) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: role id %q", ErrInvalidInput, c.Param("id"))
+	}
+	return id, nil
+}
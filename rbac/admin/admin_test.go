@@ -0,0 +1,195 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func newRouter() (*gin.Engine, *rbac.PolicyManager, *rbac.RoleManager) {
+	roles := rbac.NewRoleManager()
+	roles.SetRole(&rbac.StandardRole{Id: 1, Name: `admin`})
+	roles.SetRole(&rbac.StandardRole{Id: 2, Name: `editor`, ParentId: 1})
+	roles.SetRole(&rbac.StandardRole{Id: 3, Name: `auditor`})
+	policies := rbac.NewPolicyManager(nil)
+	policies.LoadPolicies([]rbac.StandardPolicy{
+		{URI: `/rbac/**`, Groups: []rbac.PermissionGroup{{Operation: rbac.CRUD, RoleID: []int64{1}}}},
+		{URI: `/rbac/roles`, Groups: []rbac.PermissionGroup{{Operation: rbac.Read, RoleID: []int64{3}}}},
+		{URI: `/articles/*`, Groups: []rbac.PermissionGroup{{Operation: rbac.Read, RoleID: []int64{2}}}},
+	})
+	ac := rbac.NewAccessControl(policies, roles)
+	ac.Conditions = rbac.NewConditions()
+	ac.Conditions.Register(`owner`, rbac.Owner(`owner_id`))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if roleID := c.GetHeader(`X-Role`); roleID != `` {
+			c.Set(`user_info`, map[string]interface{}{
+				`role_id`: []interface{}{float64(roleID[0] - '0')},
+			})
+		}
+	})
+	New(ac, policies, roles, rbac.UserInfoRoles(`role_id`)).Register(router.Group(`/admin`))
+	return router, policies, roles
+}
+
+func serve(router *gin.Engine, method, uri, roleID, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(method, uri, strings.NewReader(body))
+	r.Header.Set(`Content-Type`, `application/json`)
+	if roleID != `` {
+		r.Header.Set(`X-Role`, roleID)
+	}
+	router.ServeHTTP(w, r)
+	return w
+}
+
+func TestHandler_Authorize(t *testing.T) {
+	router, _, _ := newRouter()
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusUnauthorized, serve(router, `GET`, `/admin/roles`, ``, ``).Code)
+	assert.Equal(http.StatusForbidden, serve(router, `GET`, `/admin/roles`, `2`, ``).Code)
+	assert.Equal(http.StatusOK, serve(router, `GET`, `/admin/roles`, `3`, ``).Code)
+	assert.Equal(http.StatusForbidden, serve(router, `GET`, `/admin/roles/1`, `3`, ``).Code)
+	assert.Equal(http.StatusForbidden, serve(router, `POST`, `/admin/roles`, `3`, `{"id": 4}`).Code)
+	assert.Equal(http.StatusOK, serve(router, `GET`, `/admin/roles/1`, `1`, ``).Code)
+}
+
+func TestHandler_MethodOperations(t *testing.T) {
+	roles := rbac.NewRoleManager()
+	policies := rbac.NewPolicyManager(nil)
+	policies.LoadPolicies([]rbac.StandardPolicy{
+		{URI: `/rbac/roles`, Groups: []rbac.PermissionGroup{{Operation: rbac.Read, RoleID: []int64{3}}}},
+	})
+	ac := rbac.NewAccessControl(policies, roles)
+	ac.MethodOperations = map[string]rbac.Operation{`GET`: rbac.Create}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set(`user_info`, map[string]interface{}{`role_id`: []interface{}{float64(3)}})
+	})
+	New(ac, policies, roles, rbac.UserInfoRoles(`role_id`)).Register(router.Group(`/admin`))
+
+	// the API maps methods onto operations as the middlewares of the access control do
+	assert := assert.New(t)
+	assert.Equal(http.StatusForbidden, serve(router, `GET`, `/admin/roles`, ``, ``).Code)
+	assert.Equal(http.StatusMethodNotAllowed, serve(router, `DELETE`, `/admin/roles/3`, ``, ``).Code)
+	ac.MethodOperations = nil
+	assert.Equal(http.StatusOK, serve(router, `GET`, `/admin/roles`, ``, ``).Code)
+}
+
+func TestHandler_Roles(t *testing.T) {
+	router, _, roles := newRouter()
+
+	assert := assert.New(t)
+	w := serve(router, `POST`, `/admin/roles`, `1`,
+		`{"id": 4, "name": "writer", "parent": 2, "permissions": [{"uri": "/articles/*", "operation": "CR"}]}`)
+	assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+	assert.True(roles.GetRole(4).HasPermission(`/articles/1`, rbac.Create))
+	assert.True(roles.IsSuperior(roles.GetRole(2), roles.GetRole(4)))
+
+	assert.Equal(http.StatusConflict, serve(router, `POST`, `/admin/roles`, `1`, `{"id": 4}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `POST`, `/admin/roles`, `1`, `{"id": 0}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `POST`, `/admin/roles`, `1`,
+		`{"id": 5, "permissions": [{"uri": "/a/{id:[}", "operation": "R"}]}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `POST`, `/admin/roles`, `1`,
+		`{"id": 5, "permissions": [{"uri": "/a", "operation": "fly"}]}`).Code)
+	assert.Equal(http.StatusNotFound, serve(router, `POST`, `/admin/roles`, `1`, `{"id": 5, "parent": 9}`).Code)
+
+	w = serve(router, `PUT`, `/admin/roles/4`, `1`, `{"name": "author", "parent": 2}`)
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	var role Role
+	assert.Nil(json.Unmarshal(w.Body.Bytes(), &role))
+	assert.Equal(Role{ID: 4, Name: `author`, Parent: 2, Permissions: []Permission{
+		{URI: `/articles/*`, Operation: `create|read`},
+	}}, role)
+
+	// a parent which is omitted is kept like permissions, and 0 detaches the role
+	assert.Equal(http.StatusOK, serve(router, `PUT`, `/admin/roles/4`, `1`, `{"permissions": []}`).Code)
+	assert.Equal(int64(2), roles.GetRole(4).ParentID())
+	assert.Equal(`author`, roleName(roles.GetRole(4)))
+	assert.Equal(http.StatusOK, serve(router, `PUT`, `/admin/roles/4`, `1`, `{"parent": 0}`).Code)
+	assert.Equal(int64(0), roles.GetRole(4).ParentID())
+	assert.Equal(http.StatusOK, serve(router, `PUT`, `/admin/roles/4`, `1`,
+		`{"parent": 2, "permissions": [{"uri": "/articles/*", "operation": "CR"}]}`).Code)
+
+	assert.Equal(http.StatusBadRequest, serve(router, `PUT`, `/admin/roles/2/parent`, `1`, `{"parent": 4}`).Code)
+	assert.Equal(http.StatusOK, serve(router, `PUT`, `/admin/roles/4/parent`, `1`, `{"parent": 3}`).Code)
+	assert.Equal(int64(3), roles.GetRole(4).ParentID())
+	assert.Equal(http.StatusOK, serve(router, `DELETE`, `/admin/roles/4/parent`, `1`, ``).Code)
+	assert.Equal(int64(0), roles.GetRole(4).ParentID())
+
+	w = serve(router, `POST`, `/admin/roles/4/permissions`, `1`, `{"uri": "/secret", "operation": "R", "effect": "deny"}`)
+	assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+	assert.Equal(2, len(roleOutput(roles.GetRole(4)).Permissions))
+	assert.Equal(http.StatusOK, serve(router, `DELETE`, `/admin/roles/4/permissions?uri=/articles/*`, `1`, ``).Code)
+	assert.False(roles.GetRole(4).HasPermission(`/articles/1`, rbac.Read))
+	w = serve(router, `PUT`, `/admin/roles/4/permissions`, `1`, `[{"uri": "/comments/**", "operation": "read"}]`)
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(`[{"uri":"/comments/**","operation":"read"}]`, w.Body.String())
+	assert.Equal(`author`, roleName(roles.GetRole(4)))
+
+	// permissions are saved like the role, which checks its parent
+	roles.SetRole(&rbac.StandardRole{Id: 7, Name: `orphan`, ParentId: 9})
+	assert.Equal(http.StatusNotFound, serve(router, `POST`, `/admin/roles/7/permissions`, `1`, `{"uri": "/a", "operation": "R"}`).Code)
+	assert.Nil(roles.GetRole(7).(*rbac.StandardRole).Permissions)
+	roles.RemoveRole(7, rbac.RejectChildren)
+
+	assert.Equal(http.StatusConflict, serve(router, `DELETE`, `/admin/roles/1`, `1`, ``).Code)
+	assert.Equal(http.StatusNoContent, serve(router, `DELETE`, `/admin/roles/4`, `1`, ``).Code)
+	assert.Nil(roles.GetRole(4))
+	assert.Equal(http.StatusNotFound, serve(router, `GET`, `/admin/roles/4`, `1`, ``).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `GET`, `/admin/roles/x`, `1`, ``).Code)
+
+	assert.Equal(http.StatusCreated, serve(router, `POST`, `/admin/roles`, `1`, `{"id": 5, "parent": 2}`).Code)
+	assert.Equal(http.StatusCreated, serve(router, `POST`, `/admin/roles`, `1`, `{"id": 6, "parent": 5}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `DELETE`, `/admin/roles/2?children=drop`, `1`, ``).Code)
+	assert.Equal(http.StatusNoContent, serve(router, `DELETE`, `/admin/roles/2?children=reparent`, `1`, ``).Code)
+	assert.Equal(int64(1), roles.GetRole(5).ParentID())
+	assert.Equal(http.StatusNoContent, serve(router, `DELETE`, `/admin/roles/5?children=cascade`, `1`, ``).Code)
+	assert.Nil(roles.GetRole(6))
+}
+
+func TestHandler_Policies(t *testing.T) {
+	router, policies, roles := newRouter()
+	editor := roles.GetRole(2)
+
+	assert := assert.New(t)
+	w := serve(router, `POST`, `/admin/policies`, `1`,
+		`{"uri": "/comments/**", "groups": [{"operation": "R", "roles": [2]}]}`)
+	assert.Equal(http.StatusCreated, w.Code, w.Body.String())
+	assert.True(policies.IsGranted(`/comments/1`, rbac.Read, editor))
+	assert.Equal(Source, policies.Current().Source)
+	assert.Equal(http.StatusConflict, serve(router, `POST`, `/admin/policies`, `1`, `{"uri": "/comments/**"}`).Code)
+	assert.Equal(http.StatusNotFound, serve(router, `POST`, `/admin/policies`, `1`,
+		`{"uri": "/x", "groups": [{"operation": "R", "roles": [9]}]}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `POST`, `/admin/policies`, `1`,
+		`{"uri": "/x", "groups": [{"operation": "R", "roles": [2], "conditions": ["weekday"]}]}`).Code)
+	assert.Equal(http.StatusBadRequest, serve(router, `POST`, `/admin/policies`, `1`, `{"uri": "x"}`).Code)
+
+	w = serve(router, `PUT`, `/admin/policies/articles/*`, `1`,
+		`{"groups": [{"operation": "R", "roles": [2], "effect": "deny"}, {"operation": "U", "roles": [2], "conditions": ["owner"]}]}`)
+	assert.Equal(http.StatusOK, w.Code, w.Body.String())
+	assert.False(policies.IsGranted(`/articles/1`, rbac.Read, editor))
+	w = serve(router, `GET`, `/admin/policies/articles/*`, `1`, ``)
+	assert.Equal(`{"uri":"/articles/*","groups":[{"operation":"read","roles":[2],"effect":"deny"},`+
+		`{"operation":"update","roles":[2],"conditions":["owner"]}]}`, w.Body.String())
+
+	assert.Equal(http.StatusNoContent, serve(router, `DELETE`, `/admin/policies/comments/**`, `1`, ``).Code)
+	_, required := policies.Require(`/comments/1`, rbac.Read)
+	assert.False(required)
+	assert.Equal(http.StatusNotFound, serve(router, `DELETE`, `/admin/policies/comments/**`, `1`, ``).Code)
+
+	var list []Policy
+	assert.Nil(json.Unmarshal(serve(router, `GET`, `/admin/policies`, `1`, ``).Body.Bytes(), &list))
+	assert.Equal(3, len(list))
+}
@@ -0,0 +1,187 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/rbac"
+)
+
+// Source is the source of policy versions the API loads.
+const Source = "admin"
+
+// Group is a permission group of a policy in requests and responses.
+type Group struct {
+	Operation  string   `json:"operation"`
+	Roles      []int64  `json:"roles"`
+	Effect     string   `json:"effect,omitempty"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+// Policy is a policy in requests and responses.
+type Policy struct {
+	URI    string  `json:"uri"`
+	Groups []Group `json:"groups"`
+}
+
+func (h *Handler) listPolicies(c *gin.Context) {
+	policies := []Policy{}
+	for _, policy := range h.Policies.Current().StandardPolicies() {
+		policies = append(policies, policyOutput(policy))
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+func (h *Handler) createPolicy(c *gin.Context) {
+	var input Policy
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	policy, err := h.buildPolicy(input)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	current := h.Policies.Current()
+	policies := current.StandardPolicies()
+	if indexOf(policies, policy.URI) >= 0 {
+		fail(c, fmt.Errorf("%w: %s", ErrPolicyExists, policy.URI))
+		return
+	}
+	if _, err := h.Policies.LoadIf(current.Version, append(policies[:len(policies):len(policies)], policy), Source); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, policyOutput(policy))
+}
+
+func (h *Handler) getPolicy(c *gin.Context) {
+	policies := h.Policies.Current().StandardPolicies()
+	i := indexOf(policies, c.Param("uri"))
+	if i < 0 {
+		fail(c, fmt.Errorf("%w: %s", ErrPolicyNotFound, c.Param("uri")))
+		return
+	}
+	c.JSON(http.StatusOK, policyOutput(policies[i]))
+}
+
+// putPolicy replaces the policy of the uri in the path, or creates it.
+func (h *Handler) putPolicy(c *gin.Context) {
+	var input Policy
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	if input.URI != "" && input.URI != c.Param("uri") {
+		fail(c, fmt.Errorf("%w: uri %s does not match %s", ErrInvalidInput, input.URI, c.Param("uri")))
+		return
+	}
+	input.URI = c.Param("uri")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	policy, err := h.buildPolicy(input)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	current := h.Policies.Current()
+	policies := append([]rbac.StandardPolicy(nil), current.StandardPolicies()...)
+	status := http.StatusOK
+	if i := indexOf(policies, policy.URI); i >= 0 {
+		policies[i] = policy
+	} else {
+		policies = append(policies, policy)
+		status = http.StatusCreated
+	}
+	if _, err := h.Policies.LoadIf(current.Version, policies, Source); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(status, policyOutput(policy))
+}
+
+func (h *Handler) deletePolicy(c *gin.Context) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	current := h.Policies.Current()
+	policies := current.StandardPolicies()
+	i := indexOf(policies, c.Param("uri"))
+	if i < 0 {
+		fail(c, fmt.Errorf("%w: %s", ErrPolicyNotFound, c.Param("uri")))
+		return
+	}
+	kept := append(append([]rbac.StandardPolicy(nil), policies[:i]...), policies[i+1:]...)
+	if _, err := h.Policies.LoadIf(current.Version, kept, Source); err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// buildPolicy validates a policy. Roles of groups must exist, and so must conditions if AccessControl has any.
+func (h *Handler) buildPolicy(input Policy) (rbac.StandardPolicy, error) {
+	if input.URI == "" || input.URI[0] != '/' {
+		return rbac.StandardPolicy{}, fmt.Errorf("%w: uri %q", ErrInvalidInput, input.URI)
+	}
+	if err := rbac.ValidatePattern(input.URI); err != nil {
+		return rbac.StandardPolicy{}, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+	}
+	policy := rbac.StandardPolicy{URI: input.URI, Groups: []rbac.PermissionGroup{}}
+	for _, g := range input.Groups {
+		operation, err := rbac.ParseOperation(g.Operation)
+		if err != nil {
+			return policy, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+		}
+		effect, err := rbac.ParseEffect(g.Effect)
+		if err != nil {
+			return policy, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+		}
+		for _, id := range g.Roles {
+			if h.Roles.GetRole(id) == nil {
+				return policy, fmt.Errorf("%w: %d", ErrRoleNotFound, id)
+			}
+		}
+		for _, name := range g.Conditions {
+			if conditions := h.AccessControl.Conditions; conditions != nil {
+				if _, ok := conditions.Lookup(name); !ok {
+					return policy, fmt.Errorf("%w: unknown condition %q", ErrInvalidInput, name)
+				}
+			}
+		}
+		policy.Groups = append(policy.Groups, rbac.PermissionGroup{
+			Operation:  operation,
+			RoleID:     g.Roles,
+			Effect:     effect,
+			Conditions: g.Conditions,
+		})
+	}
+	return policy, nil
+}
+
+func policyOutput(policy rbac.StandardPolicy) Policy {
+	output := Policy{URI: policy.URI, Groups: []Group{}}
+	for _, g := range policy.Groups {
+		group := Group{Operation: g.Operation.String(), Roles: g.RoleID, Conditions: g.Conditions}
+		if group.Roles == nil {
+			group.Roles = []int64{}
+		}
+		if g.Effect != rbac.Allow {
+			group.Effect = g.Effect.String()
+		}
+		output.Groups = append(output.Groups, group)
+	}
+	return output
+}
+
+func indexOf(policies []rbac.StandardPolicy, uri string) int {
+	for i, policy := range policies {
+		if policy.URI == uri {
+			return i
+		}
+	}
+	return -1
+}
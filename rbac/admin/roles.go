@@ -0,0 +1,346 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/rbac"
+)
+
+// Permission is a permission of a role in requests and responses.
+type Permission struct {
+	URI       string `json:"uri"`
+	Operation string `json:"operation"`
+	Effect    string `json:"effect,omitempty"`
+}
+
+// Role is a role in requests and responses.
+type Role struct {
+	ID          int64        `json:"id"`
+	Name        string       `json:"name"`
+	Parent      int64        `json:"parent,omitempty"`
+	Permissions []Permission `json:"permissions"`
+}
+
+// roleUpdate is a role in requests which update it. Fields which are omitted are kept,
+// and a parent of 0 detaches the role from its parent.
+type roleUpdate struct {
+	ID          int64        `json:"id"`
+	Name        *string      `json:"name"`
+	Parent      *int64       `json:"parent"`
+	Permissions []Permission `json:"permissions"`
+}
+
+type parentInput struct {
+	Parent int64 `json:"parent"`
+}
+
+func (h *Handler) listRoles(c *gin.Context) {
+	var roles []Role
+	h.Roles.Range(func(role rbac.Role) bool {
+		roles = append(roles, roleOutput(role))
+		return true
+	})
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	if roles == nil {
+		roles = []Role{}
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+func (h *Handler) createRole(c *gin.Context) {
+	var input Role
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	if input.ID <= 0 {
+		fail(c, fmt.Errorf("%w: role id %d", ErrInvalidInput, input.ID))
+		return
+	}
+	permissions, err := buildPermissions(input.Permissions)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.Roles.GetRole(input.ID) != nil {
+		fail(c, fmt.Errorf("%w: %d", ErrRoleExists, input.ID))
+		return
+	}
+	if err := checkParent(input.Parent); err != nil {
+		fail(c, err)
+		return
+	}
+	role := &rbac.StandardRole{Id: input.ID, Name: input.Name, Permissions: permissions, ParentId: input.Parent}
+	if err := h.Roles.SaveRole(role); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusCreated, roleOutput(role))
+}
+
+func (h *Handler) getRole(c *gin.Context) {
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roleOutput(role))
+}
+
+func (h *Handler) updateRole(c *gin.Context) {
+	var input roleUpdate
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if input.ID != 0 && input.ID != role.ID() {
+		fail(c, fmt.Errorf("%w: role id %d does not match %d", ErrInvalidInput, input.ID, role.ID()))
+		return
+	}
+	updated := &rbac.StandardRole{Id: role.ID(), Name: roleName(role), Permissions: rolePermissions(role), ParentId: role.ParentID()}
+	if input.Name != nil {
+		updated.Name = *input.Name
+	}
+	if input.Parent != nil {
+		if err := checkParent(*input.Parent); err != nil {
+			fail(c, err)
+			return
+		}
+		updated.ParentId = *input.Parent
+	}
+	if input.Permissions != nil {
+		if updated.Permissions, err = buildPermissions(input.Permissions); err != nil {
+			fail(c, err)
+			return
+		}
+	}
+	if err := h.Roles.SaveRole(updated); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roleOutput(updated))
+}
+
+// deleteRole deletes a role. A role which has children is only deleted with them if the query has
+// children=cascade, or after they are moved to its parent if it has children=reparent.
+// Policies which refer to deleted roles are kept.
+func (h *Handler) deleteRole(c *gin.Context) {
+	var mode rbac.RemoveMode
+	switch children := c.Query("children"); children {
+	case "":
+		mode = rbac.RejectChildren
+	case "cascade":
+		mode = rbac.CascadeChildren
+	case "reparent":
+		mode = rbac.ReparentChildren
+	default:
+		fail(c, fmt.Errorf("%w: children %q", ErrInvalidInput, children))
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if _, err := h.Roles.RemoveRole(role.ID(), mode); err != nil {
+		fail(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *Handler) setParent(c *gin.Context) {
+	var input parentInput
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	h.updateParent(c, input.Parent)
+}
+
+func (h *Handler) removeParent(c *gin.Context) {
+	h.updateParent(c, 0)
+}
+
+func (h *Handler) updateParent(c *gin.Context, parent int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	if err := checkParent(parent); err != nil {
+		fail(c, err)
+		return
+	}
+	updated := &rbac.StandardRole{Id: role.ID(), Name: roleName(role), Permissions: rolePermissions(role), ParentId: parent}
+	if err := h.Roles.SaveRole(updated); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roleOutput(updated))
+}
+
+func (h *Handler) listPermissions(c *gin.Context) {
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, roleOutput(role).Permissions)
+}
+
+func (h *Handler) addPermission(c *gin.Context) {
+	var input Permission
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	h.changePermissions(c, http.StatusCreated, func(permissions []Permission) []Permission {
+		return append(permissions, input)
+	})
+}
+
+func (h *Handler) setPermissions(c *gin.Context) {
+	var input []Permission
+	if err := bind(c, &input); err != nil {
+		fail(c, err)
+		return
+	}
+	h.changePermissions(c, http.StatusOK, func([]Permission) []Permission {
+		return input
+	})
+}
+
+// removePermissions removes all permissions of the uri in the query.
+func (h *Handler) removePermissions(c *gin.Context) {
+	uri := c.Query("uri")
+	if uri == "" {
+		fail(c, fmt.Errorf("%w: missing uri", ErrInvalidInput))
+		return
+	}
+	h.changePermissions(c, http.StatusOK, func(permissions []Permission) []Permission {
+		kept := permissions[:0]
+		for _, p := range permissions {
+			if p.URI != uri {
+				kept = append(kept, p)
+			}
+		}
+		return kept
+	})
+}
+
+// changePermissions replaces permissions of a role with what change returns from the current ones,
+// and responds with them in status.
+func (h *Handler) changePermissions(c *gin.Context, status int, change func([]Permission) []Permission) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	role, err := h.role(c)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	list := change(roleOutput(role).Permissions)
+	permissions, err := buildPermissions(list)
+	if err != nil {
+		fail(c, err)
+		return
+	}
+	updated := &rbac.StandardRole{Id: role.ID(), Name: roleName(role), Permissions: permissions, ParentId: role.ParentID()}
+	if err := h.Roles.SaveRole(updated); err != nil {
+		fail(c, err)
+		return
+	}
+	c.JSON(status, roleOutput(updated).Permissions)
+}
+
+// role returns the role of the id in the path.
+func (h *Handler) role(c *gin.Context) (rbac.Role, error) {
+	id, err := roleID(c)
+	if err != nil {
+		return nil, err
+	}
+	role := h.Roles.GetRole(id)
+	if role == nil {
+		return nil, fmt.Errorf("%w: %d", ErrRoleNotFound, id)
+	}
+	return role, nil
+}
+
+// checkParent checks that a parent id is valid. RoleManager.SaveRole checks that it exists and makes no cycle.
+func checkParent(parent int64) error {
+	if parent < 0 {
+		return fmt.Errorf("%w: parent id %d", ErrInvalidInput, parent)
+	}
+	return nil
+}
+
+// buildPermissions validates permissions and builds a PermissionTree of them.
+func buildPermissions(list []Permission) (*rbac.PermissionTree, error) {
+	tree := rbac.NewPermissionTree()
+	for _, p := range list {
+		if p.URI == "" {
+			return nil, fmt.Errorf("%w: missing uri", ErrInvalidInput)
+		}
+		if err := rbac.ValidatePattern(p.URI); err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+		}
+		operation, err := rbac.ParseOperation(p.Operation)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+		}
+		effect, err := rbac.ParseEffect(p.Effect)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidInput, err)
+		}
+		tree.Add(&rbac.StandardPermission{URI: p.URI, Operation: operation, Effect: effect})
+	}
+	return tree, nil
+}
+
+func roleOutput(role rbac.Role) Role {
+	output := Role{ID: role.ID(), Name: roleName(role), Parent: role.ParentID(), Permissions: []Permission{}}
+	if lister, ok := rolePermissions(role).(interface {
+		Permissions() []rbac.StandardPermission
+	}); ok {
+		for _, p := range lister.Permissions() {
+			permission := Permission{URI: p.URI, Operation: p.Operation.String()}
+			if p.Effect != rbac.Allow {
+				permission.Effect = p.Effect.String()
+			}
+			output.Permissions = append(output.Permissions, permission)
+		}
+	}
+	return output
+}
+
+func roleName(role rbac.Role) string {
+	if standard, ok := role.(*rbac.StandardRole); ok {
+		return standard.Name
+	}
+	return ""
+}
+
+// rolePermissions returns the permissions a role embeds, or the role itself if it is not a StandardRole.
+func rolePermissions(role rbac.Role) rbac.Permissions {
+	if standard, ok := role.(*rbac.StandardRole); ok {
+		return standard.Permissions
+	}
+	return role
+}
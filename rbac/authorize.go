@@ -0,0 +1,167 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+)
+
+// PolicyMatch holds the rules of policies which match a request.
+type PolicyMatch struct {
+	Algorithm CombiningAlgorithm
+
+	// Rules are the groups including the requested operation, from the most specific policy.
+	// Their roles include the ones inheriting the permission.
+	Rules []Rule
+}
+
+// PolicyLookup is implemented by Policies which can tell the policies matching a request,
+// so that conditions of the policies can be evaluated.
+type PolicyLookup interface {
+	Lookup(uri string, op Operation) (PolicyMatch, bool)
+}
+
+// policyLookup returns policies as a PolicyLookup, unless they can not look up policies.
+// A wrapper such as PolicyManager tells by CanLookup whether the policies it wraps can.
+func policyLookup(policies Policies) (PolicyLookup, bool) {
+	lookup, ok := policies.(PolicyLookup)
+	if !ok {
+		return nil, false
+	}
+	if wrapper, ok := policies.(interface{ CanLookup() bool }); ok && !wrapper.CanLookup() {
+		return nil, false
+	}
+	return lookup, true
+}
+
+// hasHierarchy tells whether policies grant permissions along the hierarchy of roles by themselves,
+// as a PolicyTree does once SetHierarchy is called. A wrapper such as PolicyManager tells it by HasHierarchy.
+func hasHierarchy(policies Policies) bool {
+	h, ok := policies.(interface{ HasHierarchy() bool })
+	return ok && h.HasHierarchy()
+}
+
+// Authorize decides whether the subject of a request can operate a resource,
+// evaluating conditions of policies, and audits the decision.
+func (ac *AccessControl) Authorize(ctx context.Context, req *Request) Decision {
+	decision := ac.decide(ctx, req)
+	ac.auditDecision(req, decision)
+	return decision
+}
+
+// auditDecision records a decision which policies require.
+func (ac *AccessControl) auditDecision(req *Request, decision Decision) {
+	var ip string
+	if req.Env.IP != nil {
+		ip = req.Env.IP.String()
+	}
+	if decision.Required {
+		ac.recordDecision(req.URI, req.Operation, req.Subject.RoleID, ip, decision.Granted, decision.Reason)
+	}
+}
+
+func (ac *AccessControl) decide(ctx context.Context, req *Request) Decision {
+	decision := ac.decidePolicies(ctx, req)
+	if decision.Granted && decision.Required && ac.Constraints != nil {
+		// Roles of a subject are active together, so a subject holding conflicting roles is granted nothing.
+		if err := ac.Constraints.CheckActivate(req.Subject.UserID, req.Subject.RoleID); err != nil {
+			decision.Granted, decision.RoleID, decision.Reason = false, 0, err.Error()
+		}
+	}
+	return decision
+}
+
+func (ac *AccessControl) decidePolicies(ctx context.Context, req *Request) Decision {
+	lookup, ok := policyLookup(ac.Policies)
+	if !ok {
+		roleID, required := ac.require(ctx, req.URI, req.Operation)
+		if !required {
+			return Decision{Granted: true, Reason: "no policy applies"}
+		}
+		decision := Decision{Required: true, Grantees: roleID}
+		if id, ok := ac.grantedRole(req.Subject.RoleID, roleID); ok {
+			decision.Granted, decision.RoleID = true, id
+			decision.Reason = fmt.Sprintf("role %d is granted", id)
+			return decision
+		}
+		decision.Reason = "no required role"
+		return decision
+	}
+
+	match, _ := ac.lookup(ctx, lookup, req.URI, req.Operation)
+	req.resolver = ac.ResourceResolver
+
+	var conditions []ConditionResult
+	decision := decideMatch(match, func(rule Rule) (int64, bool) {
+		var (
+			id int64
+			ok bool
+		)
+		if rule.Group.Effect == Deny {
+			// Deny rules only apply to the roles they list, not to superiors of them.
+			id, ok = firstID(req.Subject.RoleID, rule.Group.RoleID)
+		} else {
+			id, ok = ac.grantedRole(req.Subject.RoleID, rule.Group.RoleID)
+		}
+		if !ok {
+			return 0, false
+		}
+		req.setParams(rule.Params)
+		return id, ac.evaluateConditions(req, rule.Group.Conditions, &conditions)
+	})
+	decision.Conditions = conditions
+	if name, failed := decision.FailedCondition(); failed && !decision.Granted && decision.Pattern == "" {
+		decision.Reason = fmt.Sprintf("condition %q failed", name)
+	}
+	return decision
+}
+
+// evaluateConditions evaluates conditions in order until one fails, and records their results.
+func (ac *AccessControl) evaluateConditions(req *Request, names []string, results *[]ConditionResult) bool {
+	for _, name := range names {
+		result := ConditionResult{Name: name}
+		if condition, ok := ac.Conditions.Lookup(name); ok {
+			result.Passed, result.Err = condition(req)
+			result.Passed = result.Passed && result.Err == nil
+		} else {
+			result.Err = fmt.Errorf("RBAC: unknown condition %q", name)
+		}
+		*results = append(*results, result)
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// grantedRole returns the first of roleID which is required or, unless the policies grant permissions
+// along the hierarchy themselves, is a superior of a required role.
+func (ac *AccessControl) grantedRole(roleID []int64, required []int64) (int64, bool) {
+	if id, ok := firstID(roleID, required); ok {
+		return id, true
+	}
+	if ac.Roles == nil || hasHierarchy(ac.Policies) {
+		return 0, false
+	}
+	for _, id := range roleID {
+		role := ac.GetRole(id)
+		if role == nil {
+			continue
+		}
+		for _, r := range required {
+			if subordinate := ac.GetRole(r); subordinate != nil && ac.IsSuperior(role, subordinate) {
+				return id, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// firstID returns the first of roleID which is also in required.
+func firstID(roleID []int64, required []int64) (int64, bool) {
+	for _, id := range roleID {
+		if containsID(required, id) {
+			return id, true
+		}
+	}
+	return 0, false
+}
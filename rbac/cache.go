@@ -0,0 +1,263 @@
+package rbac
+
+import (
+	"container/list"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultCacheSize is the number of decisions a DecisionCache keeps if its size is not positive.
+const DefaultCacheSize = 10000
+
+// DecisionCache caches results of Require, IsGranted, Lookup and Decide of policies, evicting the least recently
+// used ones when it is full. URIs are normalized, so "/a/b/" and "a/b" share an entry.
+//
+// The cache is dropped whenever policies are loaded through it, and whenever the generation of the policies
+// or of roles changes, which PolicyManager and RoleManager report by Generation. Policies which are loaded
+// without the cache, and do not report a generation, leave stale decisions in it.
+//
+// Slices returned by the cache are shared by every caller, and must not be modified.
+type DecisionCache struct {
+	Policies Policies
+
+	roles Roles
+	size  int
+
+	mu         sync.Mutex
+	generation uint64
+	seen       [3]uint64
+	entries    map[cacheKey]*list.Element
+	lru        list.List
+
+	loads  atomic.Uint64
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type cacheKind uint8
+
+const (
+	cacheRequire cacheKind = iota
+	cacheGranted
+	cacheLookup
+	cacheDecide
+)
+
+type cacheKey struct {
+	kind  cacheKind
+	uri   string
+	op    Operation
+	role  int64
+	roles string
+}
+
+type cacheEntry struct {
+	key      cacheKey
+	roleID   []int64
+	match    PolicyMatch
+	decision Decision
+	ok       bool
+}
+
+// CacheStats counts lookups of a DecisionCache.
+type CacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+// NewDecisionCache returns a cache of decisions of policies keeping at most size decisions.
+// Roles are only watched for changes, and can be nil.
+func NewDecisionCache(policies Policies, roles Roles, size int) *DecisionCache {
+	if size <= 0 {
+		size = DefaultCacheSize
+	}
+	return &DecisionCache{Policies: policies, roles: roles, size: size, entries: make(map[cacheKey]*list.Element)}
+}
+
+// LoadPolicies loads policies and drops the cache.
+func (c *DecisionCache) LoadPolicies(policies []StandardPolicy) {
+	c.Policies.LoadPolicies(policies)
+	c.loads.Add(1)
+}
+
+func (c *DecisionCache) Require(uri string, op Operation) ([]int64, bool) {
+	entry := c.get(cacheKey{kind: cacheRequire, uri: normalizeURI(uri), op: op}, func(e *cacheEntry) {
+		e.roleID, e.ok = c.Policies.Require(uri, op)
+	})
+	return entry.roleID, entry.ok
+}
+
+func (c *DecisionCache) IsGranted(uri string, op Operation, role Role) bool {
+	entry := c.get(cacheKey{kind: cacheGranted, uri: normalizeURI(uri), op: op, role: role.ID()}, func(e *cacheEntry) {
+		e.ok = c.Policies.IsGranted(uri, op, role)
+	})
+	return entry.ok
+}
+
+// Lookup finds the policies which apply to a request. It finds nothing if CanLookup is false.
+func (c *DecisionCache) Lookup(uri string, op Operation) (PolicyMatch, bool) {
+	lookup, ok := policyLookup(c.Policies)
+	if !ok {
+		return PolicyMatch{}, false
+	}
+	entry := c.get(cacheKey{kind: cacheLookup, uri: normalizeURI(uri), op: op}, func(e *cacheEntry) {
+		e.match, e.ok = lookup.Lookup(uri, op)
+	})
+	return entry.match, entry.ok
+}
+
+// CanLookup shows whether the cached policies implement PolicyLookup, otherwise AccessControl decides requests by Require.
+func (c *DecisionCache) CanLookup() bool {
+	_, ok := policyLookup(c.Policies)
+	return ok
+}
+
+// HasHierarchy shows whether the cached policies grant permissions along the hierarchy of roles by themselves.
+func (c *DecisionCache) HasHierarchy() bool {
+	return hasHierarchy(c.Policies)
+}
+
+// Decide decides whether one of roles can operate a resource, like PolicyTree.Decide.
+// Decisions are shared by every set of the same roles, in any order, so roles are decided in ascending order
+// of ids: RoleID of a decision is the lowest role which decides it, not the first of roleID.
+// Policies which can not decide grant one of the roles Require returns.
+func (c *DecisionCache) Decide(uri string, op Operation, roleID []int64) Decision {
+	roleID = sortedRoles(roleID)
+	entry := c.get(cacheKey{kind: cacheDecide, uri: normalizeURI(uri), op: op, roles: roleSetKey(roleID)}, func(e *cacheEntry) {
+		if decider, ok := c.Policies.(interface {
+			Decide(string, Operation, []int64) Decision
+		}); ok {
+			e.decision = decider.Decide(uri, op, roleID)
+			return
+		}
+		required, ok := c.Policies.Require(uri, op)
+		if !ok {
+			e.decision = Decision{Granted: true, Reason: "no policy applies"}
+			return
+		}
+		e.decision = Decision{Required: true, Grantees: required, Reason: "no required role"}
+		if id, ok := firstID(roleID, required); ok {
+			e.decision.Granted, e.decision.RoleID = true, id
+			e.decision.Reason = fmt.Sprintf("role %d is granted", id)
+		}
+	})
+	return entry.decision
+}
+
+// Destroy destroys the policies and drops the cache.
+func (c *DecisionCache) Destroy() {
+	c.Policies.Destroy()
+	c.loads.Add(1)
+}
+
+// Purge drops all cached decisions.
+func (c *DecisionCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.purge()
+}
+
+func (c *DecisionCache) Stats() CacheStats {
+	generations := c.generations()
+	c.mu.Lock()
+	c.validate(generations)
+	size := c.lru.Len()
+	c.mu.Unlock()
+	return CacheStats{Hits: c.hits.Load(), Misses: c.misses.Load(), Size: size}
+}
+
+// get returns the entry of key, calling fill to decide it if it is not cached.
+func (c *DecisionCache) get(key cacheKey, fill func(*cacheEntry)) *cacheEntry {
+	generations := c.generations()
+	c.mu.Lock()
+	c.validate(generations)
+	if element, ok := c.entries[key]; ok {
+		c.lru.MoveToFront(element)
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return element.Value.(*cacheEntry)
+	}
+	generation := c.generation
+	c.mu.Unlock()
+	c.misses.Add(1)
+
+	// Decisions are made without the lock, so one which races with a reload is not cached.
+	entry := &cacheEntry{key: key}
+	fill(entry)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation != generation || c.seen != c.generations() {
+		return entry
+	}
+	if element, ok := c.entries[key]; ok {
+		return element.Value.(*cacheEntry)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	if c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).key)
+	}
+	return entry
+}
+
+// generations returns the generations which invalidate the cache when any of them changes.
+func (c *DecisionCache) generations() [3]uint64 {
+	generations := [3]uint64{c.loads.Load()}
+	if g, ok := c.Policies.(interface{ Generation() uint64 }); ok {
+		generations[1] = g.Generation()
+	}
+	if g, ok := c.roles.(interface{ Generation() uint64 }); ok {
+		generations[2] = g.Generation()
+	}
+	return generations
+}
+
+// validate drops all entries if generations have changed. It must be called with mu held.
+func (c *DecisionCache) validate(generations [3]uint64) {
+	if generations != c.seen {
+		c.seen = generations
+		c.purge()
+	}
+}
+
+// purge drops all entries. It must be called with mu held.
+func (c *DecisionCache) purge() {
+	c.generation++
+	c.entries = make(map[cacheKey]*list.Element)
+	c.lru.Init()
+}
+
+// normalizeURI drops the slashes at both ends of uri, which patterns ignore when they are matched.
+func normalizeURI(uri string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(uri, "/"), "/")
+}
+
+// sortedRoles returns a copy of roleID in ascending order without duplicates.
+func sortedRoles(roleID []int64) []int64 {
+	sorted := append([]int64(nil), roleID...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	unique := sorted[:0]
+	for i, id := range sorted {
+		if i == 0 || id != sorted[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// roleSetKey returns a key of roles sorted by sortedRoles.
+func roleSetKey(sorted []int64) string {
+	var b strings.Builder
+	for _, id := range sorted {
+		b.WriteString(strconv.FormatInt(id, 10))
+		b.WriteByte(',')
+	}
+	return b.String()
+}
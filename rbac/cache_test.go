@@ -0,0 +1,199 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecisionCache(t *testing.T) {
+	roles := NewRoleManager()
+	roles.SetRole(&StandardRole{Id: 1, Name: `admin`})
+	roles.SetRole(&StandardRole{Id: 2, Name: `editor`})
+	tree := NewPolicyTree()
+	tree.SetHierarchy(roles, ParentInherits)
+	cache := NewDecisionCache(tree, roles, 2)
+	cache.LoadPolicies([]StandardPolicy{
+		{`/articles/:id`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}},
+	})
+
+	assert := assert.New(t)
+	roleID, required := cache.Require(`/articles/1`, Read)
+	assert.True(required)
+	assert.Equal([]int64{2}, roleID)
+	cache.Require(`articles/1/`, Read)
+	assert.Equal(CacheStats{Hits: 1, Misses: 1, Size: 1}, cache.Stats())
+
+	assert.True(cache.IsGranted(`/articles/1`, Read, roles.GetRole(2)))
+	assert.False(cache.IsGranted(`/articles/1`, Read, roles.GetRole(1)))
+	assert.Equal(2, cache.Stats().Size)
+
+	// a role change invalidates decisions along the hierarchy
+	roles.SetRole(&StandardRole{Id: 2, Name: `editor`, ParentId: 1})
+	assert.Equal(0, cache.Stats().Size)
+	assert.True(cache.IsGranted(`/articles/1`, Read, roles.GetRole(1)))
+	assert.True(cache.Decide(`/articles/1`, Read, []int64{3, 1}).Granted)
+	assert.True(cache.Decide(`/articles/1`, Read, []int64{1, 3, 1}).Granted)
+	assert.Equal(uint64(2), cache.Stats().Hits)
+
+	// the granting role does not depend on the order of roles which share a decision
+	assert.Equal(int64(1), cache.Decide(`/articles/1`, Read, []int64{2, 1}).RoleID)
+	assert.Equal(int64(1), cache.Decide(`/articles/1`, Read, []int64{1, 2}).RoleID)
+
+	cache.LoadPolicies(nil)
+	_, required = cache.Require(`/articles/1`, Read)
+	assert.False(required)
+	match, ok := cache.Lookup(`/articles/1`, Read)
+	assert.False(ok)
+	assert.Empty(match.Rules)
+
+	cache.Purge()
+	assert.Equal(0, cache.Stats().Size)
+}
+
+func TestDecisionCache_PolicyManager(t *testing.T) {
+	manager := NewPolicyManager(nil)
+	cache := NewDecisionCache(manager, nil, 0)
+	ac := NewAccessControl(cache, NewRoleManager())
+
+	granted := func(roleID int64) bool {
+		return ac.Authorize(context.Background(), &Request{URI: `/data`, Operation: Read, Subject: Subject{RoleID: []int64{roleID}}}).Granted
+	}
+
+	assert := assert.New(t)
+	manager.Load([]StandardPolicy{{`/data`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}}, `a`)
+	assert.True(granted(1))
+	assert.False(granted(2))
+
+	manager.Load([]StandardPolicy{{`/data`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}}}, `b`)
+	assert.False(granted(1))
+	assert.True(granted(2))
+
+	manager.Rollback()
+	assert.True(granted(1))
+	assert.Equal(uint64(3), manager.Generation())
+}
+
+func TestDecisionCache_Concurrent(t *testing.T) {
+	manager := NewPolicyManager(nil)
+	cache := NewDecisionCache(manager, nil, 16)
+	manager.LoadPolicies(generatePolicies(10))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				uri := fmt.Sprintf(`/resources%d/%d`, (i+j)%10, j)
+				if j%50 == 0 {
+					manager.LoadPolicies(generatePolicies(10 + j/50%2))
+				}
+				roleID, required := cache.Require(uri, Read)
+				assert.True(t, required)
+				assert.Equal(t, []int64{int64((i+j)%10 + 1)}, roleID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	assert.LessOrEqual(t, cache.Stats().Size, 16)
+}
+
+func TestDecisionCache_WithoutLookup(t *testing.T) {
+	cache := NewDecisionCache(requirePolicies{NewPolicyTree()}, nil, 0)
+	cache.LoadPolicies([]StandardPolicy{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}})
+	ac := NewAccessControl(cache, NewRoleManager())
+
+	assert := assert.New(t)
+	assert.False(cache.CanLookup())
+	assert.False(ac.IsGranted(`/data/x`, Read, &StandardRole{Id: 99}))
+	assert.True(ac.IsGranted(`/data/x`, Read, &StandardRole{Id: 1}))
+
+	ac.Policies = NewDecisionCache(NewPolicyManager(func() Policies { return requirePolicies{NewPolicyTree()} }), nil, 0)
+	ac.LoadPolicies([]StandardPolicy{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}})
+	assert.False(ac.IsGranted(`/data/x`, Read, &StandardRole{Id: 99}))
+}
+
+// generatePolicies generates policies of n resources, each with a collection, its items and their fields.
+func generatePolicies(n int) []StandardPolicy {
+	policies := make([]StandardPolicy, 0, 3*n)
+	for i := 0; i < n; i++ {
+		roleID := int64(i + 1)
+		policies = append(policies,
+			StandardPolicy{fmt.Sprintf(`/resources%d`, i), []PermissionGroup{{Operation: CR, RoleID: []int64{roleID}}}},
+			StandardPolicy{fmt.Sprintf(`/resources%d/:id`, i), []PermissionGroup{
+				{Operation: Read, RoleID: []int64{roleID}},
+				{Operation: Update | Delete, RoleID: []int64{roleID + 1000}},
+			}},
+			StandardPolicy{fmt.Sprintf(`/resources%d/:id/**`, i), []PermissionGroup{{Operation: CRUD, RoleID: []int64{roleID + 1000}}}},
+		)
+	}
+	return policies
+}
+
+func benchmarkPolicies(b *testing.B, cached bool, f func(Policies, int)) {
+	const n = 1000
+	var policies Policies = NewPolicyTree()
+	if cached {
+		policies = NewDecisionCache(policies, nil, 0)
+	}
+	policies.LoadPolicies(generatePolicies(n))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f(policies, i%n)
+	}
+}
+
+func BenchmarkRequire(b *testing.B) {
+	uris := make([]string, 1000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d/fields/name`, i, i)
+	}
+	require := func(policies Policies, i int) {
+		policies.Require(uris[i], Update)
+	}
+	b.Run(`uncached`, func(b *testing.B) { benchmarkPolicies(b, false, require) })
+	b.Run(`cached`, func(b *testing.B) { benchmarkPolicies(b, true, require) })
+}
+
+func BenchmarkIsGranted(b *testing.B) {
+	uris := make([]string, 1000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d`, i, i)
+	}
+	role := &StandardRole{Id: 1}
+	isGranted := func(policies Policies, i int) {
+		policies.IsGranted(uris[i], Read, role)
+	}
+	b.Run(`uncached`, func(b *testing.B) { benchmarkPolicies(b, false, isGranted) })
+	b.Run(`cached`, func(b *testing.B) { benchmarkPolicies(b, true, isGranted) })
+}
+
+func BenchmarkRequire_Parallel(b *testing.B) {
+	uris := make([]string, 1000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d`, i, i)
+	}
+	for _, cached := range []bool{false, true} {
+		b.Run(fmt.Sprintf(`cached=%v`, cached), func(b *testing.B) {
+			var policies Policies = NewPolicyTree()
+			if cached {
+				policies = NewDecisionCache(policies, nil, 0)
+			}
+			policies.LoadPolicies(generatePolicies(1000))
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					policies.Require(uris[i%len(uris)], Read)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,199 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Effect is the effect of a rule which applies to a request.
+type Effect uint8
+
+const (
+	// Allow grants an operation. It is the default effect of rules.
+	Allow Effect = iota
+	// Deny forbids an operation.
+	Deny
+)
+
+var ErrInvalidEffect = errors.New("RBAC: invalid effect")
+
+func (e Effect) String() string {
+	switch e {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	}
+	return fmt.Sprintf("Effect(%d)", uint8(e))
+}
+
+// ParseEffect parses "allow" or "deny". An empty string is Allow.
+func ParseEffect(s string) (Effect, error) {
+	switch s {
+	case "", "allow":
+		return Allow, nil
+	case "deny":
+		return Deny, nil
+	}
+	return Allow, fmt.Errorf("%w: %q", ErrInvalidEffect, s)
+}
+
+// CombiningAlgorithm decides the result of a request from all rules which apply to it.
+type CombiningAlgorithm uint8
+
+const (
+	// MostSpecific only considers the most specific policy which has rules for an operation,
+	// and a deny rule of it overrides its allow rules. It is the default algorithm.
+	// Roles the most specific policy does not list are not granted by less specific ones,
+	// so a policy which only denies some roles denies every role; use DenyOverrides to deny a few roles.
+	MostSpecific CombiningAlgorithm = iota
+	// DenyOverrides considers every matching policy, and any deny rule overrides all allow rules.
+	DenyOverrides
+	// PermitOverrides considers every matching policy, and any allow rule overrides all deny rules.
+	PermitOverrides
+	// FirstApplicable lets the first rule which applies decide, from the most specific policy.
+	FirstApplicable
+)
+
+var ErrInvalidCombiningAlgorithm = errors.New("RBAC: invalid combining algorithm")
+
+var combiningAlgorithms = [...]string{
+	MostSpecific:    "most-specific",
+	DenyOverrides:   "deny-overrides",
+	PermitOverrides: "permit-overrides",
+	FirstApplicable: "first-applicable",
+}
+
+func (a CombiningAlgorithm) String() string {
+	if int(a) < len(combiningAlgorithms) {
+		return combiningAlgorithms[a]
+	}
+	return fmt.Sprintf("CombiningAlgorithm(%d)", uint8(a))
+}
+
+// ParseCombiningAlgorithm parses the name of a combining algorithm such as "deny-overrides".
+// An empty string is MostSpecific.
+func ParseCombiningAlgorithm(s string) (CombiningAlgorithm, error) {
+	if s == "" {
+		return MostSpecific, nil
+	}
+	for a, name := range combiningAlgorithms {
+		if name == s {
+			return CombiningAlgorithm(a), nil
+		}
+	}
+	return MostSpecific, fmt.Errorf("%w: %q", ErrInvalidCombiningAlgorithm, s)
+}
+
+// Rule is a group of a policy which matches a request.
+type Rule struct {
+	Pattern string
+	Params  Params
+	Group   PermissionGroup
+}
+
+// candidates returns the rules the algorithm considers, from rules in order of specificity.
+func (a CombiningAlgorithm) candidates(rules []Rule) []Rule {
+	if a != MostSpecific || len(rules) == 0 {
+		return rules
+	}
+	i := 1
+	for i < len(rules) && rules[i].Pattern == rules[0].Pattern {
+		i++
+	}
+	return rules[:i]
+}
+
+// combine returns the index of the rule which decides the result and the role it applies to,
+// or -1 if no rule applies. applies is called at most once for each rule, in order.
+func (a CombiningAlgorithm) combine(rules []Rule, applies func(Rule) (int64, bool)) (int, int64) {
+	overriding := Deny
+	if a == PermitOverrides {
+		overriding = Allow
+	}
+	decided, roleID := -1, int64(0)
+	for i, rule := range rules {
+		id, ok := applies(rule)
+		if !ok {
+			continue
+		}
+		if a == FirstApplicable || rule.Group.Effect == overriding {
+			return i, id
+		}
+		if decided < 0 {
+			decided, roleID = i, id
+		}
+	}
+	return decided, roleID
+}
+
+// decideMatch decides a request which match refers to.
+// A request is granted if no policy applies to it, and denied if policies apply but none of their rules does.
+func decideMatch(match PolicyMatch, applies func(Rule) (int64, bool)) Decision {
+	if len(match.Rules) == 0 {
+		return Decision{Granted: true, Reason: "no policy applies"}
+	}
+	rules := match.Algorithm.candidates(match.Rules)
+	decision := Decision{Required: true, Algorithm: match.Algorithm, Grantees: grantees(rules)}
+	i, roleID := match.Algorithm.combine(rules, applies)
+	if i < 0 {
+		decision.Reason = "no required role"
+		return decision
+	}
+	rule := rules[i]
+	decision.Pattern, decision.Params = rule.Pattern, rule.Params
+	decision.Effect, decision.RoleID = rule.Group.Effect, roleID
+	decision.Granted = rule.Group.Effect == Allow
+	if decision.Granted {
+		decision.Reason = fmt.Sprintf("role %d is granted by %s", roleID, rule.Pattern)
+	} else {
+		decision.Reason = fmt.Sprintf("role %d is denied by %s", roleID, rule.Pattern)
+	}
+	return decision
+}
+
+// requiredRoles returns roles which match grants if their conditions pass.
+func requiredRoles(match PolicyMatch) []int64 {
+	var roleID []int64
+	for _, id := range grantees(match.Algorithm.candidates(match.Rules)) {
+		decision := decideMatch(match, func(rule Rule) (int64, bool) {
+			applies := containsID(rule.Group.RoleID, id) && (rule.Group.Effect == Allow || len(rule.Group.Conditions) == 0)
+			return id, applies
+		})
+		if decision.Granted {
+			roleID = append(roleID, id)
+		}
+	}
+	return roleID
+}
+
+// decideRoles decides match for roles without evaluating conditions: a group with conditions never grants.
+func decideRoles(match PolicyMatch, roleID []int64) Decision {
+	return decideMatch(match, func(rule Rule) (int64, bool) {
+		if rule.Group.Effect == Allow && len(rule.Group.Conditions) > 0 {
+			return 0, false
+		}
+		for _, id := range roleID {
+			if containsID(rule.Group.RoleID, id) {
+				return id, true
+			}
+		}
+		return 0, false
+	})
+}
+
+// grantees returns roles of allow rules without duplicates.
+func grantees(rules []Rule) []int64 {
+	var roleID []int64
+	for _, rule := range rules {
+		if rule.Group.Effect != Allow {
+			continue
+		}
+		for _, id := range rule.Group.RoleID {
+			if !containsID(roleID, id) {
+				roleID = append(roleID, id)
+			}
+		}
+	}
+	return roleID
+}
@@ -0,0 +1,166 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var denyPolicies = []StandardPolicy{
+	{`/data/**`, []PermissionGroup{
+		{Operation: CR, RoleID: []int64{7, 8}},
+	}},
+	{`/data/secret/**`, []PermissionGroup{
+		{Operation: Read, RoleID: []int64{7}, Effect: Deny},
+	}},
+	{`/data/secret/public`, []PermissionGroup{
+		{Operation: Read, RoleID: []int64{7}},
+	}},
+}
+
+func TestPolicyTree_Deny(t *testing.T) {
+	tests := []struct {
+		algorithm CombiningAlgorithm
+		uri       string
+		roleID    int64
+		granted   bool
+	}{
+		{MostSpecific, `/data/image`, 7, true},
+		{MostSpecific, `/data/secret/key`, 7, false},
+		// the most specific policy hides /data/** from roles it does not list
+		{MostSpecific, `/data/secret/key`, 8, false},
+		{MostSpecific, `/data/secret/public`, 7, true},
+		// role 7 reads /data/** except /data/secret/**, and other roles read all of it
+		{DenyOverrides, `/data/image`, 7, true},
+		{DenyOverrides, `/data/secret/key`, 7, false},
+		{DenyOverrides, `/data/secret/key`, 8, true},
+		{DenyOverrides, `/data/secret/public`, 7, false},
+		{PermitOverrides, `/data/secret/key`, 7, true},
+		{PermitOverrides, `/data/secret/public`, 7, true},
+		{FirstApplicable, `/data/secret/key`, 7, false},
+		{FirstApplicable, `/data/secret/key`, 8, true},
+		{FirstApplicable, `/data/secret/public`, 7, true},
+		{FirstApplicable, `/auth/user`, 7, true},
+	}
+
+	assert := assert.New(t)
+	for _, test := range tests {
+		tree := NewPolicyTree()
+		tree.SetCombiningAlgorithm(test.algorithm)
+		tree.LoadPolicies(denyPolicies)
+		role := StandardRole{test.roleID, `role`, nil, 0}
+		assert.Equal(test.granted, tree.IsGranted(test.uri, Read, &role), `%s %s %d`, test.algorithm, test.uri, test.roleID)
+	}
+}
+
+func TestPolicyTree_Decide(t *testing.T) {
+	tree := NewPolicyTree()
+	tree.SetCombiningAlgorithm(DenyOverrides)
+	tree.LoadPolicies(denyPolicies)
+
+	assert := assert.New(t)
+	decision := tree.Decide(`/data/secret/key`, Read, []int64{8, 7})
+	assert.False(decision.Granted)
+	assert.True(decision.Required)
+	assert.Equal(DenyOverrides, decision.Algorithm)
+	assert.Equal(`/data/secret/**`, decision.Pattern)
+	assert.Equal(Deny, decision.Effect)
+	assert.Equal(int64(7), decision.RoleID)
+	assert.Equal([]int64{7, 8}, decision.Grantees)
+	assert.Equal(`role 7 is denied by /data/secret/**`, decision.Reason)
+
+	decision = tree.Decide(`/data/image`, Create, []int64{8})
+	assert.True(decision.Granted)
+	assert.Equal(`/data/**`, decision.Pattern)
+	assert.Equal(`role 8 is granted by /data/**`, decision.Reason)
+
+	decision = tree.Decide(`/data/image`, Read, []int64{9})
+	assert.False(decision.Granted)
+	assert.Equal(``, decision.Pattern)
+	assert.Equal(`no required role`, decision.Reason)
+
+	decision = tree.Decide(`/auth/user`, Read, nil)
+	assert.True(decision.Granted)
+	assert.False(decision.Required)
+
+	roleID, required := tree.Require(`/data/secret/key`, Read)
+	assert.True(required)
+	assert.Equal([]int64{8}, roleID)
+	roleID, required = tree.Require(`/data/secret/key`, Create)
+	assert.True(required)
+	assert.Equal([]int64{7, 8}, roleID)
+}
+
+func TestAccessControl_AuthorizeDeny(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/orders/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{2}},
+		}},
+		{`/orders/:id`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{2}, Effect: Deny, Conditions: []string{`archived`}},
+		}},
+	}
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	ac.Conditions = NewConditions()
+	ac.Conditions.Register(`archived`, ParamEquals(`id`, `archive`))
+	ac.Policies.(*PolicyTree).SetCombiningAlgorithm(DenyOverrides)
+
+	assert := assert.New(t)
+	authorize := func(uri string, sub Subject) Decision {
+		return ac.Authorize(context.Background(), &Request{URI: uri, Operation: Read, Subject: sub})
+	}
+	assert.True(authorize(`/orders/1`, Subject{RoleID: []int64{2}}).Granted)
+	decision := authorize(`/orders/1`, Subject{RoleID: []int64{2}, Attributes: map[string]interface{}{`archive`: `1`}})
+	assert.False(decision.Granted)
+	assert.Equal(`/orders/:id`, decision.Pattern)
+	assert.Equal([]ConditionResult{{Name: `archived`, Passed: true}}, decision.Conditions)
+
+	// Conditions can not be evaluated without a request, so a conditional deny always applies.
+	role := StandardRole{2, `user`, nil, 0}
+	assert.False(ac.Policies.IsGranted(`/orders/1`, Read, &role))
+}
+
+func TestPermission_Deny(t *testing.T) {
+	permissions := []StandardPermission{
+		{URI: `/data/**`, Operation: CRUD},
+		{URI: `/data/secret/**`, Operation: RU, Effect: Deny},
+		{URI: `/data/secret/public`, Operation: Read},
+	}
+	list := NewPermissionList()
+	list.Load(permissions)
+	tree := NewPermissionTree()
+	tree.Load(permissions)
+
+	assert := assert.New(t)
+	for _, p := range []Permissions{list, tree} {
+		assert.True(p.HasPermission(`/data/image`, Read))
+		assert.False(p.HasPermission(`/data/secret/key`, Read))
+		assert.False(p.HasPermission(`/data/secret/key`, CR))
+		assert.True(p.HasPermission(`/data/secret/key`, Create))
+	}
+	assert.False(list.HasPermission(`/data/secret/public`, Read))
+	assert.True(tree.HasPermission(`/data/secret/public`, Read))
+	assert.Equal(`deny /data/secret/** read|update`, permissions[1].String())
+}
+
+func TestParseCombiningAlgorithm(t *testing.T) {
+	assert := assert.New(t)
+	for _, algorithm := range []CombiningAlgorithm{MostSpecific, DenyOverrides, PermitOverrides, FirstApplicable} {
+		parsed, err := ParseCombiningAlgorithm(algorithm.String())
+		assert.Nil(err)
+		assert.Equal(algorithm, parsed)
+	}
+	_, err := ParseCombiningAlgorithm(`deny-unless-permit`)
+	assert.ErrorIs(err, ErrInvalidCombiningAlgorithm)
+
+	effect, err := ParseEffect(`deny`)
+	assert.Nil(err)
+	assert.Equal(Deny, effect)
+	effect, err = ParseEffect(``)
+	assert.Nil(err)
+	assert.Equal(Allow, effect)
+	_, err = ParseEffect(`forbid`)
+	assert.ErrorIs(err, ErrInvalidEffect)
+}
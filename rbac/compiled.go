@@ -0,0 +1,390 @@
+package rbac
+
+import (
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// maxDepth is the number of segments of a URI which are split and searched without allocating.
+const maxDepth = 16
+
+// CompiledPolicies are policies compiled into an immutable radix tree, which is rebuilt as a whole by
+// LoadPolicies and swapped in atomically. It decides exactly like a PolicyTree of the same policies,
+// but finds the static edge of a segment by a binary search over sorted edges instead of scanning children,
+// and splits URIs without allocating.
+//
+// Lookups are not allocation-free in general. Only these do not allocate:
+//   - a request of a URI no policy matches;
+//   - Require and IsGranted of a single operation under MostSpecific, whose results are kept by the policy
+//     which decides them. They are recomputed when roles of the hierarchy change, if the roles report it
+//     by Generation.
+//
+// Lookup and Decide, and Require and IsGranted of several operations or under other algorithms,
+// allocate the rules they find and the parameters those capture.
+type CompiledPolicies struct {
+	root      atomic.Pointer[compiledNode]
+	hierarchy *hierarchy
+	algorithm CombiningAlgorithm
+
+	// hierarchySet tells whether SetHierarchy is called, even with NoInheritance.
+	hierarchySet bool
+}
+
+type compiledNode struct {
+	seg    segment
+	uri    string
+	groups []PermissionGroup
+
+	// statics are sorted by their paths. The other kinds of edges are kept in the order they were added,
+	// which is the order they are tried in.
+	statics  []*compiledNode
+	regexps  []*compiledNode
+	params   []*compiledNode
+	wildcard *compiledNode
+	deep     *compiledNode
+
+	// children are all edges in the order they were added.
+	children []*compiledNode
+
+	// memo keeps results of single operations by their bits, for nodes with policies.
+	memo []atomic.Pointer[compiledMemo]
+}
+
+// compiledMemo is what a policy decides for a single operation under MostSpecific.
+type compiledMemo struct {
+	generation uint64
+	required   []int64
+	granted    []int64
+}
+
+// CompilePolicies compiles policies. Like PolicyTree, a policy overwrites an earlier one of the same URI.
+func CompilePolicies(policies []StandardPolicy) *CompiledPolicies {
+	c := &CompiledPolicies{}
+	c.LoadPolicies(policies)
+	return c
+}
+
+// SetHierarchy makes the policies grant permissions along the hierarchy of roles, like PolicyTree.SetHierarchy.
+func (c *CompiledPolicies) SetHierarchy(roles Roles, inheritance Inheritance) error {
+	h, err := newHierarchy(roles, inheritance, ChildInherits)
+	if err != nil {
+		return err
+	}
+	c.hierarchy, c.hierarchySet = h, true
+	c.root.Store(c.load().rebuild())
+	return nil
+}
+
+// HasHierarchy shows whether SetHierarchy decides how the policies grant permissions along the hierarchy of roles.
+func (c *CompiledPolicies) HasHierarchy() bool {
+	return c.hierarchySet
+}
+
+// SetCombiningAlgorithm sets how rules of policies matching a request are combined. The default is MostSpecific.
+func (c *CompiledPolicies) SetCombiningAlgorithm(algorithm CombiningAlgorithm) {
+	c.algorithm = algorithm
+}
+
+// CombiningAlgorithm returns how rules of policies matching a request are combined.
+func (c *CompiledPolicies) CombiningAlgorithm() CombiningAlgorithm {
+	return c.algorithm
+}
+
+func (c *CompiledPolicies) LoadPolicies(policies []StandardPolicy) {
+	tree := NewPolicyTree()
+	tree.LoadPolicies(policies)
+	c.root.Store(compileNode(tree))
+}
+
+// Policies returns all policies, parents before their children.
+func (c *CompiledPolicies) Policies() []StandardPolicy {
+	var policies []StandardPolicy
+	c.load().walk(func(node *compiledNode) {
+		if node.uri != "" {
+			policies = append(policies, StandardPolicy{URI: node.uri, Groups: node.groups})
+		}
+	})
+	return policies
+}
+
+func (c *CompiledPolicies) Destroy() {
+	c.root.Store(&compiledNode{})
+}
+
+// Require returns roles which are granted op by policies of uri if their conditions pass, like PolicyTree.Require.
+func (c *CompiledPolicies) Require(uri string, op Operation) ([]int64, bool) {
+	if memo, ok := c.memo(uri, op); ok {
+		if memo == nil {
+			return nil, false
+		}
+		return memo.required, true
+	}
+	roleID, _, required := c.RequireParams(uri, op)
+	return roleID, required
+}
+
+// RequireParams is like Require and returns parameters captured by the most specific policy.
+func (c *CompiledPolicies) RequireParams(uri string, op Operation) ([]int64, Params, bool) {
+	match, required := c.Lookup(uri, op)
+	if !required {
+		return nil, nil, false
+	}
+	return requiredRoles(match), match.Rules[0].Params, true
+}
+
+// Lookup finds every policy of uri which has rules for op, from the most specific one, like PolicyTree.Lookup.
+// It allocates the rules it returns, and the parameters captured by their patterns.
+func (c *CompiledPolicies) Lookup(uri string, op Operation) (PolicyMatch, bool) {
+	var buf [maxDepth]string
+	paths := splitURI(uri, buf[:0])
+	if len(paths) == 0 {
+		return PolicyMatch{}, false
+	}
+	match := PolicyMatch{Algorithm: c.algorithm}
+	// Parameters are captured into a new slice, since a buffer would escape through the visitor.
+	var visitedBuf [maxDepth]*compiledNode
+	visited := visitedBuf[:0]
+	c.load().search(paths, nil, true, func(node *compiledNode, matched Params) bool {
+		for _, v := range visited {
+			if v == node {
+				return false
+			}
+		}
+		visited = append(visited, node)
+		for _, group := range node.groups {
+			if group.include(op) && len(group.RoleID) > 0 {
+				group.RoleID = c.hierarchy.groupRoles(group)
+				match.Rules = append(match.Rules, Rule{Pattern: node.uri, Params: append(Params(nil), matched...), Group: group})
+			}
+		}
+		return false
+	})
+	return match, len(match.Rules) > 0
+}
+
+// Decide decides whether one of roles can operate a resource, like PolicyTree.Decide.
+func (c *CompiledPolicies) Decide(uri string, op Operation, roleID []int64) Decision {
+	match, _ := c.Lookup(uri, op)
+	return decideRoles(match, roleID)
+}
+
+func (c *CompiledPolicies) IsGranted(uri string, op Operation, role Role) bool {
+	if memo, ok := c.memo(uri, op); ok {
+		return memo == nil || containsID(memo.granted, role.ID())
+	}
+	return c.Decide(uri, op, []int64{role.ID()}).Granted
+}
+
+// memo returns what the most specific policy of uri decides for op, or nil if no policy has rules for op.
+// It returns false if the decision can not be kept, because op is not a single operation,
+// the algorithm is not MostSpecific, or roles of the hierarchy do not report their generation.
+func (c *CompiledPolicies) memo(uri string, op Operation) (*compiledMemo, bool) {
+	if c.algorithm != MostSpecific || op == Nil || op&(op-1) != 0 {
+		return nil, false
+	}
+	var generation uint64
+	if c.hierarchy != nil {
+		g, ok := c.hierarchy.roles.(interface{ Generation() uint64 })
+		if !ok {
+			return nil, false
+		}
+		generation = g.Generation()
+	}
+
+	var (
+		buf   [maxDepth]string
+		found *compiledNode
+	)
+	paths := splitURI(uri, buf[:0])
+	if len(paths) == 0 {
+		return nil, true
+	}
+	c.load().search(paths, nil, false, func(node *compiledNode, _ Params) bool {
+		for _, group := range node.groups {
+			if group.include(op) && len(group.RoleID) > 0 {
+				found = node
+				return true
+			}
+		}
+		return false
+	})
+	if found == nil {
+		return nil, true
+	}
+
+	slot := &found.memo[bitIndex(op)]
+	if memo := slot.Load(); memo != nil && memo.generation == generation {
+		return memo, true
+	}
+	match := PolicyMatch{Algorithm: MostSpecific}
+	for _, group := range found.groups {
+		if group.include(op) && len(group.RoleID) > 0 {
+			group.RoleID = c.hierarchy.groupRoles(group)
+			match.Rules = append(match.Rules, Rule{Pattern: found.uri, Group: group})
+		}
+	}
+	memo := &compiledMemo{generation: generation, required: requiredRoles(match)}
+	for _, id := range grantees(match.Rules) {
+		if decideRoles(match, []int64{id}).Granted {
+			memo.granted = append(memo.granted, id)
+		}
+	}
+	slot.Store(memo)
+	return memo, true
+}
+
+func (c *CompiledPolicies) load() *compiledNode {
+	if root := c.root.Load(); root != nil {
+		return root
+	}
+	c.root.CompareAndSwap(nil, &compiledNode{})
+	return c.root.Load()
+}
+
+// compileNode compiles a node of a PolicyTree and its children.
+func compileNode(t *PolicyTree) *compiledNode {
+	n := &compiledNode{seg: t.seg, uri: t.uri, groups: t.groups}
+	if len(t.groups) > 0 {
+		n.memo = make([]atomic.Pointer[compiledMemo], 32)
+	}
+	for _, child := range t.children {
+		n.add(compileNode(child))
+	}
+	n.sort()
+	return n
+}
+
+// add adds an edge to a node which is being compiled.
+func (n *compiledNode) add(child *compiledNode) {
+	n.children = append(n.children, child)
+	switch child.seg.kind {
+	case staticSegment:
+		n.statics = append(n.statics, child)
+	case regexpSegment:
+		n.regexps = append(n.regexps, child)
+	case paramSegment:
+		n.params = append(n.params, child)
+	case wildcardSegment:
+		n.wildcard = child
+	case deepSegment:
+		n.deep = child
+	}
+}
+
+func (n *compiledNode) sort() {
+	sort.Slice(n.statics, func(i, j int) bool { return n.statics[i].seg.path < n.statics[j].seg.path })
+}
+
+// rebuild copies the tree with empty memos, for a new hierarchy.
+func (n *compiledNode) rebuild() *compiledNode {
+	copied := &compiledNode{seg: n.seg, uri: n.uri, groups: n.groups}
+	if n.memo != nil {
+		copied.memo = make([]atomic.Pointer[compiledMemo], 32)
+	}
+	for _, child := range n.children {
+		copied.add(child.rebuild())
+	}
+	copied.sort()
+	return copied
+}
+
+// static returns the static edge of path.
+func (n *compiledNode) static(path string) *compiledNode {
+	lo, hi := 0, len(n.statics)
+	for lo < hi {
+		mid := int(uint(lo+hi) >> 1)
+		if n.statics[mid].seg.path < path {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo < len(n.statics) && n.statics[lo].seg.path == path {
+		return n.statics[lo]
+	}
+	return nil
+}
+
+// search calls visit for every node below n which matches paths entirely, in the order of searchTree,
+// until visit returns true. It shows whether visit has returned true.
+// Parameters are only captured if capture is true, otherwise visit receives none.
+func (n *compiledNode) search(paths []string, params Params, capture bool, visit func(*compiledNode, Params) bool) bool {
+	if len(paths) == 0 {
+		return visit(n, params)
+	}
+	return n.searchChildren(paths, params, capture, visit)
+}
+
+func (n *compiledNode) searchChildren(paths []string, params Params, capture bool, visit func(*compiledNode, Params) bool) bool {
+	path := paths[0]
+	if child := n.static(path); child != nil && child.search(paths[1:], params, capture, visit) {
+		return true
+	}
+	for _, child := range n.regexps {
+		if child.seg.match(path) && child.search(paths[1:], child.capture(params, path, capture), capture, visit) {
+			return true
+		}
+	}
+	for _, child := range n.params {
+		if child.search(paths[1:], child.capture(params, path, capture), capture, visit) {
+			return true
+		}
+	}
+	if child := n.wildcard; child != nil && child.search(paths[1:], params, capture, visit) {
+		return true
+	}
+	if child := n.deep; child != nil {
+		// Try the rest of the pattern after "**" consumed k segments, then "**" as the end of it.
+		for k := 0; k < len(paths); k++ {
+			if child.searchChildren(paths[k:], params, capture, visit) {
+				return true
+			}
+		}
+		if visit(child, params) {
+			return true
+		}
+	}
+	return false
+}
+
+func (n *compiledNode) capture(params Params, path string, capture bool) Params {
+	if !capture {
+		return params
+	}
+	return n.seg.param(params, path)
+}
+
+func (n *compiledNode) walk(f func(*compiledNode)) {
+	f(n)
+	for _, child := range n.children {
+		child.walk(f)
+	}
+}
+
+// splitURI appends segments of uri to paths like handleURI, without allocating if paths has room for them.
+func splitURI(uri string, paths []string) []string {
+	uri = strings.TrimPrefix(uri, "/")
+	if uri == "" {
+		return paths
+	}
+	uri = strings.TrimSuffix(uri, "/")
+	for {
+		i := strings.IndexByte(uri, '/')
+		if i < 0 {
+			return append(paths, uri)
+		}
+		paths = append(paths, uri[:i])
+		uri = uri[i+1:]
+	}
+}
+
+// bitIndex returns the index of the bit of a single operation.
+func bitIndex(op Operation) int {
+	i := 0
+	for op > 1 {
+		op >>= 1
+		i++
+	}
+	return i
+}
@@ -0,0 +1,230 @@
+package rbac
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// comparedPolicies gather policies of the tests of PolicyTree, with every kind of segment.
+var comparedPolicies = []StandardPolicy{
+	{`/data/**`, []PermissionGroup{
+		{Operation: CR, RoleID: []int64{1, 2, 3}},
+		{Operation: Read, RoleID: []int64{9, 10}},
+		{Operation: Delete, RoleID: []int64{2}, Effect: Deny},
+	}},
+	{`/data`, []PermissionGroup{{Operation: CRUD, RoleID: []int64{4, 7}}}},
+	{`/auth/`, []PermissionGroup{{Operation: Read, RoleID: []int64{2, 4, 5}}}},
+	{`/auth/user/*`, []PermissionGroup{{Operation: CRUD, RoleID: []int64{5}}}},
+	{`/data/:id`, []PermissionGroup{
+		{Operation: RU, RoleID: []int64{3}},
+		{Operation: Update, RoleID: []int64{1}, Conditions: []string{`owner`}},
+	}},
+	{`/data/{id:[0-9]+}`, []PermissionGroup{{Operation: Read, RoleID: []int64{6}}}},
+	{`/data/{name}/files/**/raw`, []PermissionGroup{{Operation: Read, RoleID: []int64{8}}}},
+	{`/data/admin`, []PermissionGroup{
+		{Operation: CRUD, RoleID: []int64{1}},
+		{Operation: Read, RoleID: []int64{3}, Effect: Deny},
+	}},
+	{`/orders/:id/items/:item`, []PermissionGroup{{Operation: Read, RoleID: []int64{3}}}},
+	{`/orders/**/items`, []PermissionGroup{{Operation: Read, RoleID: []int64{4}}}},
+	{`/**/public`, []PermissionGroup{{Operation: Read, RoleID: []int64{7}}}},
+	{`/orders/{n:[a-z]+}`, []PermissionGroup{{Operation: Create, RoleID: []int64{2}}}},
+	{`/orders/:id`, []PermissionGroup{{Operation: Nil, RoleID: []int64{2}}}},
+	{`/broken/{x:[}`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}},
+	{`/data/admin`, []PermissionGroup{{Operation: CRUD, RoleID: []int64{1}}}},
+}
+
+var comparedURIs = []string{
+	``, `/`, `//`, `/data`, `/data/`, `data`, `/data/image`, `/data/1`, `/data/12/`, `/data/admin`, `/data/admin/x`,
+	`/data/a/files/raw`, `/data/a/files/x/y/raw`, `/data/a/files/raw/`, `/data//raw`, `/auth`, `/auth/user`,
+	`/auth/user/1`, `/auth/user/1/2`, `/orders/1/items/2`, `/orders/1/x/items`, `/orders/items`, `/orders/abc`,
+	`/orders/1`, `/x/y/public`, `/public`, `/broken/a`, `/a//b`,
+}
+
+// compare checks that policies decide every request like a PolicyTree of the same policies.
+func compare(t *testing.T, tree *PolicyTree, compiled *CompiledPolicies, uris []string) {
+	assert := assert.New(t)
+	for _, uri := range uris {
+		for _, op := range []Operation{Nil, Create, Read, Update, Delete, CR, CRUD} {
+			name := fmt.Sprintf(`%s %s`, op, uri)
+			expected, expectedOK := tree.Lookup(uri, op)
+			match, ok := compiled.Lookup(uri, op)
+			assert.Equal(expectedOK, ok, name)
+			assert.Equal(expected, match, name)
+
+			roleID, params, required := tree.RequireParams(uri, op)
+			compiledRoleID, compiledParams, compiledRequired := compiled.RequireParams(uri, op)
+			assert.Equal(roleID, compiledRoleID, name)
+			assert.Equal(params, compiledParams, name)
+			assert.Equal(required, compiledRequired, name)
+
+			compiledRoleID, compiledRequired = compiled.Require(uri, op)
+			assert.Equal(roleID, compiledRoleID, name)
+			assert.Equal(required, compiledRequired, name)
+
+			for _, id := range []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 11} {
+				role := &StandardRole{Id: id}
+				assert.Equal(tree.IsGranted(uri, op, role), compiled.IsGranted(uri, op, role), name, id)
+			}
+			assert.Equal(tree.Decide(uri, op, []int64{3, 2}), compiled.Decide(uri, op, []int64{3, 2}), name)
+		}
+	}
+}
+
+func TestCompiledPolicies(t *testing.T) {
+	roles := NewRoleManager()
+	for _, role := range []*StandardRole{{Id: 1}, {Id: 2, ParentId: 1}, {Id: 3, ParentId: 2}, {Id: 5, ParentId: 3}} {
+		roles.SetRole(role)
+	}
+
+	for _, algorithm := range []CombiningAlgorithm{MostSpecific, DenyOverrides, PermitOverrides, FirstApplicable} {
+		for _, inheritance := range []Inheritance{NoInheritance, ParentInherits, ChildInherits} {
+			t.Run(fmt.Sprintf(`%s/%d`, algorithm, inheritance), func(t *testing.T) {
+				tree := NewPolicyTree()
+				tree.SetHierarchy(roles, inheritance)
+				tree.SetCombiningAlgorithm(algorithm)
+				tree.LoadPolicies(comparedPolicies)
+				compiled := CompilePolicies(comparedPolicies)
+				compiled.SetHierarchy(roles, inheritance)
+				compiled.SetCombiningAlgorithm(algorithm)
+
+				compare(t, tree, compiled, comparedURIs)
+				assert.Equal(t, tree.Policies(), compiled.Policies())
+			})
+		}
+	}
+}
+
+func TestCompiledPolicies_Memo(t *testing.T) {
+	roles := NewRoleManager()
+	roles.SetRole(&StandardRole{Id: 1})
+	roles.SetRole(&StandardRole{Id: 2})
+	compiled := CompilePolicies([]StandardPolicy{{`/data/:id`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}}})
+	compiled.SetHierarchy(roles, ParentInherits)
+
+	assert := assert.New(t)
+	assert.False(compiled.IsGranted(`/data/1`, Read, roles.GetRole(1)))
+	roles.SetRole(&StandardRole{Id: 2, ParentId: 1})
+	assert.True(compiled.IsGranted(`/data/1`, Read, roles.GetRole(1)))
+	roleID, _ := compiled.Require(`/data/2`, Read)
+	assert.Equal([]int64{2, 1}, roleID)
+
+	compiled.LoadPolicies(nil)
+	_, required := compiled.Require(`/data/1`, Read)
+	assert.False(required)
+	assert.True(compiled.IsGranted(`/data/1`, Read, roles.GetRole(1)))
+
+	compiled.Destroy()
+	assert.Empty(compiled.Policies())
+}
+
+func TestCompiledPolicies_AccessControl(t *testing.T) {
+	manager := NewPolicyManager(func() Policies { return CompilePolicies(nil) })
+	manager.LoadPolicies(comparedPolicies)
+	ac := NewAccessControl(manager, NewRoleManager())
+
+	assert := assert.New(t)
+	assert.True(ac.IsSubjectGranted(`/data/1`, Update, Subject{RoleID: []int64{3}}))
+	assert.False(ac.IsSubjectGranted(`/data/admin`, Read, Subject{RoleID: []int64{3}}))
+	assert.True(ac.IsSubjectGranted(`/x/public`, Read, Subject{RoleID: []int64{7}}))
+}
+
+func TestSplitURI(t *testing.T) {
+	assert := assert.New(t)
+	for _, uri := range append(comparedURIs, `a/`, `/a/b/`, `///`, `/a/b/c/d/e/f/g/h/i/j/k/l/m/n/o/p/q/r/s`) {
+		expected := handleURI(uri)
+		if len(expected) == 0 {
+			expected = nil
+		}
+		assert.Equal(expected, splitURI(uri, nil), uri)
+	}
+}
+
+func FuzzCompiledPolicies(f *testing.F) {
+	for _, uri := range comparedURIs {
+		f.Add(uri, ``)
+	}
+	f.Add(`/a/b/c`, `/a/:x/**`)
+	f.Add(`/a/1`, `/a/{n:[0-9]+}`)
+	f.Add(`/a/b`, `/**/b`)
+	f.Fuzz(func(t *testing.T, uri, pattern string) {
+		policies := comparedPolicies
+		if pattern != "" {
+			policies = append(append([]StandardPolicy(nil), comparedPolicies...),
+				StandardPolicy{pattern, []PermissionGroup{{Operation: RU, RoleID: []int64{11}}}})
+		}
+		tree := NewPolicyTree()
+		tree.LoadPolicies(policies)
+		compare(t, tree, CompilePolicies(policies), []string{uri})
+	})
+}
+
+func TestCompiledPolicies_Allocs(t *testing.T) {
+	c := CompilePolicies(generatePolicies(100))
+	role := &StandardRole{Id: 1}
+	c.Require(`/resources1/1`, Read)
+
+	assert := assert.New(t)
+	assert.Zero(testing.AllocsPerRun(100, func() { c.Require(`/resources1/1`, Read) }))
+	assert.Zero(testing.AllocsPerRun(100, func() { c.IsGranted(`/resources1/1`, Read, role) }))
+	assert.Zero(testing.AllocsPerRun(100, func() { c.Lookup(`/nothing/here`, Read) }))
+	assert.Zero(testing.AllocsPerRun(100, func() { c.Require(`/nothing/here`, CR) }))
+	// matching rules are allocated outside of the memo
+	assert.NotZero(testing.AllocsPerRun(100, func() { c.Lookup(`/resources1/1`, Read) }))
+	assert.NotZero(testing.AllocsPerRun(100, func() { c.Require(`/resources1/1`, CR) }))
+}
+
+func benchmarkCompiled(b *testing.B, f func(Policies, int)) {
+	for _, n := range []int{100, 10000} {
+		policies := generatePolicies(n)
+		tree := NewPolicyTree()
+		tree.LoadPolicies(policies)
+		for _, p := range []struct {
+			name     string
+			policies Policies
+		}{
+			{`tree`, tree},
+			{`compiled`, CompilePolicies(policies)},
+		} {
+			b.Run(fmt.Sprintf(`%s/%d`, p.name, n), func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					f(p.policies, i%n)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkCompiledPolicies_Require(b *testing.B) {
+	uris := make([]string, 10000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d/fields/name`, i, i)
+	}
+	benchmarkCompiled(b, func(policies Policies, i int) {
+		policies.Require(uris[i], Update)
+	})
+}
+
+func BenchmarkCompiledPolicies_IsGranted(b *testing.B) {
+	uris := make([]string, 10000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d`, i, i)
+	}
+	role := &StandardRole{Id: 1}
+	benchmarkCompiled(b, func(policies Policies, i int) {
+		policies.IsGranted(uris[i], Read, role)
+	})
+}
+
+func BenchmarkCompiledPolicies_Lookup(b *testing.B) {
+	uris := make([]string, 10000)
+	for i := range uris {
+		uris[i] = fmt.Sprintf(`/resources%d/%d`, i, i)
+	}
+	benchmarkCompiled(b, func(policies Policies, i int) {
+		policies.(PolicyLookup).Lookup(uris[i], Read)
+	})
+}
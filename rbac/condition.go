@@ -0,0 +1,270 @@
+package rbac
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Condition decides whether a request satisfies an attribute based rule.
+// An error fails the condition.
+type Condition func(req *Request) (bool, error)
+
+// Conditions is a registry of named conditions, which are referred by PermissionGroup.Conditions.
+type Conditions struct {
+	mu         sync.RWMutex
+	conditions map[string]Condition
+}
+
+func NewConditions() *Conditions {
+	return &Conditions{conditions: make(map[string]Condition)}
+}
+
+// Register registers a condition under name, replacing the one registered before.
+func (c *Conditions) Register(name string, condition Condition) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conditions[name] = condition
+}
+
+func (c *Conditions) Lookup(name string) (Condition, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	condition, ok := c.conditions[name]
+	return condition, ok
+}
+
+// ResourceResolver returns attributes of the resource a request refers to,
+// for example the owner of the order "/orders/:id" refers to.
+type ResourceResolver func(uri string, params Params) (map[string]interface{}, error)
+
+// Environment holds values of a request which belong to neither the subject nor the resource.
+type Environment struct {
+	Time   time.Time
+	IP     net.IP
+	Values map[string]interface{}
+}
+
+// Request is everything known about an access when conditions are evaluated.
+type Request struct {
+	URI       string
+	Operation Operation
+	Subject   Subject
+	Env       Environment
+
+	// Params are parameters captured by the policy which is evaluated. They are set during authorization.
+	Params Params
+
+	resolver ResourceResolver
+	resolved bool
+	resource map[string]interface{}
+	err      error
+}
+
+// setParams sets parameters of the policy which is evaluated.
+// The resource is resolved again if they change.
+func (r *Request) setParams(params Params) {
+	if paramsEqual(r.Params, params) {
+		return
+	}
+	r.Params = params
+	r.resolved, r.resource, r.err = false, nil, nil
+}
+
+func paramsEqual(a, b Params) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Resource returns attributes of the requested resource. They are resolved once, on first use.
+func (r *Request) Resource() (map[string]interface{}, error) {
+	if !r.resolved {
+		r.resolved = true
+		if r.resolver != nil {
+			r.resource, r.err = r.resolver(r.URI, r.Params)
+		}
+	}
+	return r.resource, r.err
+}
+
+// ConditionResult is the result of a condition evaluated for a decision.
+type ConditionResult struct {
+	Name   string
+	Passed bool
+	Err    error
+}
+
+// Decision explains the result of an authorization.
+type Decision struct {
+	Granted bool
+
+	// Required is false if no policy applies to the request, in which case it is granted.
+	Required bool
+
+	// Algorithm is the combining algorithm which decides the request.
+	Algorithm CombiningAlgorithm
+
+	// Pattern is the URI pattern of the policy whose rule decides the request,
+	// and Effect is the effect of the rule. They are empty if no rule applies.
+	Pattern string
+	Params  Params
+	Effect  Effect
+
+	// Grantees are the roles allow rules grant the operation to, before conditions are evaluated.
+	Grantees []int64
+
+	// RoleID is the role of the subject the deciding rule applies to.
+	RoleID int64
+
+	// Conditions are the results of all evaluated conditions, in order.
+	Conditions []ConditionResult
+
+	// Tuple is the relationship which grants the request in Check, if policies do not.
+	Tuple *Tuple
+
+	Reason string
+}
+
+// FailedCondition returns the name of the first condition which failed.
+func (d *Decision) FailedCondition() (string, bool) {
+	for _, result := range d.Conditions {
+		if !result.Passed {
+			return result.Name, true
+		}
+	}
+	return "", false
+}
+
+// AttributeEquals returns a Condition which requires the attribute resourceKey of the resource
+// to equal the attribute subjectKey of the subject.
+func AttributeEquals(resourceKey, subjectKey string) Condition {
+	return func(req *Request) (bool, error) {
+		resource, err := req.Resource()
+		if err != nil {
+			return false, err
+		}
+		value, ok := resource[resourceKey]
+		if !ok {
+			return false, nil
+		}
+		return req.Subject.attributeEquals(subjectKey, value), nil
+	}
+}
+
+// Owner returns a Condition which requires the attribute key of the resource to be the id of the user.
+func Owner(key string) Condition {
+	return AttributeEquals(key, "user_id")
+}
+
+// ParamEquals returns a Condition which requires the path parameter param
+// to equal the attribute subjectKey of the subject, like ":id" of "/users/:id".
+func ParamEquals(param, subjectKey string) Condition {
+	return func(req *Request) (bool, error) {
+		value, ok := req.Params.Get(param)
+		if !ok {
+			return false, nil
+		}
+		return req.Subject.attributeEquals(subjectKey, value), nil
+	}
+}
+
+// TimeBetween returns a Condition which requires the time of a request to be between
+// start and end of a day, written as "15:04", in loc. The time of day is compared by minute.
+func TimeBetween(start, end string, loc *time.Location) (Condition, error) {
+	from, err := time.Parse("15:04", start)
+	if err != nil {
+		return nil, fmt.Errorf("RBAC: invalid start time %q", start)
+	}
+	to, err := time.Parse("15:04", end)
+	if err != nil {
+		return nil, fmt.Errorf("RBAC: invalid end time %q", end)
+	}
+	if loc == nil {
+		loc = time.UTC
+	}
+	begin, finish := from.Hour()*60+from.Minute(), to.Hour()*60+to.Minute()
+	return func(req *Request) (bool, error) {
+		t := req.Env.Time
+		if t.IsZero() {
+			t = time.Now()
+		}
+		t = t.In(loc)
+		minute := t.Hour()*60 + t.Minute()
+		if begin <= finish {
+			return begin <= minute && minute < finish, nil
+		}
+		// The range passes midnight.
+		return minute >= begin || minute < finish, nil
+	}, nil
+}
+
+// IPIn returns a Condition which requires the ip address of a request to be in one of networks,
+// written in CIDR notation.
+func IPIn(cidrs ...string) (Condition, error) {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("RBAC: invalid network %q", cidr)
+		}
+		networks = append(networks, network)
+	}
+	return func(req *Request) (bool, error) {
+		if req.Env.IP == nil {
+			return false, nil
+		}
+		for _, network := range networks {
+			if network.Contains(req.Env.IP) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}, nil
+}
+
+// All returns a Condition which requires every condition to pass.
+func All(conditions ...Condition) Condition {
+	return func(req *Request) (bool, error) {
+		for _, condition := range conditions {
+			if ok, err := condition(req); !ok || err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+}
+
+// Any returns a Condition which requires one of conditions to pass.
+func Any(conditions ...Condition) Condition {
+	return func(req *Request) (bool, error) {
+		for _, condition := range conditions {
+			ok, err := condition(req)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// Not returns a Condition which passes when condition does not.
+func Not(condition Condition) Condition {
+	return func(req *Request) (bool, error) {
+		ok, err := condition(req)
+		return !ok && err == nil, err
+	}
+}
@@ -0,0 +1,197 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newConditionAccessControl(t *testing.T) *AccessControl {
+	policies := []StandardPolicy{
+		{`/orders/:id`, []PermissionGroup{
+			{Operation: Read | Update, RoleID: []int64{2}, Conditions: []string{`owner`}},
+			{Operation: Read | Update, RoleID: []int64{1}},
+		}},
+		{`/users/:id`, []PermissionGroup{
+			{Operation: Update, RoleID: []int64{2}, Conditions: []string{`self`}},
+		}},
+		{`/reports/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{2}, Conditions: []string{`business_hours`, `office`}},
+		}},
+		{`/secrets`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{2}, Conditions: []string{`unknown`}},
+		}},
+	}
+	businessHours, err := TimeBetween(`09:00`, `18:00`, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	office, err := IPIn(`10.0.0.0/8`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	ac.Conditions = NewConditions()
+	ac.Conditions.Register(`owner`, Owner(`owner`))
+	ac.Conditions.Register(`self`, ParamEquals(`id`, `user_id`))
+	ac.Conditions.Register(`business_hours`, businessHours)
+	ac.Conditions.Register(`office`, office)
+	ac.ResourceResolver = func(uri string, params Params) (map[string]interface{}, error) {
+		id, _ := params.Get(`id`)
+		switch id {
+		case `1`:
+			return map[string]interface{}{`owner`: `alice`}, nil
+		case `2`:
+			return map[string]interface{}{`owner`: `bob`}, nil
+		}
+		return nil, errors.New(`order not found`)
+	}
+	return ac
+}
+
+func TestAccessControl_Authorize(t *testing.T) {
+	ac := newConditionAccessControl(t)
+	alice := Subject{UserID: `alice`, RoleID: []int64{2}}
+	noon := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)
+	office, home := net.ParseIP(`10.1.2.3`), net.ParseIP(`192.168.1.2`)
+
+	tests := []struct {
+		uri       string
+		op        Operation
+		sub       Subject
+		env       Environment
+		granted   bool
+		condition string
+	}{
+		{`/orders/1`, Update, alice, Environment{}, true, ``},
+		{`/orders/2`, Update, alice, Environment{}, false, `owner`},
+		{`/orders/3`, Update, alice, Environment{}, false, `owner`},
+		{`/orders/2`, Update, Subject{RoleID: []int64{1}}, Environment{}, true, ``},
+		{`/users/alice`, Update, alice, Environment{}, true, ``},
+		{`/users/bob`, Update, alice, Environment{}, false, `self`},
+		{`/reports/2020`, Read, alice, Environment{Time: noon, IP: office}, true, ``},
+		{`/reports/2020`, Read, alice, Environment{Time: night, IP: office}, false, `business_hours`},
+		{`/reports/2020`, Read, alice, Environment{Time: noon, IP: home}, false, `office`},
+		{`/secrets`, Read, alice, Environment{}, false, `unknown`},
+		{`/public`, Read, Subject{}, Environment{}, true, ``},
+	}
+
+	assert := assert.New(t)
+	for _, test := range tests {
+		decision := ac.Authorize(context.Background(), &Request{
+			URI:       test.uri,
+			Operation: test.op,
+			Subject:   test.sub,
+			Env:       test.env,
+		})
+		assert.Equal(test.granted, decision.Granted, test.uri)
+		name, failed := decision.FailedCondition()
+		assert.Equal(test.condition, name, test.uri)
+		assert.Equal(test.condition != ``, failed, test.uri)
+	}
+}
+
+func TestAccessControl_AuthorizeDecision(t *testing.T) {
+	ac := newConditionAccessControl(t)
+
+	assert := assert.New(t)
+	decision := ac.Authorize(context.Background(), &Request{
+		URI:       `/orders/1`,
+		Operation: Read,
+		Subject:   Subject{UserID: `alice`, RoleID: []int64{2}},
+	})
+	assert.True(decision.Granted)
+	assert.True(decision.Required)
+	assert.Equal(`/orders/:id`, decision.Pattern)
+	assert.Equal(Params{{Key: `id`, Value: `1`}}, decision.Params)
+	assert.Equal(int64(2), decision.RoleID)
+	assert.Equal([]ConditionResult{{Name: `owner`, Passed: true}}, decision.Conditions)
+
+	decision = ac.Authorize(context.Background(), &Request{
+		URI:       `/orders/3`,
+		Operation: Read,
+		Subject:   Subject{UserID: `alice`, RoleID: []int64{2}},
+	})
+	assert.False(decision.Granted)
+	assert.Equal(1, len(decision.Conditions))
+	assert.EqualError(decision.Conditions[0].Err, `order not found`)
+	assert.Equal(`condition "owner" failed`, decision.Reason)
+
+	decision = ac.Authorize(context.Background(), &Request{
+		URI:       `/secrets`,
+		Operation: Read,
+		Subject:   Subject{RoleID: []int64{2}},
+	})
+	assert.EqualError(decision.Conditions[0].Err, `RBAC: unknown condition "unknown"`)
+}
+
+func TestPolicyTree_IsGrantedWithConditions(t *testing.T) {
+	ac := newConditionAccessControl(t)
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{2, `user`, nil, 1},
+	}
+
+	assert := assert.New(t)
+	assert.True(ac.Policies.IsGranted(`/orders/1`, Read, &roles[0]))
+	assert.False(ac.Policies.IsGranted(`/orders/1`, Read, &roles[1]))
+}
+
+func TestConditions(t *testing.T) {
+	yes := func(*Request) (bool, error) { return true, nil }
+	no := func(*Request) (bool, error) { return false, nil }
+	fail := func(*Request) (bool, error) { return true, errors.New(`failed`) }
+
+	assert := assert.New(t)
+	check := func(condition Condition) bool {
+		ok, _ := condition(&Request{})
+		return ok
+	}
+	assert.True(check(All(yes, yes)))
+	assert.False(check(All(yes, no)))
+	assert.False(check(All(yes, fail)))
+	assert.True(check(Any(no, yes)))
+	assert.False(check(Any(no, no)))
+	assert.False(check(Any(fail, yes)))
+	assert.True(check(Not(no)))
+	assert.False(check(Not(yes)))
+	assert.False(check(Not(fail)))
+
+	overnight, err := TimeBetween(`22:00`, `06:00`, time.UTC)
+	assert.Nil(err)
+	ok, _ := overnight(&Request{Env: Environment{Time: time.Date(2020, 1, 1, 23, 0, 0, 0, time.UTC)}})
+	assert.True(ok)
+	ok, _ = overnight(&Request{Env: Environment{Time: time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)}})
+	assert.False(ok)
+
+	_, err = TimeBetween(`9am`, `18:00`, nil)
+	assert.NotNil(err)
+	_, err = IPIn(`10.0.0.0`)
+	assert.NotNil(err)
+
+	var nilConditions *Conditions
+	_, ok = nilConditions.Lookup(`owner`)
+	assert.False(ok)
+}
+
+func TestSubject_Attribute(t *testing.T) {
+	sub := Subject{UserID: `alice`, Tenant: `acme`, Attributes: map[string]interface{}{`level`: 3}}
+
+	assert := assert.New(t)
+	value, ok := sub.Attribute(`user_id`)
+	assert.True(ok)
+	assert.Equal(`alice`, value)
+	value, ok = sub.Attribute(`tenant`)
+	assert.True(ok)
+	assert.Equal(`acme`, value)
+	assert.True(sub.attributeEquals(`level`, `3`))
+	_, ok = sub.Attribute(`missing`)
+	assert.False(ok)
+}
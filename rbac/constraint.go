@@ -0,0 +1,327 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrInvalidConstraint = errors.New("RBAC: invalid constraint")
+	ErrSeparationOfDuty  = errors.New("RBAC: separation of duty is violated")
+	ErrCardinality       = errors.New("RBAC: role has too many members")
+	ErrPrerequisite      = errors.New("RBAC: prerequisite role is missing")
+	ErrRoleNotAssigned   = errors.New("RBAC: role is not assigned")
+)
+
+// ConstraintKind is the kind of a Constraint.
+type ConstraintKind uint8
+
+const (
+	// StaticSoD forbids a user to be assigned Limit or more of the roles of a constraint.
+	StaticSoD ConstraintKind = iota
+
+	// DynamicSoD forbids a user to activate Limit or more of the roles of a constraint together.
+	DynamicSoD
+
+	// Cardinality forbids more than Limit users to be assigned each of the roles of a constraint.
+	Cardinality
+
+	// Prerequisite forbids a user to hold one of the roles of a constraint without every role it Requires.
+	Prerequisite
+)
+
+func (k ConstraintKind) String() string {
+	switch k {
+	case StaticSoD:
+		return "static_sod"
+	case DynamicSoD:
+		return "dynamic_sod"
+	case Cardinality:
+		return "cardinality"
+	case Prerequisite:
+		return "prerequisite"
+	}
+	return "unknown"
+}
+
+// Constraint restricts which roles a user can hold, e.g. nobody may hold both a creator and an approver of payments:
+//
+//	Constraint{Name: "payments", Kind: StaticSoD, RoleID: []int64{creator, approver}}
+type Constraint struct {
+	Name string
+	Kind ConstraintKind
+
+	// RoleID are the roles the constraint applies to.
+	RoleID []int64
+
+	// Limit is the number of roles a separation of duty forbids together, 2 if it is 0,
+	// or the maximum number of members of each role with Cardinality.
+	Limit int
+
+	// Requires are the roles a Prerequisite needs.
+	Requires []int64
+}
+
+// Validate checks that the constraint can be enforced.
+func (c *Constraint) Validate() error {
+	if c.Name == "" {
+		return fmt.Errorf("%w: missing name", ErrInvalidConstraint)
+	}
+	if len(c.RoleID) == 0 {
+		return fmt.Errorf("%w: %q has no role", ErrInvalidConstraint, c.Name)
+	}
+	switch c.Kind {
+	case StaticSoD, DynamicSoD:
+		if c.Limit == 1 || c.Limit < 0 || c.limit() > len(c.RoleID) {
+			return fmt.Errorf("%w: %q can not forbid %d of %d roles", ErrInvalidConstraint, c.Name, c.limit(), len(c.RoleID))
+		}
+	case Cardinality:
+		if c.Limit <= 0 {
+			return fmt.Errorf("%w: %q limits members to %d", ErrInvalidConstraint, c.Name, c.Limit)
+		}
+	case Prerequisite:
+		if len(c.Requires) == 0 {
+			return fmt.Errorf("%w: %q requires no role", ErrInvalidConstraint, c.Name)
+		}
+	default:
+		return fmt.Errorf("%w: %q has an unknown kind", ErrInvalidConstraint, c.Name)
+	}
+	return nil
+}
+
+// limit returns the number of roles a separation of duty forbids together.
+func (c *Constraint) limit() int {
+	if c.Limit == 0 {
+		return 2
+	}
+	return c.Limit
+}
+
+// ConstraintError tells which constraint a user breaks. Err is one of the errors of the kind of the constraint,
+// so it can be checked with errors.Is.
+type ConstraintError struct {
+	Err        error
+	Constraint Constraint
+	UserID     string
+
+	// RoleID are the roles which break the constraint.
+	RoleID []int64
+}
+
+func (e *ConstraintError) Error() string {
+	var detail string
+	switch e.Constraint.Kind {
+	case StaticSoD, DynamicSoD:
+		detail = fmt.Sprintf("user %q can not hold roles %s together", e.UserID, formatIDs(e.RoleID))
+	case Cardinality:
+		detail = fmt.Sprintf("user %q can not be assigned role %s beyond %d members", e.UserID, formatIDs(e.RoleID), e.Constraint.Limit)
+	case Prerequisite:
+		detail = fmt.Sprintf("user %q needs roles %s", e.UserID, formatIDs(e.RoleID))
+	}
+	return fmt.Sprintf("%s: constraint %q (%s): %s", e.Err, e.Constraint.Name, e.Constraint.Kind, detail)
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.Err
+}
+
+// Constraints enforce constraints on roles of users. They are checked by AssignmentStore when roles are assigned,
+// by Session when roles are activated, and by AccessControl for roles a subject holds in a request.
+// Other stores of assignments can call CheckAssign and CheckUnassign themselves.
+//
+// Roles are compared by their ids, unless SetHierarchy makes a role hold the roles it inherits the permissions of.
+type Constraints struct {
+	mu          sync.RWMutex
+	constraints []Constraint
+	hierarchy   *hierarchy
+}
+
+// NewConstraints returns constraints after validating them.
+func NewConstraints(constraints ...Constraint) (*Constraints, error) {
+	c := &Constraints{}
+	for _, constraint := range constraints {
+		if err := c.Add(constraint); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Add validates a constraint and adds it. Assignments and sessions which already break it are kept
+// until they are checked again.
+func (c *Constraints) Add(constraint Constraint) error {
+	if err := constraint.Validate(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, existing := range c.constraints {
+		if existing.Name == constraint.Name {
+			return fmt.Errorf("%w: %q already exists", ErrInvalidConstraint, constraint.Name)
+		}
+	}
+	c.constraints = append(c.constraints, constraint)
+	return nil
+}
+
+// Remove removes the constraint of name.
+func (c *Constraints) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, constraint := range c.constraints {
+		if constraint.Name == name {
+			c.constraints = append(c.constraints[:i:i], c.constraints[i+1:]...)
+			return
+		}
+	}
+}
+
+// List returns all constraints in the order they were added.
+func (c *Constraints) List() []Constraint {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]Constraint(nil), c.constraints...)
+}
+
+// SetHierarchy makes a role hold the roles it inherits the permissions of, as PolicyTree.SetHierarchy grants them,
+// so that a parent holds its children with ParentInherits, which is rejected unless roles can be ranged over.
+func (c *Constraints) SetHierarchy(roles Roles, inheritance Inheritance) error {
+	h, err := newHierarchy(roles, inheritance, ParentInherits)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.hierarchy = h
+	return nil
+}
+
+// CheckAssign checks that a user who is assigned held can be assigned roleID as well,
+// when members other users are assigned roleID.
+func (c *Constraints) CheckAssign(userID string, roleID int64, held []int64, members int) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	authorized := c.authorized(append(append([]int64(nil), held...), roleID))
+	added := c.authorized([]int64{roleID})
+	for _, constraint := range c.constraints {
+		switch constraint.Kind {
+		case StaticSoD:
+			if err := c.checkSoD(constraint, userID, authorized, added); err != nil {
+				return err
+			}
+		case Cardinality:
+			if containsID(constraint.RoleID, roleID) && members >= constraint.Limit {
+				return &ConstraintError{Err: ErrCardinality, Constraint: constraint, UserID: userID, RoleID: []int64{roleID}}
+			}
+		case Prerequisite:
+			if containsID(constraint.RoleID, roleID) {
+				if err := c.checkPrerequisite(constraint, userID, c.authorized(held)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// CheckUnassign checks that a user who keeps remaining roles after one is unassigned
+// still has every role they require.
+func (c *Constraints) CheckUnassign(userID string, remaining []int64) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.checkPrerequisites(userID, remaining)
+}
+
+// CheckActivate checks that a user can activate roles together in a session.
+// Separations of duty of both kinds and prerequisites apply to the active roles.
+func (c *Constraints) CheckActivate(userID string, active []int64) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	authorized := c.authorized(active)
+	for _, constraint := range c.constraints {
+		if constraint.Kind == StaticSoD || constraint.Kind == DynamicSoD {
+			if err := c.checkSoD(constraint, userID, authorized, authorized); err != nil {
+				return err
+			}
+		}
+	}
+	return c.checkPrerequisites(userID, active)
+}
+
+// checkSoD checks that authorized roles do not break a separation of duty, if one of added is in it.
+// It must be called with mu held.
+func (c *Constraints) checkSoD(constraint Constraint, userID string, authorized, added []int64) error {
+	var conflicting []int64
+	affected := false
+	for _, id := range constraint.RoleID {
+		if containsID(authorized, id) && !containsID(conflicting, id) {
+			conflicting = append(conflicting, id)
+			affected = affected || containsID(added, id)
+		}
+	}
+	if affected && len(conflicting) >= constraint.limit() {
+		return &ConstraintError{Err: ErrSeparationOfDuty, Constraint: constraint, UserID: userID, RoleID: conflicting}
+	}
+	return nil
+}
+
+// checkPrerequisites checks that every role of roleID has the roles it requires. It must be called with mu held.
+func (c *Constraints) checkPrerequisites(userID string, roleID []int64) error {
+	authorized := c.authorized(roleID)
+	for _, constraint := range c.constraints {
+		if constraint.Kind != Prerequisite {
+			continue
+		}
+		if _, ok := firstID(roleID, constraint.RoleID); ok {
+			if err := c.checkPrerequisite(constraint, userID, authorized); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *Constraints) checkPrerequisite(constraint Constraint, userID string, authorized []int64) error {
+	var missing []int64
+	for _, id := range constraint.Requires {
+		if !containsID(authorized, id) {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) > 0 {
+		return &ConstraintError{Err: ErrPrerequisite, Constraint: constraint, UserID: userID, RoleID: missing}
+	}
+	return nil
+}
+
+// authorized returns roleID with the roles they inherit the permissions of. It must be called with mu held.
+func (c *Constraints) authorized(roleID []int64) []int64 {
+	h := c.hierarchy
+	if h == nil {
+		return roleID
+	}
+	authorized := append([]int64(nil), roleID...)
+	for _, id := range roleID {
+		inherited := h.ancestorsOf(id)
+		if h.inheritance == ParentInherits {
+			inherited = h.descendantsOf(id)
+		}
+		for _, r := range inherited {
+			if !containsID(authorized, r) {
+				authorized = append(authorized, r)
+			}
+		}
+	}
+	return authorized
+}
+
+func formatIDs(roleID []int64) string {
+	ids := make([]string, len(roleID))
+	for i, id := range roleID {
+		ids[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(ids, ", ")
+}
@@ -0,0 +1,162 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	paymentsCreator int64 = iota + 1
+	paymentsApprover
+	auditor
+	clerk
+	manager
+)
+
+func newConstraints(t *testing.T) *Constraints {
+	constraints, err := NewConstraints(
+		Constraint{Name: `payments`, Kind: StaticSoD, RoleID: []int64{paymentsCreator, paymentsApprover}},
+		Constraint{Name: `audit`, Kind: DynamicSoD, RoleID: []int64{auditor, paymentsCreator, paymentsApprover}},
+		Constraint{Name: `approvers`, Kind: Cardinality, RoleID: []int64{paymentsApprover}, Limit: 2},
+		Constraint{Name: `creators`, Kind: Prerequisite, RoleID: []int64{paymentsCreator}, Requires: []int64{clerk}},
+	)
+	assert.Nil(t, err)
+	return constraints
+}
+
+func TestConstraint_Validate(t *testing.T) {
+	assert := assert.New(t)
+	for _, c := range []Constraint{
+		{Kind: StaticSoD, RoleID: []int64{1, 2}},
+		{Name: `a`, Kind: StaticSoD},
+		{Name: `a`, Kind: StaticSoD, RoleID: []int64{1}},
+		{Name: `a`, Kind: DynamicSoD, RoleID: []int64{1, 2}, Limit: 1},
+		{Name: `a`, Kind: DynamicSoD, RoleID: []int64{1, 2}, Limit: 3},
+		{Name: `a`, Kind: Cardinality, RoleID: []int64{1}},
+		{Name: `a`, Kind: Prerequisite, RoleID: []int64{1}},
+		{Name: `a`, Kind: ConstraintKind(9), RoleID: []int64{1}},
+	} {
+		assert.ErrorIs(c.Validate(), ErrInvalidConstraint, c)
+	}
+
+	constraints := newConstraints(t)
+	assert.ErrorIs(constraints.Add(Constraint{Name: `payments`, Kind: Cardinality, RoleID: []int64{1}, Limit: 1}), ErrInvalidConstraint)
+	assert.Equal(4, len(constraints.List()))
+	constraints.Remove(`audit`)
+	assert.Equal(`creators`, constraints.List()[2].Name)
+}
+
+func TestConstraints_CheckAssign(t *testing.T) {
+	constraints := newConstraints(t)
+
+	assert := assert.New(t)
+	assert.Nil(constraints.CheckAssign(`alice`, paymentsCreator, []int64{clerk}, 0))
+	err := constraints.CheckAssign(`alice`, paymentsApprover, []int64{clerk, paymentsCreator}, 0)
+	assert.ErrorIs(err, ErrSeparationOfDuty)
+	var constraintErr *ConstraintError
+	assert.True(errors.As(err, &constraintErr))
+	assert.Equal(`payments`, constraintErr.Constraint.Name)
+	assert.Equal([]int64{paymentsCreator, paymentsApprover}, constraintErr.RoleID)
+	assert.Equal(`RBAC: separation of duty is violated: constraint "payments" (static_sod): `+
+		`user "alice" can not hold roles 1, 2 together`, err.Error())
+
+	// dynamic separation of duty allows roles to be assigned together
+	assert.Nil(constraints.CheckAssign(`alice`, auditor, []int64{clerk, paymentsCreator}, 0))
+
+	err = constraints.CheckAssign(`bob`, paymentsApprover, nil, 2)
+	assert.ErrorIs(err, ErrCardinality)
+	assert.Equal(`RBAC: role has too many members: constraint "approvers" (cardinality): `+
+		`user "bob" can not be assigned role 2 beyond 2 members`, err.Error())
+
+	err = constraints.CheckAssign(`bob`, paymentsCreator, []int64{auditor}, 0)
+	assert.ErrorIs(err, ErrPrerequisite)
+	assert.Equal(`RBAC: prerequisite role is missing: constraint "creators" (prerequisite): user "bob" needs roles 4`, err.Error())
+	assert.ErrorIs(constraints.CheckUnassign(`alice`, []int64{paymentsCreator}), ErrPrerequisite)
+	assert.Nil(constraints.CheckUnassign(`alice`, []int64{auditor}))
+}
+
+func TestConstraints_SetHierarchy(t *testing.T) {
+	roles := NewRoleManager()
+	roles.SetRole(&StandardRole{Id: manager})
+	roles.SetRole(&StandardRole{Id: paymentsApprover, ParentId: manager})
+	roles.SetRole(&StandardRole{Id: clerk, ParentId: manager})
+	constraints := newConstraints(t)
+
+	assert := assert.New(t)
+	assert.Nil(constraints.CheckAssign(`alice`, manager, []int64{clerk, paymentsCreator}, 0))
+	constraints.SetHierarchy(roles, ParentInherits)
+	assert.ErrorIs(constraints.CheckAssign(`alice`, manager, []int64{clerk, paymentsCreator}, 0), ErrSeparationOfDuty)
+	assert.ErrorIs(constraints.CheckAssign(`bob`, paymentsCreator, []int64{manager}, 0), ErrSeparationOfDuty)
+	constraints.Remove(`payments`)
+	assert.Nil(constraints.CheckAssign(`bob`, paymentsCreator, []int64{manager}, 0))
+	assert.ErrorIs(constraints.CheckActivate(`bob`, []int64{auditor, manager}), ErrSeparationOfDuty)
+}
+
+func TestAssignmentStore_Constraints(t *testing.T) {
+	store := NewAssignmentStore()
+	store.Constraints = newConstraints(t)
+
+	assert := assert.New(t)
+	assert.Nil(store.Assign(Assignment{UserID: `alice`, RoleID: clerk}))
+	assert.Nil(store.Assign(Assignment{UserID: `alice`, RoleID: paymentsCreator, Tenant: `acme`}))
+	assert.ErrorIs(store.Assign(Assignment{UserID: `alice`, RoleID: paymentsApprover, Tenant: `acme`}), ErrSeparationOfDuty)
+	assert.ErrorIs(store.Assign(Assignment{UserID: `alice`, RoleID: paymentsApprover}), ErrSeparationOfDuty)
+	assert.Nil(store.Assign(Assignment{UserID: `alice`, RoleID: paymentsApprover, Tenant: `other`}))
+	assert.Nil(store.Assign(Assignment{UserID: `alice`, RoleID: paymentsCreator, Tenant: `acme`, ExpiresAt: time.Now().Add(time.Hour)}))
+
+	// an expired assignment is not a member
+	assert.Nil(store.Assign(Assignment{UserID: `bob`, RoleID: paymentsApprover, ExpiresAt: time.Now().Add(-time.Minute)}))
+	assert.Nil(store.Assign(Assignment{UserID: `carol`, RoleID: paymentsApprover}))
+	assert.ErrorIs(store.Assign(Assignment{UserID: `dave`, RoleID: paymentsApprover, Tenant: `other`}), ErrCardinality)
+	assert.Nil(store.Assign(Assignment{UserID: `dave`, RoleID: paymentsApprover, Tenant: `acme`}))
+
+	assert.ErrorIs(store.Assign(Assignment{UserID: `dave`, RoleID: paymentsCreator}), ErrPrerequisite)
+	assert.ErrorIs(store.Unassign(`alice`, clerk, ``), ErrPrerequisite)
+	assert.Nil(store.Unassign(`alice`, paymentsCreator, `acme`))
+	assert.Nil(store.Unassign(`alice`, clerk, ``))
+}
+
+func TestSession(t *testing.T) {
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies([]StandardPolicy{
+		{`/payments`, []PermissionGroup{{Operation: Create, RoleID: []int64{paymentsCreator}}}},
+		{`/audits`, []PermissionGroup{{Operation: Read, RoleID: []int64{auditor}}}},
+	})
+	store := NewAssignmentStore()
+	store.Assign(Assignment{UserID: `alice`, RoleID: clerk})
+	store.Assign(Assignment{UserID: `alice`, RoleID: paymentsCreator})
+	store.Assign(Assignment{UserID: `alice`, RoleID: auditor})
+	ac.Assignments = store
+	ac.Constraints = newConstraints(t)
+
+	assert := assert.New(t)
+	session := ac.NewSession(`alice`, ``)
+	assert.ErrorIs(session.Activate(paymentsApprover), ErrRoleNotAssigned)
+	assert.ErrorIs(session.Activate(paymentsCreator), ErrPrerequisite)
+	assert.Nil(session.Activate(clerk, paymentsCreator))
+	assert.True(ac.IsSubjectGranted(`/payments`, Create, session.Subject()))
+
+	err := session.Activate(auditor)
+	assert.ErrorIs(err, ErrSeparationOfDuty)
+	assert.Contains(err.Error(), `constraint "audit" (dynamic_sod)`)
+	assert.Equal([]int64{clerk, paymentsCreator}, session.Roles())
+
+	assert.ErrorIs(session.Deactivate(clerk), ErrPrerequisite)
+	assert.Nil(session.Deactivate(paymentsCreator))
+	assert.Nil(session.Activate(auditor))
+	assert.True(ac.IsSubjectGranted(`/audits`, Read, session.Subject()))
+	assert.Equal(Subject{UserID: `alice`, RoleID: []int64{clerk, auditor}}, session.Subject())
+
+	// a subject holding every assigned role at once is denied
+	granted, err := ac.Enforce(`/audits`, Read, Subject{UserID: `alice`})
+	assert.ErrorIs(err, ErrSeparationOfDuty)
+	assert.False(granted)
+	decision := ac.Authorize(context.Background(), &Request{URI: `/audits`, Operation: Read,
+		Subject: Subject{UserID: `alice`, RoleID: []int64{clerk, paymentsCreator, auditor}}})
+	assert.False(decision.Granted)
+	assert.Contains(decision.Reason, `constraint "audit"`)
+}
@@ -0,0 +1,171 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Explanation tells how a request is decided, for debugging policies.
+type Explanation struct {
+	URI       string
+	Operation Operation
+	Algorithm CombiningAlgorithm
+
+	// Path lists the policies matching the URI in the order the tree searches them,
+	// so the most specific one comes first.
+	Path []PathStep
+
+	// RoleID are the roles Require returns, and Required is whether any policy has rules for the operation.
+	RoleID   []int64
+	Required bool
+
+	Decision Decision
+}
+
+// PathStep is a policy matching the URI of a request.
+type PathStep struct {
+	Pattern string
+	Params  Params
+	Groups  []ExplainedGroup
+}
+
+// ExplainedGroup is a permission group of a matching policy.
+type ExplainedGroup struct {
+	Group PermissionGroup
+
+	// Includes is whether the group has rules for the operation.
+	Includes bool
+
+	// Considered is whether the combining algorithm considers the group.
+	Considered bool
+
+	// RoleID are the roles of the group expanded through the hierarchy, if it includes the operation.
+	RoleID []int64
+}
+
+// PolicyExplainer is implemented by Policies which can explain how they decide requests.
+type PolicyExplainer interface {
+	Explain(uri string, op Operation, sub Subject) Explanation
+}
+
+// Explain tells which policies match uri, which of their groups are considered for op,
+// which roles are required, and how the tree decides the roles of sub. Conditions are not evaluated.
+func (t *PolicyTree) Explain(uri string, op Operation, sub Subject) Explanation {
+	e := Explanation{URI: uri, Operation: op, Algorithm: t.algorithm}
+	match, _ := t.Lookup(uri, op)
+	considered := make(map[string]bool)
+	for _, rule := range t.algorithm.candidates(match.Rules) {
+		considered[rule.Pattern] = true
+	}
+
+	if paths := handleURI(uri); len(paths) > 0 {
+		visited := make(map[*PolicyTree]bool)
+		searchTree(t, paths, nil, func(node *PolicyTree, matched Params) bool {
+			if visited[node] || node.uri == "" {
+				return false
+			}
+			visited[node] = true
+			step := PathStep{Pattern: node.uri, Params: append(Params(nil), matched...)}
+			for _, group := range node.groups {
+				explained := ExplainedGroup{Group: group, Includes: group.include(op) && len(group.RoleID) > 0}
+				if explained.Includes {
+					explained.Considered = considered[node.uri]
+					explained.RoleID = t.hierarchy.groupRoles(group)
+				}
+				step.Groups = append(step.Groups, explained)
+			}
+			e.Path = append(e.Path, step)
+			return false
+		})
+	}
+
+	e.RoleID, e.Required = t.Require(uri, op)
+	e.Decision = t.Decide(uri, op, sub.RoleID)
+	return e
+}
+
+// Explain explains the current policies, if they support it.
+func (p *PolicyManager) Explain(uri string, op Operation, sub Subject) Explanation {
+	policies := p.load().Policies
+	if explainer, ok := policies.(PolicyExplainer); ok {
+		return explainer.Explain(uri, op, sub)
+	}
+	e := Explanation{URI: uri, Operation: op}
+	e.RoleID, e.Required = policies.Require(uri, op)
+	return e
+}
+
+// Explain explains a request of sub like PolicyTree.Explain, and decides it as Authorize does,
+// evaluating conditions and the hierarchy of roles, without auditing it.
+func (ac *AccessControl) Explain(uri string, op Operation, sub Subject) Explanation {
+	var e Explanation
+	if explainer, ok := ac.Policies.(PolicyExplainer); ok {
+		e = explainer.Explain(uri, op, sub)
+	} else {
+		e = Explanation{URI: uri, Operation: op}
+		e.RoleID, e.Required = ac.Policies.Require(uri, op)
+	}
+	e.Decision = ac.decide(context.Background(), &Request{
+		URI:       uri,
+		Operation: op,
+		Subject:   sub,
+		Env:       Environment{Time: time.Now()},
+	})
+	return e
+}
+
+// String writes the explanation in lines such as
+//
+//	read /data/1 (most-specific)
+//	  /data/:id {id=1}
+//	    read [3] considered
+//	  /**
+//	    delete [1]
+//	required roles: [3]
+//	granted: role 3 is granted by /data/:id
+func (e Explanation) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s (%s)\n", e.Operation, e.URI, e.Algorithm)
+	if len(e.Path) == 0 {
+		b.WriteString("  no policy matches\n")
+	}
+	for _, step := range e.Path {
+		b.WriteString("  " + step.Pattern)
+		if len(step.Params) > 0 {
+			params := make([]string, 0, len(step.Params))
+			for _, p := range step.Params {
+				params = append(params, p.Key+"="+p.Value)
+			}
+			fmt.Fprintf(&b, " {%s}", strings.Join(params, ", "))
+		}
+		b.WriteString("\n")
+		for _, group := range step.Groups {
+			b.WriteString("    " + group.Group.String())
+			if len(group.Group.Conditions) > 0 {
+				fmt.Fprintf(&b, " if %s", strings.Join(group.Group.Conditions, ", "))
+			}
+			if group.Considered {
+				b.WriteString(" considered")
+				if len(group.RoleID) != len(group.Group.RoleID) {
+					fmt.Fprintf(&b, " as %v", group.RoleID)
+				}
+			}
+			b.WriteString("\n")
+		}
+	}
+	if e.Required {
+		fmt.Fprintf(&b, "required roles: %v\n", e.RoleID)
+	}
+	result := "denied"
+	if e.Decision.Granted {
+		result = "granted"
+	}
+	fmt.Fprintf(&b, "%s: %s", result, e.Decision.Reason)
+	if name, failed := e.Decision.FailedCondition(); failed && e.Decision.Pattern != "" {
+		fmt.Fprintf(&b, " (condition %q failed)", name)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
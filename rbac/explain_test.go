@@ -0,0 +1,76 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyTree_Explain(t *testing.T) {
+	tree := NewPolicyTree()
+	tree.LoadPolicies([]StandardPolicy{
+		{URI: `/**`, Groups: []PermissionGroup{{Operation: CRUD, RoleID: []int64{1}}}},
+		{URI: `/data/:id`, Groups: []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+			{Operation: Delete, RoleID: []int64{1}},
+		}},
+		{URI: `/data/secret`, Groups: []PermissionGroup{{Operation: Update, RoleID: []int64{1}}}},
+	})
+
+	e := tree.Explain(`/data/1`, Read, Subject{RoleID: []int64{1}})
+
+	assert := assert.New(t)
+	assert.Equal(2, len(e.Path))
+	assert.Equal(`/data/:id`, e.Path[0].Pattern)
+	assert.Equal(Params{{Key: `id`, Value: `1`}}, e.Path[0].Params)
+	assert.True(e.Path[0].Groups[0].Considered)
+	assert.False(e.Path[0].Groups[1].Includes)
+	assert.Equal(`/**`, e.Path[1].Pattern)
+	assert.True(e.Path[1].Groups[0].Includes)
+	assert.False(e.Path[1].Groups[0].Considered)
+	assert.Equal([]int64{3}, e.RoleID)
+	assert.True(e.Required)
+	assert.False(e.Decision.Granted)
+	assert.Equal(`read /data/1 (most-specific)
+  /data/:id {id=1}
+    read [3] considered
+    delete [1]
+  /**
+    create|read|update|delete [1]
+required roles: [3]
+denied: no required role
+`, e.String())
+
+	tree.SetCombiningAlgorithm(PermitOverrides)
+	e = tree.Explain(`/data/1`, Read, Subject{RoleID: []int64{1}})
+	assert.True(e.Path[1].Groups[0].Considered)
+	assert.True(e.Decision.Granted)
+	assert.Equal(`/**`, e.Decision.Pattern)
+
+	e = tree.Explain(`/other`, Delete, Subject{})
+	assert.Equal(1, len(e.Path))
+	assert.Equal([]int64{1}, e.RoleID)
+}
+
+func TestAccessControl_Explain(t *testing.T) {
+	manager := NewPolicyManager(nil)
+	manager.LoadPolicies([]StandardPolicy{
+		{URI: `/orders/:id`, Groups: []PermissionGroup{{Operation: Read, RoleID: []int64{3}, Conditions: []string{`owner`}}}},
+	})
+	ac := NewAccessControl(manager, NewRoleManager())
+	ac.SetRole(&StandardRole{Id: 1, Name: `admin`})
+	ac.SetRole(&StandardRole{Id: 3, Name: `customer`, ParentId: 1})
+	ac.Conditions = NewConditions()
+	ac.Conditions.Register(`owner`, ParamEquals(`id`, `user_id`))
+
+	assert := assert.New(t)
+	e := ac.Explain(`/orders/7`, Read, Subject{UserID: `7`, RoleID: []int64{1}})
+	assert.Equal(1, len(e.Path))
+	assert.True(e.Decision.Granted)
+	assert.Equal(int64(1), e.Decision.RoleID)
+
+	e = ac.Explain(`/orders/7`, Read, Subject{UserID: `8`, RoleID: []int64{3}})
+	assert.False(e.Decision.Granted)
+	assert.Contains(e.String(), `read [3] if owner considered`)
+	assert.Contains(e.String(), `denied: condition "owner" failed`+"\n")
+}
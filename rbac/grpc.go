@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-pandora/pkg/internal/grpcutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MethodMapper maps a full gRPC method name such as "/pkg.Service/GetUser"
+// onto a URI of Policies and an Operation. It returns false if it can not tell the operation,
+// and the interceptors deny such a method unless no policy applies to its URI for any operation.
+type MethodMapper func(fullMethod string) (uri string, op Operation, ok bool)
+
+// RoleResolver returns ids of roles the caller of a RPC has.
+// It should return false if the caller is not authenticated.
+type RoleResolver func(ctx context.Context) (roleID []int64, ok bool)
+
+var methodVerbs = []struct {
+	prefix    []string
+	operation Operation
+}{
+	{[]string{"Get", "List", "Read", "Search", "Find", "Watch"}, Read},
+	{[]string{"Create", "Add", "Insert"}, Create},
+	{[]string{"Update", "Set", "Patch", "Modify"}, Update},
+	{[]string{"Delete", "Remove"}, Delete},
+}
+
+// DefaultMethodMapper uses the full method name as the URI
+// and guesses the Operation from the verb the method name starts with.
+// The verb must be a whole word, followed by the end of the name or an upper case letter,
+// so that "Settings" or "AddressLookup" are not taken for "Set" or "Add".
+// Methods with an unknown verb are not mapped.
+func DefaultMethodMapper(fullMethod string) (string, Operation, bool) {
+	method := fullMethod[strings.LastIndex(fullMethod, `/`)+1:]
+	for _, verb := range methodVerbs {
+		for _, prefix := range verb.prefix {
+			if startsWithWord(method, prefix) {
+				return fullMethod, verb.operation, true
+			}
+		}
+	}
+	return fullMethod, Nil, false
+}
+
+// startsWithWord shows whether name starts with word followed by the end of name or an upper case letter.
+func startsWithWord(name, word string) bool {
+	if !strings.HasPrefix(name, word) {
+		return false
+	}
+	next, _ := utf8.DecodeRuneInString(name[len(word):])
+	return next == utf8.RuneError || unicode.IsUpper(next)
+}
+
+// UnaryServerInterceptor checks whether the caller of a unary RPC is granted by policies.
+func (ac *AccessControl) UnaryServerInterceptor(mapper MethodMapper, resolver RoleResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if err := ac.authorizeRPC(ctx, info.FullMethod, mapper, resolver); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor checks whether the caller of a streaming RPC is granted by policies.
+func (ac *AccessControl) StreamServerInterceptor(mapper MethodMapper, resolver RoleResolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := ac.authorizeRPC(ss.Context(), info.FullMethod, mapper, resolver); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func (ac *AccessControl) authorizeRPC(ctx context.Context, fullMethod string, mapper MethodMapper, resolver RoleResolver) error {
+	if mapper == nil {
+		mapper = DefaultMethodMapper
+	}
+	uri, op, ok := mapper(fullMethod)
+	if !ok {
+		if !ac.requiresAny(ctx, uri) {
+			return nil
+		}
+		ac.recordDecision(uri, op, nil, grpcutil.PeerIP(ctx), false, "operation of method is unknown")
+		return status.Errorf(codes.PermissionDenied, "RBAC: operation of %s is unknown", fullMethod)
+	}
+	if _, needAuth := ac.require(ctx, uri, op); !needAuth {
+		return nil
+	}
+	roleID, ok := resolver(ctx)
+	if !ok {
+		ac.recordDecision(uri, op, nil, grpcutil.PeerIP(ctx), false, "caller is not authenticated")
+		return status.Error(codes.Unauthenticated, "RBAC: caller is not authenticated")
+	}
+	decision := ac.Authorize(ctx, &Request{
+		URI:       uri,
+		Operation: op,
+		Subject:   Subject{RoleID: roleID},
+		Env:       Environment{Time: time.Now(), IP: net.ParseIP(grpcutil.PeerIP(ctx))},
+	})
+	if !decision.Granted {
+		return status.Errorf(codes.PermissionDenied, "RBAC: permission denied for %s", fullMethod)
+	}
+	return nil
+}
+
+// requiresAny shows whether policies have rules of uri for any registered operation.
+func (ac *AccessControl) requiresAny(ctx context.Context, uri string) bool {
+	for bit, last := Operation(1), lastOperation(); bit != 0 && bit <= last; bit <<= 1 {
+		if _, required := ac.require(ctx, uri, bit); required {
+			return true
+		}
+	}
+	return false
+}
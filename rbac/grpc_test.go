@@ -0,0 +1,105 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type rolesKey struct{}
+
+func resolveRoles(ctx context.Context) ([]int64, bool) {
+	roleID, ok := ctx.Value(rolesKey{}).([]int64)
+	return roleID, ok
+}
+
+func TestDefaultMethodMapper(t *testing.T) {
+	assert := assert.New(t)
+
+	uri, op, ok := DefaultMethodMapper(`/pandora.v1.UserService/GetUser`)
+	assert.True(ok)
+	assert.Equal(`/pandora.v1.UserService/GetUser`, uri)
+	assert.Equal(Read, op)
+
+	for method, expected := range map[string]Operation{
+		`CreateUser`: Create,
+		`RemoveUser`: Delete,
+		`Set`:        Update,
+		`Find`:       Read,
+		`ListÉtats`:  Read,
+	} {
+		_, op, ok = DefaultMethodMapper(`/pandora.v1.UserService/` + method)
+		assert.True(ok, method)
+		assert.Equal(expected, op, method)
+	}
+	for _, method := range []string{`Ban`, `AddressLookup`, `Settings`, `SetupStatus`, `Finder`, `Getaway`, `Listen`} {
+		_, op, ok = DefaultMethodMapper(`/pandora.v1.UserService/` + method)
+		assert.False(ok, method)
+		assert.Equal(Nil, op, method)
+	}
+}
+
+func TestAccessControl_UnaryServerInterceptor(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/pandora.v1.UserService/*`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+			{Operation: Delete, RoleID: []int64{1}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{3, `user`, nil, 1},
+		{4, `guest`, nil, 0},
+	}
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	for i := range roles {
+		ac.SetRole(&roles[i])
+	}
+	interceptor := ac.UnaryServerInterceptor(nil, resolveRoles)
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	}
+	call := func(ctx context.Context, method string) codes.Code {
+		_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+		return status.Code(err)
+	}
+
+	assert := assert.New(t)
+	user := context.WithValue(context.Background(), rolesKey{}, []int64{3})
+	admin := context.WithValue(context.Background(), rolesKey{}, []int64{1})
+	guest := context.WithValue(context.Background(), rolesKey{}, []int64{4})
+
+	assert.Equal(codes.OK, call(context.Background(), `/pandora.v1.AuthService/Login`))
+	assert.Equal(codes.Unauthenticated, call(context.Background(), `/pandora.v1.UserService/GetUser`))
+	assert.Equal(codes.OK, call(user, `/pandora.v1.UserService/GetUser`))
+	assert.Equal(codes.OK, call(admin, `/pandora.v1.UserService/GetUser`))
+	assert.Equal(codes.PermissionDenied, call(guest, `/pandora.v1.UserService/GetUser`))
+	assert.Equal(codes.PermissionDenied, call(user, `/pandora.v1.UserService/DeleteUser`))
+	assert.Equal(codes.OK, call(admin, `/pandora.v1.UserService/DeleteUser`))
+
+	// methods of unknown operations are denied where policies apply
+	assert.Equal(codes.PermissionDenied, call(admin, `/pandora.v1.UserService/Ban`))
+	assert.Equal(codes.PermissionDenied, call(admin, `/pandora.v1.UserService/Settings`))
+	assert.Equal(codes.OK, call(context.Background(), `/pandora.v1.AuthService/Settings`))
+}
+
+func TestRoleIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	roleID, ok := RoleIDs([]interface{}{float64(1), float64(3)})
+	assert.True(ok)
+	assert.Equal([]int64{1, 3}, roleID)
+
+	roleID, ok = RoleIDs(float64(5))
+	assert.True(ok)
+	assert.Equal([]int64{5}, roleID)
+
+	_, ok = RoleIDs([]interface{}{"admin"})
+	assert.False(ok)
+}
@@ -0,0 +1,170 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var ErrInvalidInheritance = errors.New("RBAC: invalid inheritance")
+
+// Inheritance tells how permissions are inherited along the hierarchy of roles.
+type Inheritance uint8
+
+const (
+	// NoInheritance grants a role only what policies grant to it directly.
+	NoInheritance Inheritance = iota
+
+	// ParentInherits grants a parent role everything its children are granted.
+	ParentInherits
+
+	// ChildInherits grants a child role everything its parent is granted.
+	ChildInherits
+)
+
+// hierarchy caches ancestors and descendants of roles for a PolicyTree.
+// The cache is dropped whenever the generation of roles changes, and on every use if roles have no generation.
+type hierarchy struct {
+	roles       Roles
+	inheritance Inheritance
+
+	mu          sync.Mutex
+	generation  uint64
+	ancestors   map[int64][]int64
+	descendants map[int64][]int64
+}
+
+// newHierarchy returns the hierarchy of roles, or nil if nothing is inherited. Descendants of roles
+// are found when inheritance goes down to them, which needs roles which can be ranged over.
+func newHierarchy(roles Roles, inheritance, down Inheritance) (*hierarchy, error) {
+	if roles == nil || inheritance == NoInheritance {
+		return nil, nil
+	}
+	if _, ok := roles.(interface{ Range(func(Role) bool) }); !ok && inheritance == down {
+		return nil, fmt.Errorf("%w: descendants of roles which can not be ranged over can not be found", ErrInvalidInheritance)
+	}
+	return &hierarchy{
+		roles:       roles,
+		inheritance: inheritance,
+		ancestors:   make(map[int64][]int64),
+	}, nil
+}
+
+// validate drops the cache if roles have changed since it was built, or if roles have no generation
+// to tell whether they have. It must be called with mu held.
+func (h *hierarchy) validate() {
+	g, ok := h.roles.(interface{ Generation() uint64 })
+	if ok && g.Generation() == h.generation {
+		return
+	}
+	if ok {
+		h.generation = g.Generation()
+	}
+	h.ancestors = make(map[int64][]int64)
+	h.descendants = nil
+}
+
+// ancestorsOf returns ids of all ancestors of a role, from its parent to the root.
+func (h *hierarchy) ancestorsOf(id int64) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.validate()
+	if ancestors, ok := h.ancestors[id]; ok {
+		return ancestors
+	}
+
+	ancestors := make([]int64, 0)
+	visited := map[int64]bool{id: true}
+	for role := h.roles.GetRole(id); role != nil; {
+		parentID := role.ParentID()
+		if visited[parentID] {
+			break
+		}
+		if role = h.roles.GetRole(parentID); role == nil {
+			break
+		}
+		visited[parentID] = true
+		ancestors = append(ancestors, parentID)
+	}
+	h.ancestors[id] = ancestors
+	return ancestors
+}
+
+// descendantsOf returns ids of all descendants of a role.
+// It needs roles which can be ranged over, otherwise it returns nothing.
+func (h *hierarchy) descendantsOf(id int64) []int64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.validate()
+	if h.descendants == nil {
+		h.buildDescendants()
+	}
+	return h.descendants[id]
+}
+
+// buildDescendants collects descendants of every role. It must be called with mu held.
+func (h *hierarchy) buildDescendants() {
+	h.descendants = make(map[int64][]int64)
+	ranger, ok := h.roles.(interface{ Range(func(Role) bool) })
+	if !ok {
+		return
+	}
+	children := make(map[int64][]int64)
+	ranger.Range(func(role Role) bool {
+		if role.ParentID() != role.ID() {
+			children[role.ParentID()] = append(children[role.ParentID()], role.ID())
+		}
+		return true
+	})
+	for parent := range children {
+		var descendants []int64
+		visited := map[int64]bool{parent: true}
+		queue := append([]int64(nil), children[parent]...)
+		for len(queue) > 0 {
+			id := queue[0]
+			queue = queue[1:]
+			if visited[id] {
+				continue
+			}
+			visited[id] = true
+			descendants = append(descendants, id)
+			queue = append(queue, children[id]...)
+		}
+		h.descendants[parent] = descendants
+	}
+}
+
+// expand adds roles which inherit the permission of roleID.
+func (h *hierarchy) expand(roleID []int64) []int64 {
+	if h == nil || h.inheritance == NoInheritance || len(roleID) == 0 {
+		return roleID
+	}
+	seen := make(map[int64]bool, len(roleID))
+	expanded := make([]int64, 0, len(roleID))
+	add := func(ids []int64) {
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				expanded = append(expanded, id)
+			}
+		}
+	}
+	add(roleID)
+	for _, id := range roleID {
+		if h.inheritance == ParentInherits {
+			add(h.ancestorsOf(id))
+		} else {
+			add(h.descendantsOf(id))
+		}
+	}
+	return expanded
+}
+
+// groupRoles returns the roles a group applies to. An allow group also applies to the roles inheriting
+// its permission, while a deny group only applies to the roles it lists, not to superiors of them.
+func (h *hierarchy) groupRoles(group PermissionGroup) []int64 {
+	if group.Effect == Deny {
+		return group.RoleID
+	}
+	return h.expand(group.RoleID)
+}
@@ -0,0 +1,91 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-pandora/pkg/audit"
+	"github.com/go-pandora/pkg/metrics"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/go-pandora/pkg/rbac"
+
+const (
+	metricDecisions      = "rbac_decisions_total"
+	metricLookupDuration = "rbac_policy_lookup_duration_seconds"
+)
+
+func (ac *AccessControl) tracer() trace.Tracer {
+	if ac.TracerProvider != nil {
+		return ac.TracerProvider.Tracer(instrumentationName)
+	}
+	return otel.Tracer(instrumentationName)
+}
+
+// require looks up policies with tracing and metrics.
+func (ac *AccessControl) require(ctx context.Context, uri string, op Operation) ([]int64, bool) {
+	_, span := ac.tracer().Start(ctx, "rbac.Require", trace.WithAttributes(
+		attribute.String("rbac.uri", uri),
+		attribute.String("rbac.operation", fmt.Sprint(op)),
+	))
+	defer span.End()
+
+	start := time.Now()
+	roleID, required := ac.Policies.Require(uri, op)
+	span.SetAttributes(attribute.Bool("rbac.required", required))
+	if ac.Metrics != nil {
+		ac.Metrics.Observe(metricLookupDuration, time.Since(start).Seconds(), nil)
+	}
+	return roleID, required
+}
+
+// lookup finds the policy which applies to a request with tracing and metrics.
+func (ac *AccessControl) lookup(ctx context.Context, lookup PolicyLookup, uri string, op Operation) (PolicyMatch, bool) {
+	_, span := ac.tracer().Start(ctx, "rbac.Lookup", trace.WithAttributes(
+		attribute.String("rbac.uri", uri),
+		attribute.String("rbac.operation", fmt.Sprint(op)),
+	))
+	defer span.End()
+
+	start := time.Now()
+	match, ok := lookup.Lookup(uri, op)
+	span.SetAttributes(attribute.Bool("rbac.required", ok))
+	if ok {
+		span.SetAttributes(attribute.String("rbac.pattern", match.Rules[0].Pattern))
+	}
+	if ac.Metrics != nil {
+		ac.Metrics.Observe(metricLookupDuration, time.Since(start).Seconds(), nil)
+	}
+	return match, ok
+}
+
+// recordDecision sends an authorization decision to the audit sink and the metrics, if they are set.
+func (ac *AccessControl) recordDecision(uri string, op Operation, roleID []int64, clientIP string, granted bool, reason string) {
+	decision := "granted"
+	if !granted {
+		decision = "denied"
+	}
+	if ac.Metrics != nil {
+		ac.Metrics.Inc(metricDecisions, metrics.Labels{"decision": decision})
+	}
+	if ac.Audit == nil {
+		return
+	}
+	e := audit.Event{
+		Type:      audit.AccessGranted,
+		Time:      time.Now(),
+		ClientIP:  clientIP,
+		Reason:    reason,
+		Resource:  uri,
+		Operation: fmt.Sprint(op),
+		RoleID:    roleID,
+	}
+	if !granted {
+		e.Type = audit.AccessDenied
+	}
+	ac.Audit.Audit(e)
+}
@@ -0,0 +1,46 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestAccessControl_Instrument(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{2}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{2, `roleManager`, nil, 1},
+	}
+
+	exporter := tracetest.NewInMemoryExporter()
+	recorder := metrics.NewMemory()
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.Metrics = recorder
+	ac.TracerProvider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	ac.LoadPolicies(policies)
+
+	roleID, required := ac.Require(`/data/image`, Read)
+	ac.IsGranted(`/data/image`, Read, &roles[1])
+	ac.IsGranted(`/data/image`, Read, &roles[0])
+
+	assert := assert.New(t)
+	assert.Equal([]int64{2}, roleID)
+	assert.True(required)
+	assert.Equal(float64(1), recorder.Counter(metricDecisions, metrics.Labels{"decision": "granted"}))
+	assert.Equal(float64(1), recorder.Counter(metricDecisions, metrics.Labels{"decision": "denied"}))
+	assert.Equal(3, len(recorder.Histogram(metricLookupDuration, nil)))
+
+	spans := exporter.GetSpans()
+	assert.Equal(3, len(spans))
+	assert.Equal(`rbac.Require`, spans[0].Name)
+	assert.Equal(`rbac.Lookup`, spans[1].Name)
+	assert.Equal(`rbac.Lookup`, spans[2].Name)
+}
@@ -0,0 +1,432 @@
+package rbac
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Severity is how serious a finding of Lint is.
+type Severity uint8
+
+const (
+	Info Severity = iota
+	Warning
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Info:
+		return "info"
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", uint8(s))
+}
+
+// Checks of Lint.
+const (
+	// CheckInvalidPattern finds URIs which are not valid patterns.
+	CheckInvalidPattern = "invalid-pattern"
+	// CheckDuplicateURI finds policies which overwrite a former one of the same URI,
+	// or which match exactly the same URIs as another one.
+	CheckDuplicateURI = "duplicate-uri"
+	// CheckShadowed finds rules which never decide a request because a rule of another policy
+	// or of the same policy overrides them, and stricter policies which a broader one bypasses.
+	CheckShadowed = "shadowed"
+	// CheckUnreachable finds groups which grant or forbid nothing.
+	CheckUnreachable = "unreachable"
+	// CheckUnknownRole finds role ids which no role defines.
+	CheckUnknownRole = "unknown-role"
+	// CheckUnusedRole finds roles which are granted nothing, directly or through their subordinates.
+	CheckUnusedRole = "unused-role"
+	// CheckBroadGrant finds grants of CRUD on "/**".
+	CheckBroadGrant = "broad-grant"
+)
+
+// Finding is a problem Lint finds in policies or roles.
+type Finding struct {
+	Check    string
+	Severity Severity
+
+	// URI is the URI of the policy or the permission the finding is about.
+	URI string
+
+	// Policy and Group are indexes of the policy and its group the finding is about, or -1.
+	Policy int
+	Group  int
+
+	// RoleID is the role the finding is about, or 0.
+	RoleID int64
+
+	Message string
+}
+
+func (f Finding) String() string {
+	if f.URI == "" {
+		return fmt.Sprintf("%s: %s [%s]", f.Severity, f.Message, f.Check)
+	}
+	return fmt.Sprintf("%s: %s: %s [%s]", f.Severity, f.URI, f.Message, f.Check)
+}
+
+type Findings []Finding
+
+// Max returns the highest severity of the findings, which is Info if there is none.
+func (fs Findings) Max() Severity {
+	max := Info
+	for _, f := range fs {
+		if f.Severity > max {
+			max = f.Severity
+		}
+	}
+	return max
+}
+
+// Filter returns the findings of severity min or higher.
+func (fs Findings) Filter(min Severity) Findings {
+	var filtered Findings
+	for _, f := range fs {
+		if f.Severity >= min {
+			filtered = append(filtered, f)
+		}
+	}
+	return filtered
+}
+
+// Err returns an error listing the findings of severity min or higher, or nil if there is none,
+// so that a test can fail on it.
+func (fs Findings) Err(min Severity) error {
+	filtered := fs.Filter(min)
+	if len(filtered) == 0 {
+		return nil
+	}
+	lines := make([]string, len(filtered))
+	for i, f := range filtered {
+		lines[i] = f.String()
+	}
+	return errors.New("RBAC: policies have problems:\n" + strings.Join(lines, "\n"))
+}
+
+// Lint analyses policies decided by algorithm and roles, without loading them.
+// Roles may be nil, in which case role ids are not checked. Roles are granted along their hierarchy
+// by inheritance, like PolicyTree.SetHierarchy.
+// Findings are ordered by the policies they are about, then by roles.
+func Lint(policies []StandardPolicy, algorithm CombiningAlgorithm, roles []Role, inheritance Inheritance) Findings {
+	l := linter{policies: policies, algorithm: algorithm, inheritance: inheritance, patterns: make([][]segment, len(policies))}
+	for i, policy := range policies {
+		if err := ValidatePattern(policy.URI); err != nil {
+			l.report(Finding{Check: CheckInvalidPattern, Severity: Error, Policy: i, Group: -1, Message: err.Error()})
+			continue
+		}
+		l.patterns[i] = parsePattern(policy.URI)
+	}
+	l.duplicates()
+	for i := range policies {
+		if l.patterns[i] == nil || l.overwritten[i] {
+			continue
+		}
+		l.groups(i)
+		for j := range policies {
+			if i != j && l.patterns[j] != nil && l.distinct(i, j) && covers(l.patterns[i], l.patterns[j]) {
+				l.shadows(i, j)
+			}
+		}
+	}
+	if roles != nil {
+		l.roles(roles)
+	}
+	sort.SliceStable(l.findings, func(a, b int) bool {
+		fa, fb := l.findings[a], l.findings[b]
+		if (fa.Policy < 0) != (fb.Policy < 0) {
+			return fb.Policy < 0
+		}
+		return fa.Policy < fb.Policy
+	})
+	return l.findings
+}
+
+type linter struct {
+	policies    []StandardPolicy
+	algorithm   CombiningAlgorithm
+	inheritance Inheritance
+	patterns    [][]segment
+	// overwritten marks policies which a later policy of the same URI overwrites.
+	overwritten map[int]bool
+	findings    Findings
+}
+
+func (l *linter) report(f Finding) {
+	if f.Policy >= 0 && f.URI == "" {
+		f.URI = l.policies[f.Policy].URI
+	}
+	l.findings = append(l.findings, f)
+}
+
+// duplicates finds policies of the same URI, which PolicyTree overwrites, and policies of equivalent patterns.
+func (l *linter) duplicates() {
+	l.overwritten = make(map[int]bool)
+	seen := make(map[string]int)
+	for i, policy := range l.policies {
+		key := "/" + strings.Join(handleURI(policy.URI), "/")
+		if j, ok := seen[key]; ok {
+			l.overwritten[j] = true
+			l.report(Finding{Check: CheckDuplicateURI, Severity: Error, Policy: i, Group: -1,
+				Message: fmt.Sprintf("overwrites policy %d of the same uri", j)})
+		}
+		seen[key] = i
+	}
+	for i := range l.policies {
+		for j := i + 1; j < len(l.policies); j++ {
+			if l.patterns[i] == nil || l.patterns[j] == nil || !l.distinct(i, j) {
+				continue
+			}
+			if covers(l.patterns[i], l.patterns[j]) && covers(l.patterns[j], l.patterns[i]) {
+				l.report(Finding{Check: CheckDuplicateURI, Severity: Warning, Policy: j, Group: -1,
+					Message: fmt.Sprintf("matches the same uris as %s", l.policies[i].URI)})
+			}
+		}
+	}
+}
+
+// distinct shows whether policies i and j are both in effect and are not of the same URI.
+func (l *linter) distinct(i, j int) bool {
+	if l.overwritten[i] || l.overwritten[j] {
+		return false
+	}
+	return "/"+strings.Join(handleURI(l.policies[i].URI), "/") != "/"+strings.Join(handleURI(l.policies[j].URI), "/")
+}
+
+// groups checks groups of policy i against each other.
+func (l *linter) groups(i int) {
+	groups := l.policies[i].Groups
+	for g, group := range groups {
+		if group.Operation == Nil || len(group.RoleID) == 0 {
+			l.report(Finding{Check: CheckUnreachable, Severity: Warning, Policy: i, Group: g,
+				Message: fmt.Sprintf("group %d has no operation or no role", g)})
+			continue
+		}
+		if group.Effect == Allow && group.Operation&CRUD == CRUD && isRootDeep(l.patterns[i]) {
+			l.report(Finding{Check: CheckBroadGrant, Severity: Warning, Policy: i, Group: g,
+				Message: fmt.Sprintf("group %d grants %s on every uri to %v", g, group.Operation, group.RoleID)})
+		}
+		for h, other := range groups {
+			if h == g || len(other.Conditions) > 0 || !includesGroup(other, group) {
+				continue
+			}
+			switch {
+			case l.algorithm == FirstApplicable && h < g:
+				l.report(Finding{Check: CheckShadowed, Severity: Warning, Policy: i, Group: g,
+					Message: fmt.Sprintf("group %d is never applied, as group %d applies first", g, h)})
+			case l.algorithm != FirstApplicable && overrides(l.algorithm, other.Effect) && group.Effect != other.Effect:
+				l.report(Finding{Check: CheckShadowed, Severity: Warning, Policy: i, Group: g,
+					Message: fmt.Sprintf("group %d is overridden by %s of group %d", g, other.Effect, h)})
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+// shadows checks policy j against policy i, which matches every uri j matches.
+func (l *linter) shadows(i, j int) {
+	if l.algorithm == MostSpecific {
+		// The most specific policy decides alone.
+		return
+	}
+	broad, narrow := l.policies[i], l.policies[j]
+	for g, group := range narrow.Groups {
+		for h, other := range broad.Groups {
+			if len(other.Conditions) == 0 && group.Effect != other.Effect &&
+				overrides(l.algorithm, other.Effect) && l.algorithm != FirstApplicable && includesGroup(other, group) {
+				l.report(Finding{Check: CheckShadowed, Severity: Warning, Policy: j, Group: g,
+					Message: fmt.Sprintf("group %d is overridden by %s of group %d of %s", g, other.Effect, h, broad.URI)})
+				break
+			}
+		}
+	}
+
+	// A broad allow bypasses a narrow policy which restricts the same operation to other roles.
+	for h, other := range broad.Groups {
+		if other.Effect != Allow || len(other.Conditions) > 0 {
+			continue
+		}
+		var (
+			bypassed []int64
+			ops      Operation
+		)
+		for _, id := range other.RoleID {
+			for bit := Operation(1); bit != 0 && bit <= other.Operation; bit <<= 1 {
+				if other.Operation&bit == 0 || !restricts(narrow.Groups, bit, id) {
+					continue
+				}
+				if !containsID(bypassed, id) {
+					bypassed = append(bypassed, id)
+				}
+				ops |= bit
+			}
+		}
+		if len(bypassed) > 0 {
+			l.report(Finding{Check: CheckShadowed, Severity: Warning, Policy: j, Group: -1,
+				Message: fmt.Sprintf("group %d of %s still grants %s to %v, which this policy does not grant it to",
+					h, broad.URI, ops, bypassed)})
+		}
+	}
+}
+
+// restricts shows whether groups allow op to some roles, but neither allow nor deny it to id.
+func restricts(groups []PermissionGroup, op Operation, id int64) bool {
+	restricted := false
+	for _, group := range groups {
+		if !group.include(op) {
+			continue
+		}
+		if containsID(group.RoleID, id) {
+			return false
+		}
+		restricted = restricted || group.Effect == Allow
+	}
+	return restricted
+}
+
+// roles checks role ids of policies and permissions of roles.
+func (l *linter) roles(roles []Role) {
+	defined := make(map[int64]Role, len(roles))
+	for _, role := range roles {
+		defined[role.ID()] = role
+	}
+	granted := make(map[int64]bool)
+	for i, policy := range l.policies {
+		for g, group := range policy.Groups {
+			for _, id := range group.RoleID {
+				if defined[id] == nil {
+					l.report(Finding{Check: CheckUnknownRole, Severity: Error, Policy: i, Group: g, RoleID: id,
+						Message: fmt.Sprintf("group %d refers to undefined role %d", g, id)})
+				} else if group.Effect == Allow && group.Operation != Nil {
+					granted[id] = true
+				}
+			}
+		}
+	}
+
+	for _, role := range roles {
+		if parent := role.ParentID(); parent != 0 && defined[parent] == nil {
+			l.report(Finding{Check: CheckUnknownRole, Severity: Error, Policy: -1, Group: -1, RoleID: role.ID(),
+				Message: fmt.Sprintf("role %d has undefined parent %d", role.ID(), parent)})
+		}
+		for _, p := range listPermissions(role) {
+			if p.Effect != Allow {
+				continue
+			}
+			granted[role.ID()] = true
+			if err := ValidatePattern(p.URI); err != nil {
+				l.report(Finding{Check: CheckInvalidPattern, Severity: Error, URI: p.URI, Policy: -1, Group: -1,
+					RoleID: role.ID(), Message: err.Error()})
+			} else if p.Operation&CRUD == CRUD && isRootDeep(parsePattern(p.URI)) {
+				l.report(Finding{Check: CheckBroadGrant, Severity: Warning, URI: p.URI, Policy: -1, Group: -1,
+					RoleID: role.ID(), Message: fmt.Sprintf("role %d is granted %s on every uri", role.ID(), p.Operation)})
+			}
+		}
+	}
+
+	// A parent is granted what its children are with ParentInherits, and a child what its parent is with ChildInherits.
+	inherited := make(map[int64]bool)
+	for _, role := range roles {
+		visited := map[int64]bool{role.ID(): true}
+		for parent := defined[role.ParentID()]; parent != nil && !visited[parent.ID()]; parent = defined[parent.ParentID()] {
+			visited[parent.ID()] = true
+			switch {
+			case l.inheritance == ParentInherits && granted[role.ID()]:
+				inherited[parent.ID()] = true
+			case l.inheritance == ChildInherits && granted[parent.ID()]:
+				inherited[role.ID()] = true
+			}
+		}
+	}
+	for _, role := range roles {
+		if !granted[role.ID()] && !inherited[role.ID()] {
+			l.report(Finding{Check: CheckUnusedRole, Severity: Warning, Policy: -1, Group: -1, RoleID: role.ID(),
+				Message: fmt.Sprintf("role %d is granted nothing", role.ID())})
+		}
+	}
+}
+
+// listPermissions returns permissions of a role if they can be listed.
+func listPermissions(role Role) []StandardPermission {
+	var permissions Permissions = role
+	if standard, ok := role.(*StandardRole); ok {
+		permissions = standard.Permissions
+	}
+	if lister, ok := permissions.(interface{ Permissions() []StandardPermission }); ok {
+		return lister.Permissions()
+	}
+	return nil
+}
+
+// overrides shows whether rules of effect override the others under algorithm, within or across policies.
+func overrides(algorithm CombiningAlgorithm, effect Effect) bool {
+	if algorithm == PermitOverrides {
+		return effect == Allow
+	}
+	return effect == Deny
+}
+
+// includesGroup shows whether group applies to every operation and role of other.
+func includesGroup(group, other PermissionGroup) bool {
+	if !group.include(other.Operation) {
+		return false
+	}
+	for _, id := range other.RoleID {
+		if !containsID(group.RoleID, id) {
+			return false
+		}
+	}
+	return true
+}
+
+func isRootDeep(pattern []segment) bool {
+	return len(pattern) == 1 && pattern[0].kind == deepSegment
+}
+
+// covers shows whether broad matches every URI narrow matches. It may return false for some patterns
+// which do, such as regexps which accept the same strings.
+func covers(broad, narrow []segment) bool {
+	if len(broad) == 0 {
+		return len(narrow) == 0
+	}
+	if broad[0].kind == deepSegment {
+		if len(broad) == 1 {
+			// "**" at the end matches one or more segments, and so does any pattern which is not empty.
+			return len(narrow) > 0
+		}
+		for k := 0; k <= len(narrow); k++ {
+			if covers(broad[1:], narrow[k:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(narrow) == 0 || narrow[0].kind == deepSegment {
+		return false
+	}
+	return coversSegment(&broad[0], &narrow[0]) && covers(broad[1:], narrow[1:])
+}
+
+func coversSegment(broad, narrow *segment) bool {
+	switch broad.kind {
+	case paramSegment, wildcardSegment:
+		return true
+	case staticSegment:
+		return narrow.kind == staticSegment && narrow.path == broad.path
+	case regexpSegment:
+		if narrow.kind == regexpSegment {
+			return narrow.path == broad.path
+		}
+		return narrow.kind == staticSegment && broad.match(narrow.path)
+	}
+	return false
+}
@@ -0,0 +1,163 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// checks returns the check, the uri and the group of every finding.
+func checks(findings Findings) [][3]interface{} {
+	var list [][3]interface{}
+	for _, f := range findings {
+		list = append(list, [3]interface{}{f.Check, f.URI, f.Group})
+	}
+	return list
+}
+
+func TestLint(t *testing.T) {
+	admin := &StandardRole{Id: 1, Name: `admin`, Permissions: NewPermissionTree()}
+	admin.Permissions.(*PermissionTree).Add(&StandardPermission{URI: `/**`, Operation: CRUD})
+	roles := []Role{
+		admin,
+		&StandardRole{Id: 2, Name: `editor`, ParentId: 1},
+		&StandardRole{Id: 3, Name: `viewer`, ParentId: 2},
+		&StandardRole{Id: 4, Name: `nobody`},
+		&StandardRole{Id: 5, Name: `orphan`, ParentId: 9},
+	}
+	policies := []StandardPolicy{
+		{URI: `/**`, Groups: []PermissionGroup{{Operation: CRUD, RoleID: []int64{1}}}},
+		{URI: `/data/**`, Groups: []PermissionGroup{{Operation: Read, RoleID: []int64{3}}}},
+		{URI: `/data/admin/*`, Groups: []PermissionGroup{
+			{Operation: Read, RoleID: []int64{1, 8}},
+			{Operation: Update, RoleID: []int64{2}},
+			{Operation: Update | Delete, RoleID: []int64{2}, Effect: Deny},
+			{Operation: Nil, RoleID: []int64{2}},
+		}},
+		{URI: `/data/{id:[a-z]+}`, Groups: []PermissionGroup{}},
+		{URI: `/data/:id/`, Groups: []PermissionGroup{}},
+		{URI: `/data/{name}`, Groups: []PermissionGroup{}},
+		{URI: `/data/a*`, Groups: []PermissionGroup{}},
+		{URI: `/data/:id`, Groups: []PermissionGroup{}},
+	}
+
+	assert := assert.New(t)
+	findings := Lint(policies, MostSpecific, roles, ParentInherits)
+	assert.Equal([][3]interface{}{
+		{CheckBroadGrant, `/**`, 0},
+		{CheckShadowed, `/data/admin/*`, 1},
+		{CheckUnreachable, `/data/admin/*`, 3},
+		{CheckUnknownRole, `/data/admin/*`, 0},
+		{CheckInvalidPattern, `/data/a*`, -1},
+		{CheckDuplicateURI, `/data/:id`, -1},
+		{CheckDuplicateURI, `/data/:id`, -1},
+		{CheckBroadGrant, `/**`, -1},
+		{CheckUnknownRole, ``, -1},
+		{CheckUnusedRole, ``, -1},
+		{CheckUnusedRole, ``, -1},
+	}, checks(findings))
+	assert.Equal(`warning: /data/admin/*: group 1 is overridden by deny of group 2 [shadowed]`, findings[1].String())
+	assert.Equal(`error: /data/:id: overwrites policy 4 of the same uri [duplicate-uri]`, findings[5].String())
+	assert.Equal(`warning: /data/:id: matches the same uris as /data/{name} [duplicate-uri]`, findings[6].String())
+	assert.Equal(int64(4), findings[9].RoleID)
+	assert.Equal(int64(5), findings[10].RoleID)
+	assert.Equal(Error, findings.Max())
+	assert.Equal(4, len(findings.Filter(Error)))
+	assert.Contains(findings.Err(Error).Error(), "RBAC: policies have problems:\nerror: /data/admin/*:")
+	assert.Nil(Findings(nil).Err(Info))
+}
+
+func TestLint_Shadowed(t *testing.T) {
+	policies := []StandardPolicy{
+		{URI: `/data/**`, Groups: []PermissionGroup{
+			{Operation: CR, RoleID: []int64{3}},
+			{Operation: Delete, RoleID: []int64{2}, Effect: Deny},
+		}},
+		{URI: `/data/admin/*`, Groups: []PermissionGroup{
+			{Operation: Read, RoleID: []int64{1}},
+			{Operation: Delete, RoleID: []int64{2}},
+		}},
+		{URI: `/data/{id:[0-9]+}`, Groups: []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}, Effect: Deny},
+		}},
+	}
+
+	assert := assert.New(t)
+	assert.Empty(Lint(policies, MostSpecific, nil, NoInheritance))
+	assert.Equal([]string{
+		`warning: /data/admin/*: group 1 is overridden by deny of group 1 of /data/** [shadowed]`,
+		`warning: /data/admin/*: group 0 of /data/** still grants read to [3], which this policy does not grant it to [shadowed]`,
+	}, messages(Lint(policies, DenyOverrides, nil, NoInheritance)))
+	assert.Equal([]string{
+		`warning: /data/admin/*: group 0 of /data/** still grants read to [3], which this policy does not grant it to [shadowed]`,
+		`warning: /data/{id:[0-9]+}: group 0 is overridden by allow of group 0 of /data/** [shadowed]`,
+	}, messages(Lint(policies, PermitOverrides, nil, NoInheritance)))
+
+	policies = []StandardPolicy{
+		{URI: `/data`, Groups: []PermissionGroup{
+			{Operation: CRU, RoleID: []int64{1, 2}},
+			{Operation: Read, RoleID: []int64{2}, Effect: Deny},
+		}},
+	}
+	assert.Equal([]string{
+		`warning: /data: group 1 is never applied, as group 0 applies first [shadowed]`,
+	}, messages(Lint(policies, FirstApplicable, nil, NoInheritance)))
+}
+
+func TestLint_Inheritance(t *testing.T) {
+	roles := []Role{
+		&StandardRole{Id: 1, Name: `admin`},
+		&StandardRole{Id: 2, Name: `editor`, ParentId: 1},
+		&StandardRole{Id: 3, Name: `viewer`, ParentId: 2},
+	}
+	policies := []StandardPolicy{
+		{URI: `/data/**`, Groups: []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}},
+	}
+	unused := func(inheritance Inheritance) []int64 {
+		var roleID []int64
+		for _, f := range Lint(policies, MostSpecific, roles, inheritance) {
+			if f.Check == CheckUnusedRole {
+				roleID = append(roleID, f.RoleID)
+			}
+		}
+		return roleID
+	}
+
+	assert := assert.New(t)
+	assert.Equal([]int64{1, 3}, unused(NoInheritance))
+	assert.Equal([]int64{3}, unused(ParentInherits))
+	assert.Equal([]int64{1}, unused(ChildInherits))
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		broad, narrow string
+		covers        bool
+	}{
+		{`/**`, `/a/b`, true},
+		{`/**`, `/**`, true},
+		{`/**`, `/`, false},
+		{`/a/**`, `/a`, false},
+		{`/a/**/c`, `/a/c`, true},
+		{`/a/**/c`, `/a/b/**/c`, true},
+		{`/a/*`, `/a/**`, false},
+		{`/a/:id`, `/a/{n:[0-9]+}`, true},
+		{`/a/{n:[0-9]+}`, `/a/12`, true},
+		{`/a/{n:[0-9]+}`, `/a/b`, false},
+		{`/a/{n:[0-9]+}`, `/a/:id`, false},
+		{`/a/b`, `/a/b/c`, false},
+	}
+
+	assert := assert.New(t)
+	for _, test := range tests {
+		assert.Equal(test.covers, covers(parsePattern(test.broad), parsePattern(test.narrow)), test.broad+` `+test.narrow)
+	}
+}
+
+func messages(findings Findings) []string {
+	var list []string
+	for _, f := range findings {
+		list = append(list, f.String())
+	}
+	return list
+}
@@ -1,24 +1,127 @@
 package rbac
 
-import "github.com/gin-gonic/gin"
+import (
+	"net"
+	"net/http"
+	"time"
 
-func (ac *AccessControl) Authorizer() gin.HandlerFunc {
+	"github.com/gin-gonic/gin"
+)
+
+// RoleExtractor returns ids of roles the user who sends a request has.
+// It should return false if the user is not authenticated.
+type RoleExtractor func(c *gin.Context) (roleID []int64, ok bool)
+
+// UserInfoRoles returns a RoleExtractor which reads role ids from the field key of
+// "user_info", which is set by jwt.Token.Authenticator from data of a token.
+// The Authenticator must be used before the middleware extracting roles, such as Enforcer.
+func UserInfoRoles(key string) RoleExtractor {
+	return func(c *gin.Context) ([]int64, bool) {
+		value, ok := c.Get("user_info")
+		if !ok {
+			return nil, false
+		}
+		info, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		return RoleIDs(info[key])
+	}
+}
+
+// Authorizer only records roles required by policies into "role_id" and "need_auth",
+// and leaves the decision to handlers. If extract is given, roles of the user are also decided
+// like Enforcer, and the decision is recorded into "granted", the audit sink and the metrics,
+// but the request is never aborted.
+func (ac *AccessControl) Authorizer(extract ...RoleExtractor) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var operation Operation
-		switch c.Request.Method {
-		case "GET":
-			operation = Read
-		case "POST":
-			operation = Create
-		case "PUT":
-			operation = Update
-		case "DELETE":
-			operation = Delete
-		default:
+		operation, ok := ac.MethodOperation(c.Request.Method)
+		if !ok {
 			return
 		}
-		roleID, required := ac.Require(c.Request.URL.Path, operation)
+		uri := c.Request.URL.Path
+		roleID, required := ac.require(c.Request.Context(), uri, operation)
 		c.Set("role_id", roleID)
 		c.Set("need_auth", required)
+		if !required || len(extract) == 0 {
+			return
+		}
+
+		userRoleID, ok := extract[0](c)
+		if !ok {
+			ac.recordDecision(uri, operation, nil, c.ClientIP(), false, "user is not authenticated")
+			c.Set("granted", false)
+			return
+		}
+		decision := ac.Authorize(c.Request.Context(), &Request{
+			URI:       uri,
+			Operation: operation,
+			Subject:   GinSubject(c, userRoleID),
+			Env:       Environment{Time: time.Now(), IP: net.ParseIP(c.ClientIP())},
+		})
+		c.Set("granted", decision.Granted)
+	}
+}
+
+// Enforcer rejects a request unless the user has a role required by policies
+// or a role superior to one of them, unless SetHierarchy of the policies decides how roles inherit.
+// It aborts with 401 if roles of the user can not be extracted, and with 403 if none of them is granted.
+// Roles are extracted from what middlewares used before it set, such as jwt.Token.Authenticator.
+func (ac *AccessControl) Enforcer(extract RoleExtractor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ac.enforce(c, extract, "")
+	}
+}
+
+// enforce authorizes a request within a tenant, see Enforcer.
+func (ac *AccessControl) enforce(c *gin.Context, extract RoleExtractor, tenant string) {
+	operation, ok := ac.MethodOperation(c.Request.Method)
+	if !ok {
+		return
+	}
+	uri := c.Request.URL.Path
+	required, needAuth := ac.require(c.Request.Context(), uri, operation)
+	c.Set("role_id", required)
+	c.Set("need_auth", needAuth)
+	if !needAuth {
+		return
+	}
+
+	roleID, ok := extract(c)
+	if !ok {
+		ac.recordDecision(uri, operation, nil, c.ClientIP(), false, "user is not authenticated")
+		c.AbortWithStatus(http.StatusUnauthorized)
+		return
+	}
+	sub := GinSubject(c, roleID)
+	sub.Tenant = tenant
+	decision := ac.Authorize(c.Request.Context(), &Request{
+		URI:       uri,
+		Operation: operation,
+		Subject:   sub,
+		Env:       Environment{Time: time.Now(), IP: net.ParseIP(c.ClientIP())},
+	})
+	if !decision.Granted {
+		c.AbortWithStatus(http.StatusForbidden)
+	}
+}
+
+// GinSubject builds the subject of a request as the middlewares do, from "user_id" and "user_info",
+// which are set by jwt.Token.Authenticator. Fields of "user_info" become attributes of the subject.
+func GinSubject(c *gin.Context, roleID []int64) Subject {
+	sub := Subject{UserID: c.GetString("user_id"), RoleID: roleID}
+	if info, ok := c.Get("user_info"); ok {
+		sub.Attributes, _ = info.(map[string]interface{})
+	}
+	return sub
+}
+
+// MethodOperation maps a HTTP method onto an Operation by MethodOperations, like the middlewares do.
+func (ac *AccessControl) MethodOperation(method string) (Operation, bool) {
+	methods := ac.MethodOperations
+	if methods == nil {
+		methods = defaultMethodOperations
 	}
+	op, ok := methods[method]
+	return op, ok
 }
@@ -0,0 +1,199 @@
+package rbac
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	Jwt "github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/go-pandora/pkg/auth/jwt/jwttest"
+	"github.com/go-pandora/pkg/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAccessControl_Enforcer(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{3}},
+			{Operation: Delete, RoleID: []int64{1}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{3, `role1`, nil, 1},
+		{5, `role2`, nil, 3},
+		{7, `guest`, nil, 0},
+	}
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	for i := range roles {
+		ac.SetRole(&roles[i])
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if roleID := c.GetHeader("X-Role"); roleID != "" {
+			c.Set("user_info", map[string]interface{}{
+				"role_id": []interface{}{float64(roleID[0] - '0')},
+			})
+		}
+	})
+	router.Use(ac.Enforcer(UserInfoRoles("role_id")))
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	router.GET(`/data/:id`, handler)
+	router.DELETE(`/data/:id`, handler)
+	router.GET(`/public`, handler)
+
+	serve := func(method, uri, roleID string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, uri, nil)
+		if roleID != "" {
+			r.Header.Set("X-Role", roleID)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, serve("GET", `/public`, ``))
+	assert.Equal(http.StatusUnauthorized, serve("GET", `/data/1`, ``))
+	assert.Equal(http.StatusOK, serve("GET", `/data/1`, `3`))
+	assert.Equal(http.StatusOK, serve("GET", `/data/1`, `1`))
+	assert.Equal(http.StatusForbidden, serve("GET", `/data/1`, `5`))
+	assert.Equal(http.StatusForbidden, serve("GET", `/data/1`, `7`))
+	assert.Equal(http.StatusForbidden, serve("DELETE", `/data/1`, `3`))
+	assert.Equal(http.StatusOK, serve("DELETE", `/data/1`, `1`))
+}
+
+func TestAccessControl_Enforcer_Authenticator(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{3}},
+		}},
+	}
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	token := jwttest.NewToken(t, Jwt.SigningMethodHS256, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(token.Authenticator(), ac.Enforcer(UserInfoRoles("role_id")))
+	handler := func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	}
+	router.GET(`/data/:id`, handler)
+	router.POST(`/data/:id`, handler)
+	router.GET(`/public`, handler)
+
+	serve := func(method, uri string, roleID ...int64) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, uri, nil)
+		if roleID != nil {
+			signed, err := token.GenerateToken(`1`, map[string]interface{}{"role_id": roleID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Header.Set(jwttest.Header, signed)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, serve("GET", `/public`))
+	assert.Equal(http.StatusUnauthorized, serve("GET", `/data/1`))
+	assert.Equal(http.StatusOK, serve("GET", `/data/1`, 3))
+	assert.Equal(http.StatusForbidden, serve("GET", `/data/1`, 7))
+	assert.Equal(http.StatusOK, serve("POST", `/data/1`, 3))
+	assert.Equal(http.StatusUnauthorized, serve("POST", `/data/1`))
+}
+
+func TestAccessControl_Authorizer(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+		}},
+	}
+	recorder := metrics.NewMemory()
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.Metrics = recorder
+	ac.LoadPolicies(policies)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if roleID := c.GetHeader("X-Role"); roleID != "" {
+			c.Set("user_info", map[string]interface{}{
+				"role_id": []interface{}{float64(roleID[0] - '0')},
+			})
+		}
+	})
+	var granted []interface{}
+	handler := func(c *gin.Context) {
+		value, _ := c.Get("granted")
+		granted = append(granted, value)
+		c.Status(http.StatusOK)
+	}
+	router.GET(`/plain/*path`, ac.Authorizer(), handler)
+	router.GET(`/data/*path`, ac.Authorizer(UserInfoRoles("role_id")), handler)
+
+	serve := func(uri, roleID string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", uri, nil)
+		if roleID != "" {
+			r.Header.Set("X-Role", roleID)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, serve(`/plain/1`, ``))
+	assert.Equal(http.StatusOK, serve(`/data/1`, `3`))
+	assert.Equal(http.StatusOK, serve(`/data/1`, `5`))
+	assert.Equal(http.StatusOK, serve(`/data/1`, ``))
+	assert.Equal([]interface{}{nil, true, false, false}, granted)
+	assert.Equal(float64(1), recorder.Counter(metricDecisions, metrics.Labels{"decision": "granted"}))
+	assert.Equal(float64(2), recorder.Counter(metricDecisions, metrics.Labels{"decision": "denied"}))
+}
+
+func TestAccessControl_MethodOperations(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+			{Operation: Update, RoleID: []int64{1}},
+		}},
+	}
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+
+	gin.SetMode(gin.TestMode)
+	serve := func(ac *AccessControl, method string) int {
+		router := gin.New()
+		router.Use(func(c *gin.Context) {
+			c.Set("user_info", map[string]interface{}{"role_id": float64(3)})
+		})
+		router.Use(ac.Enforcer(UserInfoRoles("role_id")))
+		router.Handle(method, `/data/:id`, func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, `/data/1`, nil))
+		return w.Code
+	}
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, serve(ac, "HEAD"))
+	assert.Equal(http.StatusOK, serve(ac, "OPTIONS"))
+	assert.Equal(http.StatusForbidden, serve(ac, "PATCH"))
+
+	ac.MethodOperations = DefaultMethodOperations()
+	ac.MethodOperations["OPTIONS"] = Update
+	assert.Equal(http.StatusForbidden, serve(ac, "OPTIONS"))
+}
@@ -1,6 +1,15 @@
 package rbac
 
-type Operation uint8
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Operation is a set of operations, each of which is a bit.
+// Besides CRUD, custom operations can be registered by RegisterOperation.
+type Operation uint32
 
 const (
 	Nil    Operation = 0
@@ -18,3 +27,177 @@ const (
 	RUD  = Read | Update | Delete
 	CRUD = Create | Read | Update | Delete
 )
+
+var (
+	ErrTooManyOperations = errors.New("RBAC: no bit left for a new operation")
+	ErrInvalidOperation  = errors.New("RBAC: invalid operation name")
+	ErrOperationConflict = errors.New("RBAC: operation conflicts with CRUD")
+)
+
+// abbreviations are letters which can be used in place of names of CRUD, like "CR".
+var abbreviations = map[rune]Operation{
+	'C': Create,
+	'R': Read,
+	'U': Update,
+	'D': Delete,
+}
+
+// operationRegistry holds names of operations and the bit a new operation is given.
+type operationRegistry struct {
+	sync.RWMutex
+	names  map[Operation]string
+	byName map[string]Operation
+	next   Operation
+}
+
+// newOperationRegistry returns a registry which holds CRUD only.
+func newOperationRegistry() *operationRegistry {
+	return &operationRegistry{
+		names: map[Operation]string{
+			Create: "create",
+			Read:   "read",
+			Update: "update",
+			Delete: "delete",
+		},
+		byName: map[string]Operation{
+			"create": Create,
+			"read":   Read,
+			"update": Update,
+			"delete": Delete,
+		},
+		next: Delete << 1,
+	}
+}
+
+var operations = newOperationRegistry()
+
+// RegisterOperation registers a custom operation such as "approve" or "export" and returns its bit.
+// Names are case insensitive, and registering a custom name again returns the same operation.
+// Names of CRUD and names which read as abbreviations like "cr" conflict with CRUD,
+// so they are rejected with ErrOperationConflict.
+func RegisterOperation(name string) (Operation, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" || strings.ContainsAny(name, ",| \t") || name == "nil" {
+		return Nil, ErrInvalidOperation
+	}
+	if _, ok := parseAbbreviation(strings.ToUpper(name)); ok {
+		return Nil, fmt.Errorf("%w: %q", ErrOperationConflict, name)
+	}
+	operations.Lock()
+	defer operations.Unlock()
+	if op, ok := operations.byName[name]; ok {
+		if op&CRUD != 0 {
+			return Nil, fmt.Errorf("%w: %q", ErrOperationConflict, name)
+		}
+		return op, nil
+	}
+	if operations.next == 0 {
+		return Nil, ErrTooManyOperations
+	}
+	op := operations.next
+	operations.next <<= 1
+	operations.names[op] = name
+	operations.byName[name] = op
+	return op, nil
+}
+
+// lastOperation returns the highest bit of the operations registered.
+func lastOperation() Operation {
+	operations.RLock()
+	defer operations.RUnlock()
+	if operations.next == 0 {
+		return 1 << 31
+	}
+	return operations.next >> 1
+}
+
+// MustRegisterOperation is like RegisterOperation but panics if the operation can not be registered.
+func MustRegisterOperation(name string) Operation {
+	op, err := RegisterOperation(name)
+	if err != nil {
+		panic(err)
+	}
+	return op
+}
+
+// LookupOperation returns the operation registered with name.
+func LookupOperation(name string) (Operation, bool) {
+	operations.RLock()
+	defer operations.RUnlock()
+	op, ok := operations.byName[strings.ToLower(strings.TrimSpace(name))]
+	return op, ok
+}
+
+// ParseOperation parses operations written as abbreviations like "CR",
+// or as names separated by commas or bars like "create,read" or "read|export".
+func ParseOperation(s string) (Operation, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.EqualFold(s, "nil") {
+		return Nil, nil
+	}
+	if op, ok := parseAbbreviation(s); ok {
+		return op, nil
+	}
+	var op Operation
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '|' }) {
+		o, ok := LookupOperation(name)
+		if !ok {
+			return Nil, fmt.Errorf("RBAC: unknown operation %q", strings.TrimSpace(name))
+		}
+		op |= o
+	}
+	return op, nil
+}
+
+func parseAbbreviation(s string) (Operation, bool) {
+	var op Operation
+	for _, r := range s {
+		o, ok := abbreviations[r]
+		if !ok {
+			return Nil, false
+		}
+		op |= o
+	}
+	return op, true
+}
+
+// Names returns names of all operations included in op, from the lowest bit.
+func (op Operation) Names() []string {
+	operations.RLock()
+	defer operations.RUnlock()
+	var names []string
+	for bit := Operation(1); bit != 0; bit <<= 1 {
+		if op&bit == 0 {
+			continue
+		}
+		if name, ok := operations.names[bit]; ok {
+			names = append(names, name)
+		} else {
+			names = append(names, fmt.Sprintf("%#x", uint32(bit)))
+		}
+	}
+	return names
+}
+
+// String returns names of operations joined by bars, such as "create|read".
+func (op Operation) String() string {
+	if op == Nil {
+		return "nil"
+	}
+	return strings.Join(op.Names(), "|")
+}
+
+var defaultMethodOperations = DefaultMethodOperations()
+
+// DefaultMethodOperations returns the operation each HTTP method is mapped onto by default.
+func DefaultMethodOperations() map[string]Operation {
+	return map[string]Operation{
+		"GET":     Read,
+		"HEAD":    Read,
+		"OPTIONS": Read,
+		"POST":    Create,
+		"PUT":     Update,
+		"PATCH":   Update,
+		"DELETE":  Delete,
+	}
+}
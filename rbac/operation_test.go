@@ -0,0 +1,97 @@
+package rbac
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOperation_String(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal(`nil`, Nil.String())
+	assert.Equal(`read`, Read.String())
+	assert.Equal(`create|read|update|delete`, CRUD.String())
+	assert.Equal(`/data/* create|read|update`, StandardPermission{URI: `/data/*`, Operation: CRU}.String())
+	assert.Equal(`read [1 2]`, PermissionGroup{Operation: Read, RoleID: []int64{1, 2}}.String())
+}
+
+// resetOperations forgets operations registered by a test when it finishes.
+func resetOperations(t *testing.T) {
+	t.Cleanup(func() {
+		registry := newOperationRegistry()
+		operations.Lock()
+		defer operations.Unlock()
+		operations.names, operations.byName, operations.next = registry.names, registry.byName, registry.next
+	})
+}
+
+func TestRegisterOperation(t *testing.T) {
+	resetOperations(t)
+	approve := MustRegisterOperation(`approve`)
+	export := MustRegisterOperation(`Export`)
+
+	assert := assert.New(t)
+	again, err := RegisterOperation(`APPROVE`)
+	assert.NoError(err)
+	assert.Equal(approve, again)
+	assert.NotEqual(approve, export)
+	assert.Zero(approve & CRUD)
+	assert.Equal(`read|approve|export`, (Read | approve | export).String())
+
+	_, err = RegisterOperation(`read,write`)
+	assert.Equal(ErrInvalidOperation, err)
+	for _, name := range []string{`Read`, `delete`, `cr`, `RUD`} {
+		_, err = RegisterOperation(name)
+		assert.True(errors.Is(err, ErrOperationConflict), name)
+	}
+
+	permission := StandardPermission{URI: `/orders/*`, Operation: Read | approve}
+	assert.True(permission.Include(approve))
+	assert.False(permission.Include(export))
+
+	group := PermissionGroup{Operation: Read | export, RoleID: []int64{1}}
+	assert.True(group.include(export))
+	assert.Equal(`read|export [1]`, group.String())
+}
+
+func TestResetOperations(t *testing.T) {
+	t.Run(`register`, func(t *testing.T) {
+		resetOperations(t)
+		MustRegisterOperation(`archive`)
+	})
+
+	assert := assert.New(t)
+	_, ok := LookupOperation(`archive`)
+	assert.False(ok)
+	_, err := ParseOperation(`read,archive`)
+	assert.Error(err)
+	assert.Equal(Delete<<1, MustRegisterOperation(`archive`))
+	resetOperations(t)
+}
+
+func TestParseOperation(t *testing.T) {
+	resetOperations(t)
+	publish := MustRegisterOperation(`publish`)
+
+	cases := []struct {
+		s  string
+		op Operation
+	}{
+		{`CR`, CR},
+		{`CRUD`, CRUD},
+		{`create,read`, CR},
+		{` read | update `, RU},
+		{`read,publish`, Read | publish},
+		{``, Nil},
+	}
+
+	assert := assert.New(t)
+	for _, c := range cases {
+		op, err := ParseOperation(c.s)
+		assert.NoError(err, c.s)
+		assert.Equal(c.op, op, c.s)
+	}
+	_, err := ParseOperation(`read,fly`)
+	assert.Error(err)
+}
@@ -0,0 +1,201 @@
+package rbac
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Param is a path parameter matched by a ":name" or "{name:regexp}" segment of a pattern.
+type Param struct {
+	Key   string
+	Value string
+}
+
+type Params []Param
+
+// Get returns the value of the first parameter called key.
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// segmentKind is the kind of a segment of a pattern.
+// Kinds are declared from the most specific to the least specific,
+// which is the order segments are tried when a URI is matched.
+type segmentKind uint8
+
+const (
+	staticSegment   segmentKind = iota // data
+	regexpSegment                      // {id:[0-9]+}
+	paramSegment                       // :id or {id}
+	wildcardSegment                    // *
+	deepSegment                        // **
+)
+
+var segmentKinds = []segmentKind{staticSegment, regexpSegment, paramSegment, wildcardSegment, deepSegment}
+
+// segment is a parsed segment of a pattern.
+type segment struct {
+	kind segmentKind
+	name string
+	re   *regexp.Regexp
+	path string
+}
+
+// parseSegment parses a segment of a pattern.
+// A regexp which can not be compiled makes a segment which matches nothing.
+func parseSegment(path string) segment {
+	seg, err := compileSegment(path)
+	if err != nil {
+		return segment{kind: regexpSegment, path: path}
+	}
+	return seg
+}
+
+func compileSegment(path string) (segment, error) {
+	switch {
+	case path == `**`:
+		return segment{kind: deepSegment, path: path}, nil
+	case path == `*`:
+		return segment{kind: wildcardSegment, path: path}, nil
+	case strings.HasPrefix(path, `:`) && len(path) > 1:
+		return segment{kind: paramSegment, name: path[1:], path: path}, nil
+	case strings.HasPrefix(path, `{`) && strings.HasSuffix(path, `}`):
+		body := path[1 : len(path)-1]
+		i := strings.IndexByte(body, ':')
+		if i < 0 {
+			if body == "" {
+				return segment{}, fmt.Errorf("RBAC: empty parameter in %q", path)
+			}
+			return segment{kind: paramSegment, name: body, path: path}, nil
+		}
+		if i == 0 {
+			return segment{}, fmt.Errorf("RBAC: unnamed parameter in %q", path)
+		}
+		re, err := regexp.Compile(`^(?:` + body[i+1:] + `)$`)
+		if err != nil {
+			return segment{}, fmt.Errorf("RBAC: invalid regexp in %q: %s", path, err)
+		}
+		return segment{kind: regexpSegment, name: body[:i], re: re, path: path}, nil
+	case strings.Contains(path, `*`):
+		return segment{}, fmt.Errorf("RBAC: wildcard must be a whole segment in %q", path)
+	default:
+		return segment{kind: staticSegment, path: path}, nil
+	}
+}
+
+// ValidatePattern checks whether every segment of a pattern is well formed.
+func ValidatePattern(uri string) error {
+	for _, path := range handleURI(uri) {
+		if _, err := compileSegment(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// match shows whether a segment of a URI matches s. It must not be called on a deep segment.
+func (s *segment) match(path string) bool {
+	switch s.kind {
+	case staticSegment:
+		return s.path == path
+	case regexpSegment:
+		return s.re != nil && s.re.MatchString(path)
+	default:
+		return true
+	}
+}
+
+// param appends the parameter captured by s to params.
+func (s *segment) param(params Params, path string) Params {
+	if s.kind == regexpSegment || s.kind == paramSegment {
+		return append(params, Param{s.name, path})
+	}
+	return params
+}
+
+// matchPattern matches paths of a URI against a parsed pattern.
+// "**" matches one or more segments at the end of a pattern and zero or more segments elsewhere.
+func matchPattern(pattern []segment, paths []string, params *Params) bool {
+	if len(pattern) == 0 {
+		return len(paths) == 0
+	}
+	seg := &pattern[0]
+	if seg.kind == deepSegment {
+		if len(pattern) == 1 {
+			return len(paths) > 0
+		}
+		for k := 0; k <= len(paths); k++ {
+			if matchPattern(pattern[1:], paths[k:], params) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(paths) == 0 || !seg.match(paths[0]) {
+		return false
+	}
+	n := len(*params)
+	*params = seg.param(*params, paths[0])
+	if matchPattern(pattern[1:], paths[1:], params) {
+		return true
+	}
+	*params = (*params)[:n]
+	return false
+}
+
+func parsePattern(uri string) []segment {
+	paths := handleURI(uri)
+	pattern := make([]segment, len(paths))
+	for i, path := range paths {
+		pattern[i] = parseSegment(path)
+	}
+	return pattern
+}
+
+// patternNode is a node of a tree of patterns, such as PolicyTree and PermissionTree.
+type patternNode[N any] interface {
+	segment() *segment
+	nodes() []N
+}
+
+// searchTree calls visit for every node below n which matches paths entirely, from the most specific one,
+// until visit returns true. It shows whether visit has returned true.
+func searchTree[N patternNode[N]](n N, paths []string, params Params, visit func(N, Params) bool) bool {
+	if len(paths) == 0 {
+		return visit(n, params)
+	}
+	return searchChildren(n, paths, params, visit)
+}
+
+func searchChildren[N patternNode[N]](n N, paths []string, params Params, visit func(N, Params) bool) bool {
+	for _, kind := range segmentKinds {
+		for _, child := range n.nodes() {
+			seg := child.segment()
+			if seg.kind != kind {
+				continue
+			}
+			if kind == deepSegment {
+				// Try the rest of the pattern after "**" consumed k segments, then "**" as the end of it.
+				for k := 0; k < len(paths); k++ {
+					if searchChildren(child, paths[k:], params, visit) {
+						return true
+					}
+				}
+				if visit(child, params) {
+					return true
+				}
+				continue
+			}
+			if seg.match(paths[0]) && searchTree(child, paths[1:], seg.param(params, paths[0]), visit) {
+				return true
+			}
+		}
+	}
+	return false
+}
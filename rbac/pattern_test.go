@@ -0,0 +1,112 @@
+package rbac
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStandardPermission_MatchParams(t *testing.T) {
+	assert := assert.New(t)
+
+	permission := StandardPermission{URI: `/a/*/b`, Operation: Read}
+	assert.True(permission.Match(`/a/x/b`))
+	assert.False(permission.Match(`/a/b`))
+	assert.False(permission.Match(`/a/x/y/b`))
+	assert.False(permission.Match(`/a/x/bb`))
+
+	permission = StandardPermission{URI: `/users/:id/orders/{order:[0-9]+}`, Operation: Read}
+	params, ok := permission.MatchParams(`/users/alice/orders/17`)
+	assert.True(ok)
+	assert.Equal(Params{{`id`, `alice`}, {`order`, `17`}}, params)
+	_, ok = permission.MatchParams(`/users/alice/orders/latest`)
+	assert.False(ok)
+
+	permission = StandardPermission{URI: `/data/**/raw`, Operation: Read}
+	assert.True(permission.Match(`/data/raw`))
+	assert.True(permission.Match(`/data/image/raw`))
+	assert.True(permission.Match(`/data/image/2019/raw`))
+	assert.False(permission.Match(`/data/image/2019`))
+}
+
+func TestValidatePattern(t *testing.T) {
+	assert := assert.New(t)
+	assert.NoError(ValidatePattern(`/users/:id/{file:[a-z]+\.txt}/**`))
+	assert.Error(ValidatePattern(`/users/a*`))
+	assert.Error(ValidatePattern(`/users/{:[0-9]+}`))
+	assert.Error(ValidatePattern(`/users/{id:[0-9+}`))
+}
+
+func TestPolicyTree_RequireParams(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/orders/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{1}},
+		}},
+		{`/orders/*`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{2}},
+		}},
+		{`/orders/:id`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+		}},
+		{`/orders/{id:[0-9]+}`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{4}},
+		}},
+		{`/orders/latest`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{5}},
+		}},
+		{`/orders/**/items/:item`, []PermissionGroup{
+			{Operation: Update, RoleID: []int64{6}},
+		}},
+	}
+
+	tree := NewPolicyTree()
+	tree.LoadPolicies(policies)
+
+	assert := assert.New(t)
+	roleID, params, required := tree.RequireParams(`/orders/latest`, Read)
+	assert.True(required)
+	assert.Equal([]int64{5}, roleID)
+	assert.Empty(params)
+
+	roleID, params, _ = tree.RequireParams(`/orders/17`, Read)
+	assert.Equal([]int64{4}, roleID)
+	assert.Equal(Params{{`id`, `17`}}, params)
+
+	roleID, params, _ = tree.RequireParams(`/orders/abc`, Read)
+	assert.Equal([]int64{3}, roleID)
+	id, _ := params.Get(`id`)
+	assert.Equal(`abc`, id)
+
+	roleID, _, _ = tree.RequireParams(`/orders/abc/1`, Read)
+	assert.Equal([]int64{1}, roleID)
+
+	roleID, params, _ = tree.RequireParams(`/orders/2019/03/items/7`, Update)
+	assert.Equal([]int64{6}, roleID)
+	assert.Equal(Params{{`item`, `7`}}, params)
+
+	// A more specific policy which grants nothing for an operation gives way to a less specific one.
+	roleID, _ = tree.Require(`/orders/17`, Update)
+	assert.Empty(roleID)
+}
+
+func TestPermissionTree_Params(t *testing.T) {
+	permissions := PermissionList{
+		{URI: `/users/:id`, Operation: Read},
+		{URI: `/users/me`, Operation: CRUD},
+		{URI: `/files/**/{name:[a-z]+\.txt}`, Operation: Read},
+	}
+
+	tree := NewPermissionTree()
+	tree.Load(permissions)
+
+	assert := assert.New(t)
+	assert.True(tree.HasPermission(`/users/me`, Delete))
+	assert.False(tree.HasPermission(`/users/42`, Delete))
+	params, ok := tree.HasPermissionParams(`/users/42`, Read)
+	assert.True(ok)
+	assert.Equal(Params{{`id`, `42`}}, params)
+
+	assert.True(tree.HasPermission(`/files/a/b/readme.txt`, Read))
+	assert.True(tree.Match(`/files/readme.txt`))
+	assert.False(tree.Match(`/files/a/readme.md`))
+}
@@ -17,34 +17,77 @@ type Permission interface {
 type StandardPermission struct {
 	URI       string
 	Operation Operation
+
+	// Effect shows whether the permission grants or forbids the operation.
+	Effect Effect
+
+	// pattern is URI parsed by a PermissionList, which parses it once when the permission is added.
+	pattern *parsedURI
+}
+
+// parsedURI keeps the segments of a pattern with the URI they are parsed from,
+// so that a permission whose URI is changed afterwards parses it again.
+type parsedURI struct {
+	uri      string
+	segments []segment
+}
+
+// compile parses the URI of the permission once for MatchParams.
+func (p *StandardPermission) compile() {
+	if p.pattern == nil || p.pattern.uri != p.URI {
+		p.pattern = &parsedURI{uri: p.URI, segments: parsePattern(p.URI)}
+	}
 }
 
 func (p *StandardPermission) GetPermission() (uri string, op Operation) {
 	return p.URI, p.Operation
 }
 
+func (p *StandardPermission) GetEffect() Effect {
+	return p.Effect
+}
+
+// effectOf returns the effect of a permission which implements GetEffect, or Allow.
+func effectOf(permission Permission) Effect {
+	if p, ok := permission.(interface{ GetEffect() Effect }); ok {
+		return p.GetEffect()
+	}
+	return Allow
+}
+
 func (p *StandardPermission) Match(uri string) bool {
+	_, ok := p.MatchParams(uri)
+	return ok
+}
+
+// MatchParams matches uri like Match and returns parameters captured by the pattern.
+// The pattern is parsed on every call, unless the permission is held by a PermissionList.
+func (p *StandardPermission) MatchParams(uri string) (Params, bool) {
 	if p.URI == uri {
-		return true
+		return nil, true
 	}
-
-	if strings.Contains(p.URI, `/**`) {
-		matcher := strings.ReplaceAll(p.URI, `/**`, ``)
-		return strings.HasPrefix(uri, matcher)
+	segments := p.pattern
+	if segments == nil || segments.uri != p.URI {
+		segments = &parsedURI{uri: p.URI, segments: parsePattern(p.URI)}
 	}
-
-	if strings.Contains(p.URI, `/*`) {
-		matcher := strings.ReplaceAll(p.URI, `/*`, ``)
-		index := strings.LastIndex(uri, `/`)
-		return uri[0:index] == matcher
+	var params Params
+	if matchPattern(segments.segments, handleURI(uri), &params) {
+		return params, true
 	}
-	return false
+	return nil, false
 }
 
 func (p *StandardPermission) Include(op Operation) bool {
 	return (p.Operation & op) == op
 }
 
+func (p StandardPermission) String() string {
+	if p.Effect == Deny {
+		return "deny " + p.URI + " " + p.Operation.String()
+	}
+	return p.URI + " " + p.Operation.String()
+}
+
 type Permissions interface {
 	// Add will add a new permission into Permissions.
 	Add(Permission)
@@ -66,29 +109,46 @@ func NewPermissionList() *PermissionList {
 func (l *PermissionList) Load(permissions []StandardPermission) {
 	l.Destroy()
 	*l = PermissionList(permissions)
-	//for uri, op := range permissions {
-	//	l.add(uri, op)
-	//}
+	for i := range *l {
+		(*l)[i].compile()
+	}
 }
 
 func (l *PermissionList) Add(permission Permission) {
 	uri, op := permission.GetPermission()
-	*l = append(*l, StandardPermission{uri, op})
+	p := StandardPermission{URI: uri, Operation: op, Effect: effectOf(permission)}
+	p.compile()
+	*l = append(*l, p)
 }
 
+// HasPermission shows whether a permission matching uri includes op and no deny permission forbids any part of op.
 func (l *PermissionList) HasPermission(uri string, op Operation) (flag bool) {
 	for _, permission := range *l {
 		if !permission.Match(uri) {
 			continue
 		}
+		if permission.Effect == Deny {
+			if permission.Operation&op != 0 {
+				return false
+			}
+			continue
+		}
 		if permission.Include(op) {
 			flag = true
-			break
 		}
 	}
 	return
 }
 
+// Permissions returns all permissions of the list.
+func (l *PermissionList) Permissions() []StandardPermission {
+	permissions := append([]StandardPermission(nil), *l...)
+	for i := range permissions {
+		permissions[i].pattern = nil
+	}
+	return permissions
+}
+
 func (l *PermissionList) Destroy() {
 	*l = PermissionList{}
 }
@@ -96,7 +156,11 @@ func (l *PermissionList) Destroy() {
 type PermissionTree struct {
 	path      string
 	operation Operation
+	denied    Operation
 	children  []*PermissionTree
+	seg       segment
+	leaf      bool
+	allowed   bool
 }
 
 func NewPermissionTree() (root *PermissionTree) {
@@ -107,31 +171,24 @@ func NewPermissionTree() (root *PermissionTree) {
 	return
 }
 
+func (t *PermissionTree) segment() *segment {
+	return &t.seg
+}
+
+func (t *PermissionTree) nodes() []*PermissionTree {
+	return t.children
+}
+
+// Match shows whether uri matches a path of the tree, including paths which only lead to permissions.
+// A "**" in the middle of a pattern does not match the rest of a URI by itself.
 func (t *PermissionTree) Match(uri string) bool {
 	paths := handleURI(uri)
-search:
-	for i, path := range paths {
-		for _, child := range t.children {
-			switch child.path {
-			case `**`:
-				return true
-			case `*`:
-				if i == len(paths)-1 {
-					return true
-				}
-			default:
-				if child.path == path {
-					if i == len(paths)-1 {
-						return true
-					}
-					t = child
-					continue search
-				}
-			}
-		}
-		break
+	if len(paths) == 0 {
+		return false
 	}
-	return false
+	return searchTree(t, paths, nil, func(node *PermissionTree, _ Params) bool {
+		return node.leaf || node.seg.kind != deepSegment
+	})
 }
 
 func (t *PermissionTree) Include(op Operation) bool {
@@ -147,6 +204,7 @@ func (t *PermissionTree) Load(permissions []StandardPermission) {
 
 func (t *PermissionTree) Add(permission Permission) {
 	uri, op := permission.GetPermission()
+	effect := effectOf(permission)
 	paths := handleURI(uri)
 insert:
 	for j, path := range paths {
@@ -154,20 +212,24 @@ insert:
 			if child.path == path {
 				t = child
 				if j == len(paths)-1 {
-					child.operation = op
+					child.set(op, effect)
 				}
 				continue insert
 			}
 		}
 		if j == len(paths)-1 {
-			t.children = append(t.children, &PermissionTree{
+			child := &PermissionTree{
 				path:      path,
-				operation: op,
-			})
+				operation: Nil,
+				seg:       parseSegment(path),
+			}
+			child.set(op, effect)
+			t.children = append(t.children, child)
 		} else {
 			t.children = append(t.children, &PermissionTree{
 				path:      path,
 				operation: Nil,
+				seg:       parseSegment(path),
 			})
 		}
 
@@ -179,31 +241,76 @@ insert:
 	}
 }
 
+// set sets the permission of a node. A node can both grant and forbid operations.
+func (t *PermissionTree) set(op Operation, effect Effect) {
+	t.leaf = true
+	if effect == Deny {
+		t.denied = op
+		return
+	}
+	t.operation = op
+	t.allowed = true
+}
+
+// HasPermission shows whether the most specific permission matching uri includes op.
+// A deny permission forbidding any part of op decides first, and one which does not is skipped.
 func (t *PermissionTree) HasPermission(uri string, op Operation) bool {
+	_, ok := t.HasPermissionParams(uri, op)
+	return ok
+}
+
+// HasPermissionParams is like HasPermission and returns parameters captured by the matched permission.
+func (t *PermissionTree) HasPermissionParams(uri string, op Operation) (Params, bool) {
 	paths := handleURI(uri)
-search:
-	for i, path := range paths {
-		for _, child := range t.children {
-			switch child.path {
-			case `**`:
-				return child.Include(op)
-			case `*`:
-				if i == len(paths)-1 {
-					return child.Include(op)
-				}
-			default:
-				if child.path == path {
-					if i == len(paths)-1 {
-						return child.Include(op)
-					}
-					t = child
-					continue search
-				}
-			}
+	if len(paths) == 0 {
+		return nil, false
+	}
+	var (
+		params  Params
+		granted bool
+	)
+	searchTree(t, paths, nil, func(node *PermissionTree, matched Params) bool {
+		if !node.leaf {
+			return false
+		}
+		if node.denied&op != 0 {
+			granted = false
+			return true
 		}
-		break
+		if !node.allowed {
+			return false
+		}
+		params = append(Params(nil), matched...)
+		granted = node.Include(op)
+		return true
+	})
+	if !granted {
+		return nil, false
+	}
+	return params, true
+}
+
+// Permissions returns all permissions of the tree, parents before their children.
+// A path which both grants and forbids operations returns the grant first.
+func (t *PermissionTree) Permissions() []StandardPermission {
+	var permissions []StandardPermission
+	t.walk(``, func(uri string, node *PermissionTree) {
+		if node.allowed {
+			permissions = append(permissions, StandardPermission{URI: uri, Operation: node.operation})
+		}
+		if node.denied != Nil {
+			permissions = append(permissions, StandardPermission{URI: uri, Operation: node.denied, Effect: Deny})
+		}
+	})
+	return permissions
+}
+
+func (t *PermissionTree) walk(prefix string, f func(string, *PermissionTree)) {
+	for _, child := range t.children {
+		uri := prefix + `/` + child.path
+		f(uri, child)
+		child.walk(uri, f)
 	}
-	return false
 }
 
 func (t *PermissionTree) Destroy() {
@@ -215,7 +322,7 @@ func handleURI(uri string) []string {
 	if paths[0] == "" {
 		paths = paths[1:]
 	}
-	if paths[len(paths)-1] == "" {
+	if len(paths) > 0 && paths[len(paths)-1] == "" {
 		paths = paths[:len(paths)-1]
 	}
 	return paths
@@ -6,9 +6,9 @@ import (
 )
 
 func TestStandardPermission_Match(t *testing.T) {
-	permission1 := StandardPermission{`/data/*`, CRU}
-	permission2 := StandardPermission{`/data/**`, CR}
-	permission3 := StandardPermission{`/data`, CRUD}
+	permission1 := StandardPermission{URI: `/data/*`, Operation: CRU}
+	permission2 := StandardPermission{URI: `/data/**`, Operation: CR}
+	permission3 := StandardPermission{URI: `/data`, Operation: CRUD}
 
 	assert := assert.New(t)
 
@@ -25,7 +25,7 @@ func TestStandardPermission_Match(t *testing.T) {
 }
 
 func TestStandardPermission_Include(t *testing.T) {
-	permission1 := StandardPermission{`/data/*`, CRU}
+	permission1 := StandardPermission{URI: `/data/*`, Operation: CRU}
 
 	assert := assert.New(t)
 
@@ -39,9 +39,9 @@ func TestStandardPermission_Include(t *testing.T) {
 
 func TestNewPermissionList(t *testing.T) {
 	permissions := []StandardPermission{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
 	}
 
 	list := NewPermissionList()
@@ -63,9 +63,9 @@ func TestPermissionList_HasPermission(t *testing.T) {
 	list := make(PermissionList, 0)
 
 	permissions := []StandardPermission{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
 	}
 	list = append(list, permissions...)
 
@@ -87,13 +87,38 @@ func TestPermissionList_HasPermission(t *testing.T) {
 	assert.False(list.HasPermission(`/auth`, CRUD))
 }
 
+func TestPermissionList_ParseOnce(t *testing.T) {
+	list := NewPermissionList()
+	list.Add(&StandardPermission{URI: `/orders/{id:[0-9]+}`, Operation: Read})
+
+	assert := assert.New(t)
+	pattern := (*list)[0].pattern
+	assert.NotNil(pattern)
+	assert.True(list.HasPermission(`/orders/12`, Read))
+	assert.False(list.HasPermission(`/orders/a`, Read))
+	assert.Same(pattern, (*list)[0].pattern)
+	assert.Equal([]StandardPermission{{URI: `/orders/{id:[0-9]+}`, Operation: Read}}, list.Permissions())
+
+	uncached := testing.AllocsPerRun(10, func() {
+		(&StandardPermission{URI: `/orders/{id:[0-9]+}`, Operation: Read}).Match(`/orders/12`)
+	})
+	cached := testing.AllocsPerRun(10, func() {
+		list.HasPermission(`/orders/12`, Read)
+	})
+	assert.Less(cached, uncached)
+
+	// a permission whose uri is changed is parsed again
+	(*list)[0].URI = `/orders/*`
+	assert.True(list.HasPermission(`/orders/a`, Read))
+}
+
 func TestPermissionList_Destroy(t *testing.T) {
 	list := make(PermissionList, 0)
 
 	permissions := []StandardPermission{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
 	}
 	list = append(list, permissions...)
 
@@ -103,11 +128,11 @@ func TestPermissionList_Destroy(t *testing.T) {
 
 func TestNewTree(t *testing.T) {
 	permissions := PermissionList{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
-		{`/auth/`, Read},
-		{`/auth/user/*`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
+		{URI: `/auth/`, Operation: Read},
+		{URI: `/auth/user/*`, Operation: CRUD},
 	}
 
 	tree := NewPermissionTree()
@@ -137,10 +162,10 @@ func TestNewTree(t *testing.T) {
 
 func TestPermissionTree_Match(t *testing.T) {
 	permissions := PermissionList{
-		{`/data/**`, CR},
-		{`/data`, CRUD},
-		{`/auth/`, Read},
-		{`/auth/user/*`, CRUD},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
+		{URI: `/auth/`, Operation: Read},
+		{URI: `/auth/user/*`, Operation: CRUD},
 	}
 
 	tree := NewPermissionTree()
@@ -160,11 +185,11 @@ func TestPermissionTree_Match(t *testing.T) {
 
 func TestPermissionTree_HasPermission(t *testing.T) {
 	permissions := PermissionList{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
-		{`/auth/`, Read},
-		{`/auth/user/*`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
+		{URI: `/auth/`, Operation: Read},
+		{URI: `/auth/user/*`, Operation: CRUD},
 	}
 
 	tree := NewPermissionTree()
@@ -194,11 +219,11 @@ func TestPermissionTree_HasPermission(t *testing.T) {
 
 func TestPermissionTree_Destroy(t *testing.T) {
 	permissions := PermissionList{
-		{`/data/*`, CRU},
-		{`/data/**`, CR},
-		{`/data`, CRUD},
-		{`/auth/`, Read},
-		{`/auth/user/*`, CRUD},
+		{URI: `/data/*`, Operation: CRU},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data`, Operation: CRUD},
+		{URI: `/auth/`, Operation: Read},
+		{URI: `/auth/user/*`, Operation: CRUD},
 	}
 
 	tree := NewPermissionTree()
@@ -207,3 +232,18 @@ func TestPermissionTree_Destroy(t *testing.T) {
 	assert := assert.New(t)
 	assert.Empty(tree)
 }
+
+func TestPermissionTree_Permissions(t *testing.T) {
+	permissions := PermissionList{
+		{URI: `/data`, Operation: CRUD},
+		{URI: `/data/**`, Operation: CR},
+		{URI: `/data/secret`, Operation: Read},
+		{URI: `/data/secret`, Operation: Update, Effect: Deny},
+	}
+
+	tree := NewPermissionTree()
+	tree.Load(permissions)
+	assert := assert.New(t)
+	assert.Equal([]StandardPermission(permissions), tree.Permissions())
+	assert.Equal([]StandardPermission(permissions), permissions.Permissions())
+}
@@ -1,5 +1,10 @@
 package rbac
 
+import (
+	"fmt"
+	"strings"
+)
+
 type Policies interface {
 	// LoadPolicies should load all policies for authorization.
 	LoadPolicies([]StandardPolicy)
@@ -22,22 +27,40 @@ type StandardPolicy struct {
 type PermissionGroup struct {
 	Operation Operation
 	RoleID    []int64
-}
 
-func (g *PermissionGroup) collectRoleID(op Operation, roleID *[]int64) {
-	if g.include(op) {
-		*roleID = append(*roleID, g.RoleID...)
-	}
+	// Effect shows whether the group grants or forbids the operation to its roles.
+	Effect Effect
+
+	// Conditions are names of conditions which must all pass for the group to grant the operation.
+	// Conditions are evaluated by AccessControl.Authorize. PolicyTree.IsGranted never grants by such a group,
+	// and always denies by it.
+	Conditions []string
 }
 
 func (g *PermissionGroup) include(op Operation) bool {
 	return (g.Operation & op) == op
 }
 
+func (g PermissionGroup) String() string {
+	if g.Effect == Deny {
+		return fmt.Sprintf("deny %s %v", g.Operation, g.RoleID)
+	}
+	return fmt.Sprintf("%s %v", g.Operation, g.RoleID)
+}
+
+// PolicyTree holds policies in a tree of segments of their URIs. Children of a node are scanned in order,
+// so CompiledPolicies decide the same requests faster when nodes have many children.
 type PolicyTree struct {
-	path     string
-	groups   []PermissionGroup
-	children []*PolicyTree
+	path      string
+	uri       string
+	groups    []PermissionGroup
+	children  []*PolicyTree
+	seg       segment
+	hierarchy *hierarchy
+	algorithm CombiningAlgorithm
+
+	// hierarchySet tells whether SetHierarchy is called, even with NoInheritance.
+	hierarchySet bool
 }
 
 func NewPolicyTree() *PolicyTree {
@@ -47,67 +70,121 @@ func NewPolicyTree() *PolicyTree {
 	return &root
 }
 
+// SetHierarchy makes the tree grant permissions along the hierarchy of roles in the direction of inheritance.
+// Ancestors and descendants of roles are cached until roles change, if roles tell their generation.
+// ChildInherits is rejected unless roles can be ranged over, like RoleManager.
+func (t *PolicyTree) SetHierarchy(roles Roles, inheritance Inheritance) error {
+	h, err := newHierarchy(roles, inheritance, ChildInherits)
+	if err != nil {
+		return err
+	}
+	t.hierarchy, t.hierarchySet = h, true
+	return nil
+}
+
+// HasHierarchy shows whether SetHierarchy decides how the tree grants permissions along the hierarchy of roles.
+// Otherwise AccessControl grants superiors of the required roles by its roles.
+func (t *PolicyTree) HasHierarchy() bool {
+	return t.hierarchySet
+}
+
+// SetCombiningAlgorithm sets how rules of policies matching a request are combined. The default is MostSpecific.
+func (t *PolicyTree) SetCombiningAlgorithm(algorithm CombiningAlgorithm) {
+	t.algorithm = algorithm
+}
+
+// CombiningAlgorithm returns how rules of policies matching a request are combined.
+func (t *PolicyTree) CombiningAlgorithm() CombiningAlgorithm {
+	return t.algorithm
+}
+
 func (t *PolicyTree) LoadPolicies(policies []StandardPolicy) {
+	hierarchy, algorithm, set := t.hierarchy, t.algorithm, t.hierarchySet
 	t.Destroy()
+	t.hierarchy, t.algorithm, t.hierarchySet = hierarchy, algorithm, set
 	for _, policy := range policies {
 		t.add(policy.URI, policy.Groups)
 	}
 }
 
+// Require returns roles which are granted op by policies of uri if their conditions pass.
+// It shows whether any policy has rules for op, even if all of them deny.
 func (t *PolicyTree) Require(uri string, op Operation) ([]int64, bool) {
+	roleID, _, required := t.RequireParams(uri, op)
+	return roleID, required
+}
+
+// RequireParams is like Require and returns parameters captured by the most specific policy,
+// such as "id" of "/orders/:id".
+func (t *PolicyTree) RequireParams(uri string, op Operation) ([]int64, Params, bool) {
+	match, required := t.Lookup(uri, op)
+	if !required {
+		return nil, nil, false
+	}
+	return requiredRoles(match), match.Rules[0].Params, true
+}
+
+// Lookup finds every policy of uri which has rules for op, from the most specific one.
+// Static segments are preferred to regexp segments, then to parameters, "*" and "**".
+// Roles of allow rules are expanded through the hierarchy.
+func (t *PolicyTree) Lookup(uri string, op Operation) (PolicyMatch, bool) {
 	paths := handleURI(uri)
-	roleID := make([]int64, 0)
-search:
-	for i, path := range paths {
-		for _, child := range t.children {
-			switch child.path {
-			case `**`:
-				for _, group := range child.groups {
-					group.collectRoleID(op, &roleID)
-				}
-				if len(roleID) != 0 {
-					return roleID, true
-				}
-			case `*`:
-				if i == len(paths)-1 {
-					for _, group := range child.groups {
-						group.collectRoleID(op, &roleID)
-					}
-					if len(roleID) != 0 {
-						return roleID, true
-					}
-				}
-			default:
-				if child.path == path {
-					if i == len(paths)-1 {
-						for _, group := range child.groups {
-							group.collectRoleID(op, &roleID)
-						}
-						if len(roleID) != 0 {
-							return roleID, true
-						}
-					}
-					t = child
-					continue search
-				}
+	if len(paths) == 0 {
+		return PolicyMatch{}, false
+	}
+	match := PolicyMatch{Algorithm: t.algorithm}
+	visited := make(map[*PolicyTree]bool)
+	searchTree(t, paths, nil, func(node *PolicyTree, matched Params) bool {
+		if visited[node] {
+			return false
+		}
+		visited[node] = true
+		for _, group := range node.groups {
+			if group.include(op) && len(group.RoleID) > 0 {
+				group.RoleID = t.hierarchy.groupRoles(group)
+				match.Rules = append(match.Rules, Rule{Pattern: node.uri, Params: append(Params(nil), matched...), Group: group})
 			}
 		}
-		break
-	}
-	return nil, false
+		return false
+	})
+	return match, len(match.Rules) > 0
+}
+
+// Decide decides whether one of roles can operate a resource by the combining algorithm of the tree.
+// Conditions are not evaluated: a group with conditions never grants and always denies.
+func (t *PolicyTree) Decide(uri string, op Operation, roleID []int64) Decision {
+	match, _ := t.Lookup(uri, op)
+	return decideRoles(match, roleID)
+}
+
+func (t *PolicyTree) segment() *segment {
+	return &t.seg
+}
+
+func (t *PolicyTree) nodes() []*PolicyTree {
+	return t.children
 }
 
 func (t *PolicyTree) IsGranted(uri string, op Operation, role Role) bool {
-	roleID, required := t.Require(uri, op)
-	if !required {
-		return true
-	}
-	for _, id := range roleID {
-		if role.ID() == id {
-			return true
+	return t.Decide(uri, op, []int64{role.ID()}).Granted
+}
+
+// Policies returns all policies of the tree, parents before their children.
+func (t *PolicyTree) Policies() []StandardPolicy {
+	var policies []StandardPolicy
+	t.walk(func(node *PolicyTree) {
+		if node.uri != "" {
+			policies = append(policies, StandardPolicy{URI: node.uri, Groups: node.groups})
 		}
+	})
+	return policies
+}
+
+func (t *PolicyTree) walk(f func(*PolicyTree)) {
+	f(t)
+	for _, child := range t.children {
+		child.walk(f)
 	}
-	return false
 }
 
 func (t *PolicyTree) Destroy() {
@@ -116,6 +193,7 @@ func (t *PolicyTree) Destroy() {
 
 func (t *PolicyTree) add(uri string, group []PermissionGroup) {
 	paths := handleURI(uri)
+	pattern := "/" + strings.Join(paths, "/")
 insert:
 	for j, path := range paths {
 		for _, child := range t.children {
@@ -123,6 +201,7 @@ insert:
 				t = child
 				if j == len(paths)-1 {
 					child.groups = group
+					child.uri = pattern
 				}
 				continue insert
 			}
@@ -130,11 +209,14 @@ insert:
 		if j == len(paths)-1 {
 			t.children = append(t.children, &PolicyTree{
 				path:   path,
+				uri:    pattern,
 				groups: group,
+				seg:    parseSegment(path),
 			})
 		} else {
 			t.children = append(t.children, &PolicyTree{
 				path: path,
+				seg:  parseSegment(path),
 			})
 		}
 
@@ -1,8 +1,10 @@
 package rbac
 
 import (
-	"github.com/stretchr/testify/assert"
+	"errors"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestNewPolicyTree(t *testing.T) {
@@ -17,16 +19,16 @@ func TestNewPolicyTree(t *testing.T) {
 func TestPolicyTree_Load(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CR, []int64{1, 2, 3}},
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
 		}},
 		{`/data`, []PermissionGroup{
-			{CRUD, []int64{4, 7}},
+			{Operation: CRUD, RoleID: []int64{4, 7}},
 		}},
 		{`/auth/`, []PermissionGroup{
-			{Read, []int64{2, 4, 5}},
+			{Operation: Read, RoleID: []int64{2, 4, 5}},
 		}},
 		{`/auth/user/*`, []PermissionGroup{
-			{CRUD, []int64{5}},
+			{Operation: CRUD, RoleID: []int64{5}},
 		}},
 	}
 
@@ -65,11 +67,11 @@ func TestPolicyTree_Load(t *testing.T) {
 func TestPolicyTree_Require(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CR, []int64{1, 2, 3}},
-			{Read, []int64{9, 10}},
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
+			{Operation: Read, RoleID: []int64{9, 10}},
 		}},
 		{`/auth/user/*`, []PermissionGroup{
-			{CRUD, []int64{5}},
+			{Operation: CRUD, RoleID: []int64{5}},
 		}},
 	}
 
@@ -93,16 +95,16 @@ func TestPolicyTree_Require(t *testing.T) {
 func TestPolicyTree_Destroy(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CR, []int64{1, 2, 3}},
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
 		}},
 		{`/data`, []PermissionGroup{
-			{CRUD, []int64{4, 7}},
+			{Operation: CRUD, RoleID: []int64{4, 7}},
 		}},
 		{`/auth/`, []PermissionGroup{
-			{Read, []int64{2, 4, 5}},
+			{Operation: Read, RoleID: []int64{2, 4, 5}},
 		}},
 		{`/auth/user/*`, []PermissionGroup{
-			{CRUD, []int64{5}},
+			{Operation: CRUD, RoleID: []int64{5}},
 		}},
 	}
 
@@ -112,3 +114,136 @@ func TestPolicyTree_Destroy(t *testing.T) {
 
 	assert.Empty(t, tree)
 }
+
+func TestPolicyTree_Policies(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
+		}},
+		{`/data`, []PermissionGroup{
+			{Operation: CRUD, RoleID: []int64{4, 7}},
+		}},
+		{`/auth/user/*`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{5}, Effect: Deny},
+		}},
+	}
+
+	tree := NewPolicyTree()
+	tree.SetCombiningAlgorithm(DenyOverrides)
+	tree.LoadPolicies(policies)
+
+	assert := assert.New(t)
+	assert.Equal([]StandardPolicy{policies[1], policies[0], policies[2]}, tree.Policies())
+	assert.Equal(DenyOverrides, tree.CombiningAlgorithm())
+}
+
+func TestPolicyTree_Hierarchy(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{2, `roleManager`, nil, 1},
+		{3, `role1`, nil, 1},
+		{5, `role2`, nil, 3},
+		{7, `role3`, nil, 3},
+		{10, `role4`, nil, 5},
+	}
+	manager := NewRoleManager()
+	for i := range roles {
+		manager.SetRole(&roles[i])
+	}
+
+	tree := NewPolicyTree()
+	tree.SetHierarchy(manager, ParentInherits)
+	tree.LoadPolicies(policies)
+
+	assert := assert.New(t)
+	roleID, required := tree.Require(`/data/image`, Read)
+	assert.True(required)
+	assert.Equal([]int64{3, 1}, roleID)
+	assert.True(tree.IsGranted(`/data/image`, Read, &roles[0]))
+	assert.True(tree.IsGranted(`/data/image`, Read, &roles[2]))
+	assert.False(tree.IsGranted(`/data/image`, Read, &roles[1]))
+	assert.False(tree.IsGranted(`/data/image`, Read, &roles[3]))
+
+	tree.SetHierarchy(manager, ChildInherits)
+	roleID, _ = tree.Require(`/data/image`, Read)
+	assert.ElementsMatch([]int64{3, 5, 7, 10}, roleID)
+	assert.False(tree.IsGranted(`/data/image`, Read, &roles[0]))
+	assert.True(tree.IsGranted(`/data/image`, Read, &roles[3]))
+	assert.True(tree.IsGranted(`/data/image`, Read, &roles[5]))
+
+	// Moving role3 under roleManager invalidates the cached hierarchy.
+	manager.SetRole(&StandardRole{7, `role3`, nil, 2})
+	assert.False(tree.IsGranted(`/data/image`, Read, &roles[4]))
+	roleID, _ = tree.Require(`/data/image`, Read)
+	assert.ElementsMatch([]int64{3, 5, 10}, roleID)
+
+	tree.SetHierarchy(nil, NoInheritance)
+	assert.False(tree.IsGranted(`/data/image`, Read, &roles[3]))
+}
+
+// plainRoles are roles which can neither be ranged over nor tell their generation.
+type plainRoles struct {
+	Roles
+}
+
+func TestPolicyTree_HierarchyWithoutGeneration(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+		}},
+	}
+	manager := NewRoleManager()
+	manager.SetRole(&StandardRole{1, `admin`, nil, 0})
+	manager.SetRole(&StandardRole{2, `roleManager`, nil, 0})
+	manager.SetRole(&StandardRole{3, `role1`, nil, 1})
+	roles := plainRoles{manager}
+
+	tree := NewPolicyTree()
+	tree.LoadPolicies(policies)
+
+	assert := assert.New(t)
+	assert.True(errors.Is(tree.SetHierarchy(roles, ChildInherits), ErrInvalidInheritance))
+	assert.True(errors.Is(CompilePolicies(policies).SetHierarchy(roles, ChildInherits), ErrInvalidInheritance))
+	assert.True(errors.Is(new(Constraints).SetHierarchy(roles, ParentInherits), ErrInvalidInheritance))
+	assert.Nil(new(Constraints).SetHierarchy(roles, ChildInherits))
+
+	assert.Nil(tree.SetHierarchy(roles, ParentInherits))
+	assert.True(tree.IsGranted(`/data/image`, Read, manager.GetRole(1)))
+
+	// Without a generation, ancestors are not cached, so moving role1 is seen at once.
+	manager.SetRole(&StandardRole{3, `role1`, nil, 2})
+	assert.False(tree.IsGranted(`/data/image`, Read, manager.GetRole(1)))
+	assert.True(tree.IsGranted(`/data/image`, Read, manager.GetRole(2)))
+}
+
+func TestPolicyTree_HierarchyDeny(t *testing.T) {
+	manager := NewRoleManager()
+	manager.SetRole(&StandardRole{1, `admin`, nil, 0})
+	manager.SetRole(&StandardRole{7, `intern`, nil, 1})
+
+	tree := NewPolicyTree()
+	tree.SetHierarchy(manager, ParentInherits)
+	tree.LoadPolicies([]StandardPolicy{{`/data`, []PermissionGroup{
+		{Operation: Read, RoleID: []int64{1, 7}},
+		{Operation: Read, RoleID: []int64{7}, Effect: Deny},
+	}}})
+
+	assert := assert.New(t)
+	// a deny of a child does not deny its parent, which inherits only what the child is allowed
+	assert.True(tree.IsGranted(`/data`, Read, manager.GetRole(1)))
+	assert.False(tree.IsGranted(`/data`, Read, manager.GetRole(7)))
+	match, _ := tree.Lookup(`/data`, Read)
+	assert.Equal([]int64{7}, match.Rules[1].Group.RoleID)
+	assert.Equal([]Grant{{URI: `/data`, Operation: Read, Effect: Allow}}, tree.RolePermissions(1))
+	assert.Equal([]int64{7}, tree.Explain(`/data`, Read, Subject{RoleID: []int64{1}}).Path[0].Groups[1].RoleID)
+
+	compiled := CompilePolicies(tree.Policies())
+	compiled.SetHierarchy(manager, ParentInherits)
+	assert.True(compiled.IsGranted(`/data`, Read, manager.GetRole(1)))
+	assert.False(compiled.IsGranted(`/data`, Read, manager.GetRole(7)))
+}
@@ -0,0 +1,172 @@
+package policyfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/go-pandora/pkg/rbac"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// The types below are how a document is written. Roles are referred by their names if they have unique ones.
+type (
+	file struct {
+		Algorithm string       `yaml:"algorithm,omitempty" json:"algorithm,omitempty" toml:"algorithm,omitempty"`
+		Roles     []roleFile   `yaml:"roles,omitempty" json:"roles,omitempty" toml:"roles,omitempty"`
+		Policies  []policyFile `yaml:"policies,omitempty" json:"policies,omitempty" toml:"policies,omitempty"`
+	}
+
+	roleFile struct {
+		ID          int64            `yaml:"id" json:"id" toml:"id"`
+		Name        string           `yaml:"name,omitempty" json:"name,omitempty" toml:"name,omitempty"`
+		Parent      interface{}      `yaml:"parent,omitempty" json:"parent,omitempty" toml:"parent,omitempty"`
+		Permissions []permissionFile `yaml:"permissions,omitempty" json:"permissions,omitempty" toml:"permissions,omitempty"`
+	}
+
+	permissionFile struct {
+		URI       string `yaml:"uri" json:"uri" toml:"uri"`
+		Operation string `yaml:"operation" json:"operation" toml:"operation"`
+		Effect    string `yaml:"effect,omitempty" json:"effect,omitempty" toml:"effect,omitempty"`
+	}
+
+	policyFile struct {
+		URI    string      `yaml:"uri" json:"uri" toml:"uri"`
+		Groups []groupFile `yaml:"groups" json:"groups" toml:"groups"`
+	}
+
+	groupFile struct {
+		Operation  string        `yaml:"operation" json:"operation" toml:"operation"`
+		Roles      []interface{} `yaml:"roles,flow" json:"roles" toml:"roles,inline"`
+		Effect     string        `yaml:"effect,omitempty" json:"effect,omitempty" toml:"effect,omitempty"`
+		Conditions []string      `yaml:"conditions,omitempty,flow" json:"conditions,omitempty" toml:"conditions,omitempty"`
+	}
+)
+
+// Export builds a document from the policies of tree and roles.
+// Roles are sorted by ids, and their permissions are exported if they can be listed,
+// like those of *rbac.PermissionTree and *rbac.PermissionList.
+func Export(tree *rbac.PolicyTree, roles []rbac.Role) *Document {
+	document := &Document{
+		Algorithm: tree.CombiningAlgorithm(),
+		Policies:  tree.Policies(),
+	}
+	for _, role := range roles {
+		standard := &rbac.StandardRole{Id: role.ID(), ParentId: role.ParentID(), Permissions: role}
+		if r, ok := role.(*rbac.StandardRole); ok {
+			standard.Name, standard.Permissions = r.Name, r.Permissions
+		}
+		document.Roles = append(document.Roles, standard)
+	}
+	sort.Slice(document.Roles, func(i, j int) bool { return document.Roles[i].Id < document.Roles[j].Id })
+	return document
+}
+
+// WriteFile writes a document into a file in the format of its extension.
+func WriteFile(path string, d *Document) error {
+	format, err := FormatOf(path)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Write(f, format, d); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func Write(w io.Writer, format Format, d *Document) error {
+	out := d.file()
+	switch format {
+	case YAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(out); err != nil {
+			return err
+		}
+		return encoder.Close()
+	case JSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(out)
+	case TOML:
+		return toml.NewEncoder(w).Encode(out)
+	}
+	return fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+}
+
+func (d *Document) file() file {
+	names := make(map[int64]string, len(d.Roles))
+	used := make(map[string]int, len(d.Roles))
+	for _, role := range d.Roles {
+		if role.Name != "" {
+			used[role.Name]++
+		}
+	}
+	for _, role := range d.Roles {
+		if role.Name != "" && used[role.Name] == 1 {
+			names[role.Id] = role.Name
+		}
+	}
+	ref := func(id int64) interface{} {
+		if name, ok := names[id]; ok {
+			return name
+		}
+		return id
+	}
+
+	var out file
+	if d.Algorithm != rbac.MostSpecific {
+		out.Algorithm = d.Algorithm.String()
+	}
+	for _, role := range d.Roles {
+		r := roleFile{ID: role.Id, Name: role.Name}
+		if role.ParentId != 0 {
+			r.Parent = ref(role.ParentId)
+		}
+		if lister, ok := role.Permissions.(interface {
+			Permissions() []rbac.StandardPermission
+		}); ok {
+			for _, p := range lister.Permissions() {
+				r.Permissions = append(r.Permissions, permissionFile{
+					URI:       p.URI,
+					Operation: p.Operation.String(),
+					Effect:    effectString(p.Effect),
+				})
+			}
+		}
+		out.Roles = append(out.Roles, r)
+	}
+	for _, policy := range d.Policies {
+		p := policyFile{URI: policy.URI, Groups: []groupFile{}}
+		for _, group := range policy.Groups {
+			g := groupFile{
+				Operation:  group.Operation.String(),
+				Roles:      []interface{}{},
+				Effect:     effectString(group.Effect),
+				Conditions: group.Conditions,
+			}
+			for _, id := range group.RoleID {
+				g.Roles = append(g.Roles, ref(id))
+			}
+			p.Groups = append(p.Groups, g)
+		}
+		out.Policies = append(out.Policies, p)
+	}
+	return out
+}
+
+// effectString omits the default effect.
+func effectString(effect rbac.Effect) string {
+	if effect == rbac.Allow {
+		return ""
+	}
+	return effect.String()
+}
@@ -0,0 +1,288 @@
+package policyfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+type nodeKind uint8
+
+const (
+	scalarNode nodeKind = iota
+	mapNode
+	listNode
+)
+
+// node is a value of a policy file with the line it starts at, whatever the format of the file is.
+type node struct {
+	line  int
+	kind  nodeKind
+	value string
+
+	// number shows whether a scalar is written as a number, so that ids can be told from names.
+	number bool
+
+	keys   []string
+	fields map[string]*node
+	items  []*node
+}
+
+func newMap(line int) *node {
+	return &node{line: line, kind: mapNode, fields: make(map[string]*node)}
+}
+
+func (n *node) set(key string, value *node) {
+	if _, ok := n.fields[key]; !ok {
+		n.keys = append(n.keys, key)
+	}
+	n.fields[key] = value
+}
+
+func (n *node) describe() string {
+	switch n.kind {
+	case mapNode:
+		return "a table"
+	case listNode:
+		return "a list"
+	}
+	return fmt.Sprintf("%q", n.value)
+}
+
+func parseYAML(data []byte) (*node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, &Error{Line: yamlErrorLine(err), Err: fmt.Errorf("%w: %s", ErrSyntax, err)}
+	}
+	if document.Kind == 0 || len(document.Content) == 0 {
+		return newMap(1), nil
+	}
+	return fromYAML(document.Content[0])
+}
+
+// yamlErrorLine reads the line from an error of yaml.v3 such as "yaml: line 3: ...".
+func yamlErrorLine(err error) int {
+	var line int
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) && len(typeError.Errors) > 0 {
+		fmt.Sscanf(typeError.Errors[0], "line %d:", &line)
+		return line
+	}
+	fmt.Sscanf(err.Error(), "yaml: line %d:", &line)
+	return line
+}
+
+func fromYAML(y *yaml.Node) (*node, error) {
+	switch y.Kind {
+	case yaml.DocumentNode:
+		if len(y.Content) == 0 {
+			return newMap(y.Line), nil
+		}
+		return fromYAML(y.Content[0])
+	case yaml.AliasNode:
+		return fromYAML(y.Alias)
+	case yaml.MappingNode:
+		n := newMap(y.Line)
+		for i := 0; i+1 < len(y.Content); i += 2 {
+			key, value := y.Content[i], y.Content[i+1]
+			if _, ok := n.fields[key.Value]; ok {
+				return nil, &Error{Line: key.Line, Err: fmt.Errorf("%w: duplicate key %q", ErrSyntax, key.Value)}
+			}
+			child, err := fromYAML(value)
+			if err != nil {
+				return nil, err
+			}
+			n.set(key.Value, child)
+		}
+		return n, nil
+	case yaml.SequenceNode:
+		n := &node{line: y.Line, kind: listNode}
+		for _, item := range y.Content {
+			child, err := fromYAML(item)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+		return n, nil
+	}
+	return &node{
+		line:   y.Line,
+		kind:   scalarNode,
+		value:  y.Value,
+		number: y.Tag == "!!int" || y.Tag == "!!float",
+	}, nil
+}
+
+// parseJSON checks data is strict JSON, then reads it as YAML, which JSON is a subset of, to keep lines.
+func parseJSON(data []byte) (*node, error) {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		line := 0
+		var syntaxError *json.SyntaxError
+		if errors.As(err, &syntaxError) {
+			line = 1 + bytes.Count(data[:syntaxError.Offset], []byte("\n"))
+		}
+		return nil, &Error{Line: line, Err: fmt.Errorf("%w: %s", ErrSyntax, err)}
+	}
+	return parseYAML(data)
+}
+
+func parseTOML(data []byte) (*node, error) {
+	var p unstable.Parser
+	p.Reset(data)
+	root := newMap(1)
+	current := root
+	for p.NextExpression() {
+		expression := p.Expression()
+		line := tomlLine(&p, expression, 0)
+		var err error
+		switch expression.Kind {
+		case unstable.KeyValue:
+			err = setTOMLValue(&p, current, expression)
+		case unstable.Table:
+			current, err = tomlTable(root, tomlKey(expression), line, false)
+		case unstable.ArrayTable:
+			current, err = tomlTable(root, tomlKey(expression), line, true)
+		}
+		if err != nil {
+			var fileError *Error
+			if !errors.As(err, &fileError) {
+				err = &Error{Line: line, Err: err}
+			}
+			return nil, err
+		}
+	}
+	if err := p.Error(); err != nil {
+		line := 0
+		var parserError *unstable.ParserError
+		if errors.As(err, &parserError) && parserError.Highlight != nil {
+			line = p.Shape(p.Range(parserError.Highlight)).Start.Line
+		}
+		return nil, &Error{Line: line, Err: fmt.Errorf("%w: %s", ErrSyntax, err)}
+	}
+	return root, nil
+}
+
+// tomlLine returns the line a node starts at. Arrays and tables have no range of their own,
+// so they start at their first child, or at fallback if they are empty.
+func tomlLine(p *unstable.Parser, n *unstable.Node, fallback int) int {
+	if n.Raw.Length > 0 {
+		return p.Shape(n.Raw).Start.Line
+	}
+	if child := n.Child(); child != nil {
+		return tomlLine(p, child, fallback)
+	}
+	return fallback
+}
+
+func tomlKey(n *unstable.Node) []string {
+	var key []string
+	it := n.Key()
+	for it.Next() {
+		key = append(key, string(it.Node().Data))
+	}
+	return key
+}
+
+// tomlTable returns the table a header such as [a.b] or [[a.b]] refers to, creating it if needed.
+// A key which refers to an array of tables refers to the last table of it.
+func tomlTable(root *node, key []string, line int, array bool) (*node, error) {
+	n := root
+	for i, part := range key {
+		last := i == len(key)-1
+		child, ok := n.fields[part]
+		switch {
+		case !ok && last && array:
+			child = &node{line: line, kind: listNode}
+			n.set(part, child)
+		case !ok:
+			child = newMap(line)
+			n.set(part, child)
+		}
+		if last && array {
+			if child.kind != listNode {
+				return nil, fmt.Errorf("%w: %q is not an array of tables", ErrSyntax, part)
+			}
+			table := newMap(line)
+			child.items = append(child.items, table)
+			return table, nil
+		}
+		if child.kind == listNode && len(child.items) > 0 {
+			child = child.items[len(child.items)-1]
+		}
+		if child.kind != mapNode {
+			return nil, fmt.Errorf("%w: %q is not a table", ErrSyntax, part)
+		}
+		n = child
+	}
+	return n, nil
+}
+
+func setTOMLValue(p *unstable.Parser, table *node, keyValue *unstable.Node) error {
+	key := tomlKey(keyValue)
+	line := tomlLine(p, keyValue, 0)
+	for _, part := range key[:len(key)-1] {
+		child, ok := table.fields[part]
+		if !ok {
+			child = newMap(line)
+			table.set(part, child)
+		}
+		if child.kind != mapNode {
+			return fmt.Errorf("%w: %q is not a table", ErrSyntax, part)
+		}
+		table = child
+	}
+	name := key[len(key)-1]
+	if _, ok := table.fields[name]; ok {
+		return fmt.Errorf("%w: duplicate key %q", ErrSyntax, name)
+	}
+	value, err := fromTOML(p, keyValue.Value(), line)
+	if err != nil {
+		return err
+	}
+	table.set(name, value)
+	return nil
+}
+
+func fromTOML(p *unstable.Parser, v *unstable.Node, fallback int) (*node, error) {
+	line := tomlLine(p, v, fallback)
+	switch v.Kind {
+	case unstable.Array:
+		n := &node{line: line, kind: listNode}
+		it := v.Children()
+		for it.Next() {
+			item := it.Node()
+			if item.Kind == unstable.Comment {
+				continue
+			}
+			child, err := fromTOML(p, item, line)
+			if err != nil {
+				return nil, err
+			}
+			n.items = append(n.items, child)
+		}
+		return n, nil
+	case unstable.InlineTable:
+		n := newMap(line)
+		it := v.Children()
+		for it.Next() {
+			if keyValue := it.Node(); keyValue.Kind == unstable.KeyValue {
+				if err := setTOMLValue(p, n, keyValue); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return n, nil
+	}
+	return &node{
+		line:   line,
+		kind:   scalarNode,
+		value:  string(v.Data),
+		number: v.Kind == unstable.Integer || v.Kind == unstable.Float,
+	}, nil
+}
@@ -0,0 +1,548 @@
+// Package policyfile loads policies and roles of rbac from YAML, JSON and TOML files, and writes them back.
+//
+// A file looks like this in YAML:
+//
+//	algorithm: deny-overrides
+//	roles:
+//	  - id: 1
+//	    name: admin
+//	  - id: 2
+//	    name: editor
+//	    parent: admin
+//	    permissions:
+//	      - uri: /articles/**
+//	        operation: CRU
+//	policies:
+//	  - uri: /articles/**
+//	    groups:
+//	      - operation: create,read
+//	        roles: [editor]
+//	      - operation: D
+//	        roles: [editor]
+//	        effect: deny
+//
+// Roles are referred by their names or ids. Operations are written like rbac.ParseOperation accepts.
+package policyfile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-pandora/pkg/rbac"
+)
+
+// Format is the format of a policy file.
+type Format uint8
+
+const (
+	YAML Format = iota
+	JSON
+	TOML
+)
+
+func (f Format) String() string {
+	switch f {
+	case YAML:
+		return "yaml"
+	case JSON:
+		return "json"
+	case TOML:
+		return "toml"
+	}
+	return fmt.Sprintf("Format(%d)", uint8(f))
+}
+
+var (
+	ErrUnknownFormat   = errors.New("RBAC: unknown policy file format")
+	ErrSyntax          = errors.New("RBAC: syntax error")
+	ErrInvalidField    = errors.New("RBAC: invalid field")
+	ErrUnknownField    = errors.New("RBAC: unknown field")
+	ErrMissingField    = errors.New("RBAC: missing field")
+	ErrUnknownRole     = errors.New("RBAC: unknown role")
+	ErrDuplicateRole   = errors.New("RBAC: duplicate role")
+	ErrRoleCycle       = errors.New("RBAC: cycle in parents of role")
+	ErrDuplicateURI    = errors.New("RBAC: duplicate uri")
+	ErrInvalidWildcard = errors.New("RBAC: bad wildcard placement")
+	ErrInvalidPattern  = errors.New("RBAC: invalid pattern")
+)
+
+// Error is an error of a policy file at a line. Line is 0 if it is unknown.
+type Error struct {
+	Line int
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.Line == 0 {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%s (line %d)", e.Err, e.Line)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Errors are all errors found in a policy file, in order of lines.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// Document is the content of a policy file.
+type Document struct {
+	Algorithm rbac.CombiningAlgorithm
+
+	// Roles hold their permissions in a *rbac.PermissionTree.
+	Roles    []*rbac.StandardRole
+	Policies []rbac.StandardPolicy
+}
+
+// Apply loads policies of the document into policies, and sets roles of it into roles if roles is not nil.
+// The combining algorithm is set if policies is a *rbac.PolicyTree.
+func (d *Document) Apply(policies rbac.Policies, roles rbac.Roles) {
+	if tree, ok := policies.(*rbac.PolicyTree); ok {
+		tree.SetCombiningAlgorithm(d.Algorithm)
+	}
+	policies.LoadPolicies(d.Policies)
+	if roles == nil {
+		return
+	}
+	for _, role := range d.Roles {
+		roles.SetRole(role)
+	}
+}
+
+// FormatOf returns the format of a file by its extension.
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return YAML, nil
+	case ".json":
+		return JSON, nil
+	case ".toml":
+		return TOML, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownFormat, path)
+}
+
+// LoadFile loads a policy file in the format of its extension.
+func LoadFile(path string) (*Document, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, format)
+}
+
+func Load(r io.Reader, format Format) (*Document, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, format)
+}
+
+// Parse parses a policy file. A syntax error is returned as an *Error,
+// and all errors in the content are returned together as Errors.
+func Parse(data []byte, format Format) (*Document, error) {
+	var (
+		root *node
+		err  error
+	)
+	switch format {
+	case YAML:
+		root, err = parseYAML(data)
+	case JSON:
+		root, err = parseJSON(data)
+	case TOML:
+		root, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := decoder{names: make(map[string]int64), ids: make(map[int64]int)}
+	document := d.document(root)
+	if len(d.errs) > 0 {
+		sort.SliceStable(d.errs, func(i, j int) bool { return d.errs[i].Line < d.errs[j].Line })
+		return nil, d.errs
+	}
+	return document, nil
+}
+
+// decoder decodes a document and collects all errors in it.
+type decoder struct {
+	errs Errors
+
+	// names and ids are roles declared in the document. ids map to lines.
+	names map[string]int64
+	ids   map[int64]int
+}
+
+func (d *decoder) fail(line int, err error) {
+	d.errs = append(d.errs, &Error{Line: line, Err: err})
+}
+
+// fields checks n is a table of only known keys.
+func (d *decoder) fields(n *node, what string, known ...string) bool {
+	if n.kind != mapNode {
+		d.fail(n.line, fmt.Errorf("%w: %s should be a table, not %s", ErrInvalidField, what, n.describe()))
+		return false
+	}
+	for _, key := range n.keys {
+		if !contains(known, key) {
+			d.fail(n.fields[key].line, fmt.Errorf("%w %q in %s", ErrUnknownField, key, what))
+		}
+	}
+	return true
+}
+
+func (d *decoder) list(n *node, key string) []*node {
+	if n.kind != listNode {
+		d.fail(n.line, fmt.Errorf("%w: %s should be a list, not %s", ErrInvalidField, key, n.describe()))
+		return nil
+	}
+	return n.items
+}
+
+func (d *decoder) str(n *node, key string) (string, bool) {
+	if n.kind != scalarNode {
+		d.fail(n.line, fmt.Errorf("%w: %s should be a string, not %s", ErrInvalidField, key, n.describe()))
+		return "", false
+	}
+	return n.value, true
+}
+
+func (d *decoder) document(root *node) *Document {
+	document := &Document{}
+	if !d.fields(root, "document", "algorithm", "roles", "policies") {
+		return document
+	}
+	if n, ok := root.fields["algorithm"]; ok {
+		if s, ok := d.str(n, "algorithm"); ok {
+			algorithm, err := rbac.ParseCombiningAlgorithm(s)
+			if err != nil {
+				d.fail(n.line, err)
+			}
+			document.Algorithm = algorithm
+		}
+	}
+
+	// Roles are declared first, so that they can be referred before their declarations.
+	var roleNodes []*node
+	if n, ok := root.fields["roles"]; ok {
+		roleNodes = d.list(n, "roles")
+	}
+	for _, n := range roleNodes {
+		d.declareRole(n)
+	}
+	for _, n := range roleNodes {
+		if role := d.role(n); role != nil {
+			document.Roles = append(document.Roles, role)
+		}
+	}
+	d.checkCycles(document.Roles)
+
+	if n, ok := root.fields["policies"]; ok {
+		uris := make(map[string]int)
+		for _, n := range d.list(n, "policies") {
+			if policy, ok := d.policy(n, uris); ok {
+				document.Policies = append(document.Policies, policy)
+			}
+		}
+	}
+	return document
+}
+
+func (d *decoder) declareRole(n *node) {
+	if n.kind != mapNode {
+		return
+	}
+	idNode, ok := n.fields["id"]
+	if !ok {
+		return
+	}
+	id, err := strconv.ParseInt(idNode.value, 0, 64)
+	if err != nil || !idNode.number || id <= 0 {
+		return
+	}
+	if line, ok := d.ids[id]; ok {
+		d.fail(idNode.line, fmt.Errorf("%w: id %d is declared at line %d", ErrDuplicateRole, id, line))
+		return
+	}
+	d.ids[id] = idNode.line
+	if nameNode, ok := n.fields["name"]; ok && nameNode.kind == scalarNode && nameNode.value != "" {
+		if other, ok := d.names[nameNode.value]; ok {
+			d.fail(nameNode.line, fmt.Errorf("%w: name %q is used by role %d", ErrDuplicateRole, nameNode.value, other))
+			return
+		}
+		d.names[nameNode.value] = id
+	}
+}
+
+func (d *decoder) role(n *node) *rbac.StandardRole {
+	if !d.fields(n, "role", "id", "name", "parent", "permissions") {
+		return nil
+	}
+	idNode, ok := n.fields["id"]
+	if !ok {
+		d.fail(n.line, fmt.Errorf("%w: id of role", ErrMissingField))
+		return nil
+	}
+	id, err := strconv.ParseInt(idNode.value, 0, 64)
+	if err != nil || !idNode.number || id <= 0 {
+		d.fail(idNode.line, fmt.Errorf("%w: id of role should be a positive integer, not %s", ErrInvalidField, idNode.describe()))
+		return nil
+	}
+
+	permissions := rbac.NewPermissionTree()
+	role := &rbac.StandardRole{Id: id, Permissions: permissions}
+	if nameNode, ok := n.fields["name"]; ok {
+		role.Name, _ = d.str(nameNode, "name")
+	}
+	if parentNode, ok := n.fields["parent"]; ok {
+		role.ParentId, _ = d.roleRef(parentNode)
+	}
+	if permissionNodes, ok := n.fields["permissions"]; ok {
+		for _, p := range d.list(permissionNodes, "permissions") {
+			if permission, ok := d.permission(p); ok {
+				permissions.Add(&permission)
+			}
+		}
+	}
+	return role
+}
+
+// roleRef resolves a reference to a role by its name or id.
+// Ids are only checked if the document declares roles, since roles may be stored elsewhere.
+func (d *decoder) roleRef(n *node) (int64, bool) {
+	if n.kind != scalarNode {
+		d.fail(n.line, fmt.Errorf("%w: role should be a name or an id, not %s", ErrInvalidField, n.describe()))
+		return 0, false
+	}
+	if n.number {
+		id, err := strconv.ParseInt(n.value, 0, 64)
+		if err != nil {
+			d.fail(n.line, fmt.Errorf("%w: role id %s", ErrInvalidField, n.value))
+			return 0, false
+		}
+		if _, ok := d.ids[id]; !ok && len(d.ids) > 0 {
+			d.fail(n.line, fmt.Errorf("%w %d", ErrUnknownRole, id))
+			return 0, false
+		}
+		return id, true
+	}
+	id, ok := d.names[n.value]
+	if !ok {
+		d.fail(n.line, fmt.Errorf("%w %q", ErrUnknownRole, n.value))
+		return 0, false
+	}
+	return id, true
+}
+
+func (d *decoder) checkCycles(roles []*rbac.StandardRole) {
+	parents := make(map[int64]int64, len(roles))
+	for _, role := range roles {
+		parents[role.Id] = role.ParentId
+	}
+	for _, role := range roles {
+		visited := map[int64]bool{role.Id: true}
+		for parent := parents[role.Id]; parent != 0; parent = parents[parent] {
+			if parent == role.Id {
+				d.fail(d.ids[role.Id], fmt.Errorf("%w %d", ErrRoleCycle, role.Id))
+				break
+			}
+			if visited[parent] {
+				break
+			}
+			visited[parent] = true
+		}
+	}
+}
+
+func (d *decoder) permission(n *node) (rbac.StandardPermission, bool) {
+	var permission rbac.StandardPermission
+	if !d.fields(n, "permission", "uri", "operation", "effect") {
+		return permission, false
+	}
+	uri, ok := d.uri(n, "permission")
+	permission.URI = uri
+	if opNode, found := n.fields["operation"]; found {
+		op, valid := d.operation(opNode)
+		ok = ok && valid
+		permission.Operation = op
+	}
+	if effectNode, found := n.fields["effect"]; found {
+		effect, valid := d.effect(effectNode)
+		ok = ok && valid
+		permission.Effect = effect
+	}
+	return permission, ok
+}
+
+func (d *decoder) policy(n *node, uris map[string]int) (rbac.StandardPolicy, bool) {
+	var policy rbac.StandardPolicy
+	if !d.fields(n, "policy", "uri", "groups") {
+		return policy, false
+	}
+	uri, ok := d.uri(n, "policy")
+	if ok {
+		normalized := "/" + strings.Trim(uri, "/")
+		if line, found := uris[normalized]; found {
+			d.fail(n.fields["uri"].line, fmt.Errorf("%w %q, which is declared at line %d", ErrDuplicateURI, uri, line))
+			ok = false
+		} else {
+			uris[normalized] = n.fields["uri"].line
+		}
+	}
+	policy.URI = uri
+
+	groupNodes, found := n.fields["groups"]
+	if !found {
+		d.fail(n.line, fmt.Errorf("%w: groups of policy %q", ErrMissingField, uri))
+		return policy, false
+	}
+	for _, g := range d.list(groupNodes, "groups") {
+		group, valid := d.group(g)
+		ok = ok && valid
+		policy.Groups = append(policy.Groups, group)
+	}
+	return policy, ok
+}
+
+func (d *decoder) group(n *node) (rbac.PermissionGroup, bool) {
+	var group rbac.PermissionGroup
+	if !d.fields(n, "group", "operation", "roles", "effect", "conditions") {
+		return group, false
+	}
+	opNode, found := n.fields["operation"]
+	if !found {
+		d.fail(n.line, fmt.Errorf("%w: operation of group", ErrMissingField))
+		return group, false
+	}
+	operation, ok := d.operation(opNode)
+	group.Operation = operation
+	if rolesNode, found := n.fields["roles"]; found {
+		for _, r := range d.list(rolesNode, "roles") {
+			id, valid := d.roleRef(r)
+			ok = ok && valid
+			group.RoleID = append(group.RoleID, id)
+		}
+	}
+	if effectNode, found := n.fields["effect"]; found {
+		effect, valid := d.effect(effectNode)
+		ok = ok && valid
+		group.Effect = effect
+	}
+	if conditionsNode, found := n.fields["conditions"]; found {
+		for _, c := range d.list(conditionsNode, "conditions") {
+			name, valid := d.str(c, "condition")
+			ok = ok && valid
+			group.Conditions = append(group.Conditions, name)
+		}
+	}
+	return group, ok
+}
+
+// uri reads and validates the uri of a policy or a permission.
+func (d *decoder) uri(n *node, what string) (string, bool) {
+	uriNode, found := n.fields["uri"]
+	if !found {
+		d.fail(n.line, fmt.Errorf("%w: uri of %s", ErrMissingField, what))
+		return "", false
+	}
+	uri, ok := d.str(uriNode, "uri")
+	if !ok {
+		return "", false
+	}
+	if !strings.HasPrefix(uri, "/") {
+		d.fail(uriNode.line, fmt.Errorf("%w: uri %q should start with /", ErrInvalidField, uri))
+		return uri, false
+	}
+	if err := checkWildcards(uri); err != nil {
+		d.fail(uriNode.line, err)
+		return uri, false
+	}
+	if err := rbac.ValidatePattern(uri); err != nil {
+		d.fail(uriNode.line, fmt.Errorf("%w: %s", ErrInvalidPattern, strings.TrimPrefix(err.Error(), "RBAC: ")))
+		return uri, false
+	}
+	return uri, true
+}
+
+// checkWildcards checks that wildcards are whole segments and "**" does not follow another "**".
+func checkWildcards(uri string) error {
+	previous := ""
+	for _, segment := range strings.Split(uri, "/") {
+		if strings.Contains(segment, "*") && segment != "*" && segment != "**" &&
+			!strings.HasPrefix(segment, "{") {
+			return fmt.Errorf("%w: %q is not a whole segment in %q", ErrInvalidWildcard, segment, uri)
+		}
+		if segment == "**" && previous == "**" {
+			return fmt.Errorf("%w: successive ** in %q", ErrInvalidWildcard, uri)
+		}
+		previous = segment
+	}
+	return nil
+}
+
+func (d *decoder) operation(n *node) (rbac.Operation, bool) {
+	s, ok := d.str(n, "operation")
+	if !ok {
+		return rbac.Nil, false
+	}
+	op, err := rbac.ParseOperation(s)
+	if err != nil {
+		d.fail(n.line, err)
+		return rbac.Nil, false
+	}
+	return op, true
+}
+
+func (d *decoder) effect(n *node) (rbac.Effect, bool) {
+	s, ok := d.str(n, "effect")
+	if !ok {
+		return rbac.Allow, false
+	}
+	effect, err := rbac.ParseEffect(s)
+	if err != nil {
+		d.fail(n.line, err)
+		return rbac.Allow, false
+	}
+	return effect, true
+}
+
+func contains(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,224 @@
+package policyfile
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-pandora/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+const yamlPolicies = `algorithm: deny-overrides
+roles:
+  - id: 1
+    name: admin
+  - id: 2
+    name: editor
+    parent: admin
+    permissions:
+      - uri: /articles/**
+        operation: CRU
+      - uri: /articles/secret
+        operation: R
+        effect: deny
+policies:
+  - uri: /articles/**
+    groups:
+      - operation: create,read
+        roles: [editor, 1]
+      - operation: update
+        roles: [editor]
+        conditions: [owner]
+  - uri: /articles/secret
+    groups:
+      - operation: R
+        roles: [editor]
+        effect: deny
+`
+
+const jsonPolicies = `{
+  "algorithm": "deny-overrides",
+  "roles": [
+    {"id": 1, "name": "admin"},
+    {"id": 2, "name": "editor", "parent": "admin", "permissions": [
+      {"uri": "/articles/**", "operation": "CRU"},
+      {"uri": "/articles/secret", "operation": "R", "effect": "deny"}
+    ]}
+  ],
+  "policies": [
+    {"uri": "/articles/**", "groups": [
+      {"operation": "create,read", "roles": ["editor", 1]},
+      {"operation": "update", "roles": ["editor"], "conditions": ["owner"]}
+    ]},
+    {"uri": "/articles/secret", "groups": [
+      {"operation": "R", "roles": ["editor"], "effect": "deny"}
+    ]}
+  ]
+}
+`
+
+const tomlPolicies = `algorithm = "deny-overrides"
+
+[[roles]]
+id = 1
+name = "admin"
+
+[[roles]]
+id = 2
+name = "editor"
+parent = "admin"
+permissions = [
+  { uri = "/articles/**", operation = "CRU" },
+  { uri = "/articles/secret", operation = "R", effect = "deny" },
+]
+
+[[policies]]
+uri = "/articles/**"
+
+[[policies.groups]]
+operation = "create,read"
+roles = ["editor", 1]
+
+[[policies.groups]]
+operation = "update"
+roles = ["editor"]
+conditions = ["owner"]
+
+[[policies]]
+uri = "/articles/secret"
+groups = [{ operation = "R", roles = ["editor"], effect = "deny" }]
+`
+
+var expectedPolicies = []rbac.StandardPolicy{
+	{URI: `/articles/**`, Groups: []rbac.PermissionGroup{
+		{Operation: rbac.CR, RoleID: []int64{2, 1}},
+		{Operation: rbac.Update, RoleID: []int64{2}, Conditions: []string{`owner`}},
+	}},
+	{URI: `/articles/secret`, Groups: []rbac.PermissionGroup{
+		{Operation: rbac.Read, RoleID: []int64{2}, Effect: rbac.Deny},
+	}},
+}
+
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+	for format, data := range map[Format]string{YAML: yamlPolicies, JSON: jsonPolicies, TOML: tomlPolicies} {
+		document, err := Parse([]byte(data), format)
+		if !assert.Nil(err, format.String()) {
+			continue
+		}
+		assert.Equal(rbac.DenyOverrides, document.Algorithm, format.String())
+		assert.Equal(expectedPolicies, document.Policies, format.String())
+		assert.Equal(2, len(document.Roles), format.String())
+		editor := document.Roles[1]
+		assert.Equal(`editor`, editor.Name)
+		assert.Equal(int64(1), editor.ParentId)
+		assert.True(editor.HasPermission(`/articles/1`, rbac.CRU))
+		assert.False(editor.HasPermission(`/articles/secret`, rbac.Read))
+	}
+}
+
+func TestDocument_Apply(t *testing.T) {
+	document, err := Parse([]byte(yamlPolicies), YAML)
+	assert := assert.New(t)
+	assert.Nil(err)
+
+	tree := rbac.NewPolicyTree()
+	roles := rbac.NewRoleManager()
+	document.Apply(tree, roles)
+
+	assert.Equal(rbac.DenyOverrides, tree.CombiningAlgorithm())
+	assert.True(tree.IsGranted(`/articles/1`, rbac.Read, roles.GetRole(2)))
+	assert.False(tree.IsGranted(`/articles/secret`, rbac.Read, roles.GetRole(2)))
+	assert.True(roles.IsSuperior(roles.GetRole(1), roles.GetRole(2)))
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+		err    error
+		line   int
+	}{
+		{YAML, "policies:\n  - uri: /data\n    groups:\n      - operation: R\n        roles: [nobody]\n", ErrUnknownRole, 5},
+		{YAML, "roles:\n  - id: 1\n    parent: 3\npolicies: []\n", ErrUnknownRole, 3},
+		{YAML, "policies:\n  - uri: /data/a*\n    groups: []\n", ErrInvalidWildcard, 2},
+		{YAML, "policies:\n  - uri: /data/**/**\n    groups: []\n", ErrInvalidWildcard, 2},
+		{YAML, "policies:\n  - uri: /data/{id:[}\n    groups: []\n", ErrInvalidPattern, 2},
+		{YAML, "policies:\n  - uri: /data\n    groups: []\n  - uri: /data/\n    groups: []\n", ErrDuplicateURI, 4},
+		{YAML, "policies:\n  - uri: /data\n    groups:\n      - operation: fly\n", nil, 4},
+		{YAML, "policies:\n  - uri: /data\n    groups: []\n    effect: deny\n", ErrUnknownField, 4},
+		{YAML, "policies:\n  - uri: /data\n", ErrMissingField, 2},
+		{YAML, "roles:\n  - id: 1\n    name: a\n  - id: 1\n    name: b\n", ErrDuplicateRole, 4},
+		{YAML, "roles:\n  - id: 1\n    parent: 2\n  - id: 2\n    parent: 1\n", ErrRoleCycle, 2},
+		{YAML, "algorithm: random\n", rbac.ErrInvalidCombiningAlgorithm, 1},
+		{YAML, "policies:\n  - uri: [\n", ErrSyntax, 2},
+		{JSON, "{\n  \"policies\": [\n    {\"uri\": \"/data/x*\", \"groups\": []}\n  ]\n}", ErrInvalidWildcard, 3},
+		{JSON, "{\n  \"policies\": [\n    {\"uri\": \"/data\", \"groups\": [{\"operation\": \"R\", \"roles\": [\"x\"]}]}\n  ]\n}", ErrUnknownRole, 3},
+		{JSON, "{\n  \"policies\": [,]\n}", ErrSyntax, 2},
+		{TOML, "[[policies]]\nuri = \"/data\"\ngroups = []\n\n[[policies]]\nuri = \"/data\"\ngroups = []\n", ErrDuplicateURI, 6},
+		{TOML, "[[policies]]\nuri = \"/data\"\n\n[[policies.groups]]\noperation = \"R\"\nroles = [\"nobody\"]\n", ErrUnknownRole, 6},
+		{TOML, "[[policies]]\nuri = \"/data\"\ngroups = \n", ErrSyntax, 3},
+	}
+
+	assert := assert.New(t)
+	for _, test := range tests {
+		_, err := Parse([]byte(test.data), test.format)
+		if test.err != nil && !assert.ErrorIs(err, test.err, test.data) {
+			continue
+		}
+		var fileError *Error
+		if assert.True(errors.As(err, &fileError), test.data) {
+			assert.Equal(test.line, fileError.Line, test.data)
+		}
+	}
+}
+
+func TestParse_AllErrors(t *testing.T) {
+	data := "policies:\n  - uri: /a*\n    groups: []\n  - uri: /b\n    groups:\n      - operation: R\n        roles: [x]\n"
+	_, err := Parse([]byte(data), YAML)
+
+	assert := assert.New(t)
+	var errs Errors
+	if assert.True(errors.As(err, &errs)) {
+		assert.Equal(2, len(errs))
+		assert.Equal(2, errs[0].Line)
+		assert.Equal(7, errs[1].Line)
+	}
+	assert.Contains(err.Error(), `RBAC: unknown role "x" (line 7)`)
+}
+
+func TestExport(t *testing.T) {
+	document, err := Parse([]byte(yamlPolicies), YAML)
+	assert := assert.New(t)
+	assert.Nil(err)
+	tree := rbac.NewPolicyTree()
+	roles := rbac.NewRoleManager()
+	document.Apply(tree, roles)
+
+	exported := Export(tree, []rbac.Role{roles.GetRole(2), roles.GetRole(1)})
+	for _, format := range []Format{YAML, JSON, TOML} {
+		var buf bytes.Buffer
+		assert.Nil(Write(&buf, format, exported))
+		parsed, err := Parse(buf.Bytes(), format)
+		if !assert.Nil(err, buf.String()) {
+			continue
+		}
+		assert.Equal(rbac.DenyOverrides, parsed.Algorithm)
+		assert.Equal(expectedPolicies, parsed.Policies, buf.String())
+		assert.Equal(`admin`, parsed.Roles[0].Name)
+		assert.Equal(int64(1), parsed.Roles[1].ParentId)
+		assert.Equal(document.Roles[1].Permissions.(*rbac.PermissionTree).Permissions(),
+			parsed.Roles[1].Permissions.(*rbac.PermissionTree).Permissions())
+	}
+
+	path := filepath.Join(t.TempDir(), `policies.yml`)
+	assert.Nil(WriteFile(path, exported))
+	parsed, err := LoadFile(path)
+	assert.Nil(err)
+	assert.Equal(expectedPolicies, parsed.Policies)
+
+	_, err = LoadFile(`policies.ini`)
+	assert.ErrorIs(err, ErrUnknownFormat)
+}
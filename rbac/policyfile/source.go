@@ -0,0 +1,80 @@
+package policyfile
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/go-pandora/pkg/rbac"
+)
+
+// NewFileSource returns a PolicySource which loads policies from a file in the format of its extension,
+// and loads them again whenever the modification time or the size of the file changes, checked every interval.
+// Roles and the combining algorithm of the file are not loaded; set them in the factory of the PolicyManager.
+func NewFileSource(path string, interval time.Duration) *rbac.PollingSource {
+	var (
+		modTime time.Time
+		size    int64 = -1
+	)
+	return &rbac.PollingSource{
+		SourceName: path,
+		Interval:   interval,
+		Fetch: func(context.Context) ([]rbac.StandardPolicy, error) {
+			info, err := os.Stat(path)
+			if err != nil {
+				return nil, err
+			}
+			if info.ModTime().Equal(modTime) && info.Size() == size {
+				return nil, rbac.ErrNotModified
+			}
+			document, err := LoadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			modTime, size = info.ModTime(), info.Size()
+			return document.Policies, nil
+		},
+	}
+}
+
+// NewHTTPSource returns a PolicySource which polls url for a policy file in format every interval.
+// Responses are only parsed when their ETag changes. http.DefaultClient is used if client is nil.
+func NewHTTPSource(url string, format Format, client *http.Client, interval time.Duration) *rbac.PollingSource {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	var etag string
+	return &rbac.PollingSource{
+		SourceName: url,
+		Interval:   interval,
+		Fetch: func(ctx context.Context) ([]rbac.StandardPolicy, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			if etag != "" {
+				req.Header.Set("If-None-Match", etag)
+			}
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+			switch resp.StatusCode {
+			case http.StatusOK:
+			case http.StatusNotModified:
+				return nil, rbac.ErrNotModified
+			default:
+				return nil, fmt.Errorf("RBAC: failed to fetch policies from %s, %s", url, resp.Status)
+			}
+			document, err := Load(resp.Body, format)
+			if err != nil {
+				return nil, err
+			}
+			etag = resp.Header.Get("ETag")
+			return document.Policies, nil
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package policyfile
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-pandora/pkg/rbac"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), `policies.yaml`)
+	assert := assert.New(t)
+	assert.Nil(os.WriteFile(path, []byte(yamlPolicies), 0644))
+
+	source := NewFileSource(path, time.Hour)
+	policies, err := source.Fetch(context.Background())
+	assert.Nil(err)
+	assert.Equal(expectedPolicies, policies)
+	_, err = source.Fetch(context.Background())
+	assert.ErrorIs(err, rbac.ErrNotModified)
+
+	assert.Nil(os.WriteFile(path, []byte("policies:\n  - uri: /a*\n    groups: []\n"), 0644))
+	_, err = source.Fetch(context.Background())
+	assert.ErrorIs(err, ErrInvalidWildcard)
+
+	assert.Nil(os.WriteFile(path, []byte("policies: []\n"), 0644))
+	policies, err = source.Fetch(context.Background())
+	assert.Nil(err)
+	assert.Empty(policies)
+}
+
+func TestHTTPSource(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if r.Header.Get(`If-None-Match`) == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set(`ETag`, `"v1"`)
+		w.Write([]byte(jsonPolicies))
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []rbac.PolicyEvent
+	manager := rbac.NewPolicyManager(nil)
+	manager.Subscribe(func(e rbac.PolicyEvent) {
+		events = append(events, e)
+	})
+	source := NewHTTPSource(server.URL, JSON, server.Client(), time.Millisecond)
+	go func() {
+		for requests.Load() < 3 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	assert := assert.New(t)
+	assert.ErrorIs(manager.Watch(ctx, source), context.Canceled)
+	assert.Equal(1, len(events))
+	assert.Equal(server.URL, events[0].Source)
+	assert.Equal(expectedPolicies, manager.Current().StandardPolicies())
+}
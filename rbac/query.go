@@ -0,0 +1,329 @@
+package rbac
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// Grant is a permission effective for a role, such as an item of a menu a UI renders.
+// It encodes to JSON with names of operations, like {"uri":"/orders/:id","operations":["read"],"effect":"allow"}.
+type Grant struct {
+	URI       string
+	Operation Operation
+	Effect    Effect
+
+	// From is the role the permission is inherited from, or 0 if it is given to the role itself.
+	From int64
+
+	// Conditions must pass for the permission to apply.
+	Conditions []string
+}
+
+type grantJSON struct {
+	URI        string   `json:"uri"`
+	Operations []string `json:"operations"`
+	Effect     string   `json:"effect"`
+	From       int64    `json:"from,omitempty"`
+	Conditions []string `json:"conditions,omitempty"`
+}
+
+func (g Grant) MarshalJSON() ([]byte, error) {
+	return json.Marshal(grantJSON{
+		URI:        g.URI,
+		Operations: append([]string{}, g.Operation.Names()...),
+		Effect:     g.Effect.String(),
+		From:       g.From,
+		Conditions: g.Conditions,
+	})
+}
+
+func (g *Grant) UnmarshalJSON(data []byte) error {
+	var v grantJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	operation, err := ParseOperation(strings.Join(v.Operations, "|"))
+	if err != nil {
+		return err
+	}
+	effect, err := ParseEffect(v.Effect)
+	if err != nil {
+		return err
+	}
+	*g = Grant{URI: v.URI, Operation: operation, Effect: effect, From: v.From, Conditions: v.Conditions}
+	return nil
+}
+
+// key identifies grants which can be compared by their operations.
+func (g *Grant) key() string {
+	return g.Effect.String() + " " + g.URI + " " + strings.Join(g.Conditions, ",")
+}
+
+// PermissionDiff compares effective permissions of two roles.
+type PermissionDiff struct {
+	// Added are granted to the second role but not to the first one, and Removed the other way round.
+	Added   []Grant `json:"added"`
+	Removed []Grant `json:"removed"`
+
+	// Common are granted to both roles.
+	Common []Grant `json:"common"`
+}
+
+// DiffPermissions compares permissions of two roles, operation by operation.
+func DiffPermissions(from, to []Grant) PermissionDiff {
+	diff := PermissionDiff{Added: []Grant{}, Removed: []Grant{}, Common: []Grant{}}
+	index := func(grants []Grant) map[string]Operation {
+		ops := make(map[string]Operation, len(grants))
+		for i := range grants {
+			ops[grants[i].key()] |= grants[i].Operation
+		}
+		return ops
+	}
+	fromOps, toOps := index(from), index(to)
+	collect := func(grants []Grant, ops map[string]Operation, other map[string]Operation, only *[]Grant, common *[]Grant) {
+		done := make(map[string]bool)
+		for _, g := range grants {
+			key := g.key()
+			if done[key] {
+				continue
+			}
+			done[key] = true
+			if op := ops[key] &^ other[key]; op != Nil {
+				g.Operation = op
+				*only = append(*only, g)
+			}
+			if common != nil {
+				if op := ops[key] & other[key]; op != Nil {
+					g.Operation, g.From = op, 0
+					*common = append(*common, g)
+				}
+			}
+		}
+	}
+	collect(from, fromOps, toOps, &diff.Removed, &diff.Common)
+	collect(to, toOps, fromOps, &diff.Added, nil)
+	return diff
+}
+
+// RolePermissions returns permissions effective for a role by policies of the tree, in the order of the tree,
+// including the ones inherited through the hierarchy. For every policy, operations the role is granted
+// and denied are combined by the combining algorithm of the tree. Groups with conditions are returned
+// by themselves, with the operations no unconditional rule denies.
+func (t *PolicyTree) RolePermissions(roleID int64) []Grant {
+	grants := []Grant{}
+	t.walk(func(node *PolicyTree) {
+		if node.uri != "" {
+			grants = append(grants, node.roleGrants(roleID, t.hierarchy, t.algorithm)...)
+		}
+	})
+	return grants
+}
+
+// roleGrants decides every operation of the policy of a node for a role.
+func (t *PolicyTree) roleGrants(roleID int64, h *hierarchy, algorithm CombiningAlgorithm) []Grant {
+	var all Operation
+	for _, group := range t.groups {
+		all |= group.Operation
+	}
+	// from returns the role of group which the role inherits the group from. Deny groups are not inherited.
+	from := func(group PermissionGroup) (int64, bool) {
+		if containsID(group.RoleID, roleID) {
+			return 0, true
+		}
+		if group.Effect == Deny {
+			return 0, false
+		}
+		for _, id := range group.RoleID {
+			if containsID(h.expand([]int64{id}), roleID) {
+				return id, true
+			}
+		}
+		return 0, false
+	}
+
+	allow := Grant{URI: t.uri, Effect: Allow}
+	deny := Grant{URI: t.uri, Effect: Deny}
+	for bit := Operation(1); bit != 0 && bit <= all; bit <<= 1 {
+		if all&bit == 0 {
+			continue
+		}
+		var rules []Rule
+		for _, group := range t.groups {
+			if group.include(bit) && len(group.RoleID) > 0 && !(group.Effect == Allow && len(group.Conditions) > 0) {
+				rules = append(rules, Rule{Pattern: t.uri, Group: group})
+			}
+		}
+		i, _ := algorithm.combine(rules, func(rule Rule) (int64, bool) {
+			_, ok := from(rule.Group)
+			return roleID, ok
+		})
+		if i < 0 {
+			continue
+		}
+		grant := &allow
+		if rules[i].Group.Effect == Deny {
+			grant = &deny
+		}
+		grant.Operation |= bit
+		if id, _ := from(rules[i].Group); grant.From == 0 {
+			grant.From = id
+		}
+	}
+
+	var grants []Grant
+	if allow.Operation != Nil {
+		grants = append(grants, allow)
+	}
+	if deny.Operation != Nil {
+		grants = append(grants, deny)
+	}
+	for _, group := range t.groups {
+		if group.Effect != Allow || len(group.Conditions) == 0 {
+			continue
+		}
+		id, ok := from(group)
+		if op := group.Operation &^ deny.Operation; ok && op != Nil {
+			grants = append(grants, Grant{URI: t.uri, Operation: op, Effect: Allow, From: id, Conditions: group.Conditions})
+		}
+	}
+	return grants
+}
+
+// RolesFor returns every role which policies grant op on uri if their conditions pass,
+// including roles inheriting the permission, in ascending order.
+func (t *PolicyTree) RolesFor(uri string, op Operation) []int64 {
+	roleID, _ := t.Require(uri, op)
+	roleID = append([]int64{}, roleID...)
+	sort.Slice(roleID, func(i, j int) bool { return roleID[i] < roleID[j] })
+	return roleID
+}
+
+// DiffRoles compares permissions effective for two roles by policies of the tree.
+func (t *PolicyTree) DiffRoles(from, to int64) PermissionDiff {
+	return DiffPermissions(t.RolePermissions(from), t.RolePermissions(to))
+}
+
+// PermissionQuerier is implemented by Policies which can enumerate what roles are granted.
+type PermissionQuerier interface {
+	RolePermissions(roleID int64) []Grant
+	RolesFor(uri string, op Operation) []int64
+}
+
+// RolePermissions returns permissions effective for a role by the current policies, if they can be enumerated.
+func (p *PolicyManager) RolePermissions(roleID int64) []Grant {
+	if querier, ok := p.load().Policies.(PermissionQuerier); ok {
+		return querier.RolePermissions(roleID)
+	}
+	return []Grant{}
+}
+
+// RolesFor returns every role which the current policies grant op on uri, if they can be enumerated.
+func (p *PolicyManager) RolesFor(uri string, op Operation) []int64 {
+	if querier, ok := p.load().Policies.(PermissionQuerier); ok {
+		return querier.RolesFor(uri, op)
+	}
+	return []int64{}
+}
+
+// Operations returns every operation the most specific permissions matching uri grant.
+func (t *PermissionTree) Operations(uri string) Operation {
+	var all Operation
+	t.walk(``, func(_ string, node *PermissionTree) {
+		all |= node.operation
+	})
+	return grantedOperations(t, uri, all)
+}
+
+// Operations returns every operation permissions matching uri grant and no deny permission forbids.
+func (l *PermissionList) Operations(uri string) Operation {
+	var all Operation
+	for _, permission := range *l {
+		all |= permission.Operation
+	}
+	return grantedOperations(l, uri, all)
+}
+
+// grantedOperations returns the operations of candidates which permissions grant on uri one by one.
+func grantedOperations(permissions Permissions, uri string, candidates Operation) Operation {
+	var granted Operation
+	for bit := Operation(1); bit != 0 && bit <= candidates; bit <<= 1 {
+		if candidates&bit != 0 && permissions.HasPermission(uri, bit) {
+			granted |= bit
+		}
+	}
+	return granted
+}
+
+// RolePermissions returns permissions of a role and the ones it inherits from its subordinates,
+// which roles keep in a PermissionTree or a PermissionList. Subordinates are found by ranging over roles.
+func RolePermissions(roles Roles, roleID int64) []Grant {
+	grants := []Grant{}
+	role := roles.GetRole(roleID)
+	if role == nil {
+		return grants
+	}
+	add := func(r Role, from int64) {
+		for _, p := range listPermissions(r) {
+			grants = append(grants, Grant{URI: p.URI, Operation: p.Operation, Effect: p.Effect, From: from})
+		}
+	}
+	add(role, 0)
+	for _, subordinate := range subordinates(roles, role) {
+		add(subordinate, subordinate.ID())
+	}
+	return grants
+}
+
+// RolesFor returns every role whose permissions, or permissions of one of its subordinates,
+// grant op on uri, in ascending order.
+func RolesFor(roles Roles, uri string, op Operation) []int64 {
+	roleID := []int64{}
+	ranger, ok := roles.(interface{ Range(func(Role) bool) })
+	if !ok {
+		return roleID
+	}
+	var granted []Role
+	ranger.Range(func(role Role) bool {
+		if hasPermission(role, uri, op) {
+			granted = append(granted, role)
+		}
+		return true
+	})
+	ranger.Range(func(role Role) bool {
+		for _, r := range granted {
+			if r.ID() == role.ID() || roles.IsSuperior(role, r) {
+				roleID = append(roleID, role.ID())
+				break
+			}
+		}
+		return true
+	})
+	sort.Slice(roleID, func(i, j int) bool { return roleID[i] < roleID[j] })
+	return roleID
+}
+
+// hasPermission is like Role.HasPermission, but a StandardRole without permissions has none.
+func hasPermission(role Role, uri string, op Operation) bool {
+	if standard, ok := role.(*StandardRole); ok && standard.Permissions == nil {
+		return false
+	}
+	return role.HasPermission(uri, op)
+}
+
+// subordinates returns every role role is superior to, in ascending order of ids.
+func subordinates(roles Roles, role Role) []Role {
+	ranger, ok := roles.(interface{ Range(func(Role) bool) })
+	if !ok {
+		return nil
+	}
+	var list []Role
+	ranger.Range(func(r Role) bool {
+		if r.ID() != role.ID() && roles.IsSuperior(role, r) {
+			list = append(list, r)
+		}
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].ID() < list[j].ID() })
+	return list
+}
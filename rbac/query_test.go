@@ -0,0 +1,136 @@
+package rbac
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyTree_RolePermissions(t *testing.T) {
+	roles := NewRoleManager()
+	roles.SetRole(&StandardRole{Id: 1, Name: `admin`})
+	roles.SetRole(&StandardRole{Id: 2, Name: `editor`, ParentId: 1})
+	roles.SetRole(&StandardRole{Id: 3, Name: `viewer`, ParentId: 2})
+
+	tree := NewPolicyTree()
+	tree.SetHierarchy(roles, ParentInherits)
+	tree.LoadPolicies([]StandardPolicy{
+		{`/articles/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{3}}}},
+		{`/articles/:id`, []PermissionGroup{
+			{Operation: RU, RoleID: []int64{2}},
+			{Operation: Update, RoleID: []int64{1}, Effect: Deny},
+			{Operation: Delete, RoleID: []int64{2}, Conditions: []string{`owner`}},
+		}},
+		{`/admin`, []PermissionGroup{{Operation: CRUD, RoleID: []int64{1}}}},
+	})
+
+	assert := assert.New(t)
+	assert.Equal([]Grant{
+		{URI: `/articles/**`, Operation: Read, Effect: Allow, From: 3},
+		{URI: `/articles/:id`, Operation: Read, Effect: Allow, From: 2},
+		{URI: `/articles/:id`, Operation: Update, Effect: Deny},
+		{URI: `/articles/:id`, Operation: Delete, Effect: Allow, From: 2, Conditions: []string{`owner`}},
+		{URI: `/admin`, Operation: CRUD, Effect: Allow},
+	}, tree.RolePermissions(1))
+	assert.Equal([]Grant{
+		{URI: `/articles/**`, Operation: Read, Effect: Allow},
+	}, tree.RolePermissions(3))
+	assert.Equal([]Grant{}, tree.RolePermissions(4))
+
+	tree.SetCombiningAlgorithm(PermitOverrides)
+	assert.Equal(Grant{URI: `/articles/:id`, Operation: RU, Effect: Allow, From: 2}, tree.RolePermissions(1)[1])
+
+	assert.Equal([]int64{1, 2, 3}, tree.RolesFor(`/articles/1/comments`, Read))
+	assert.Equal([]int64{1, 2}, tree.RolesFor(`/articles/1`, Update))
+	assert.Equal([]int64{1, 2}, tree.RolesFor(`/articles/1`, Delete))
+	assert.Equal([]int64{}, tree.RolesFor(`/users`, Read))
+
+	manager := NewPolicyManager(func() Policies { return tree })
+	manager.LoadPolicies([]StandardPolicy{{`/admin`, []PermissionGroup{{Operation: CRUD, RoleID: []int64{1}}}}})
+	assert.Equal([]Grant{{URI: `/admin`, Operation: CRUD, Effect: Allow}}, manager.RolePermissions(1))
+	assert.Equal([]int64{1}, manager.RolesFor(`/admin`, Create))
+}
+
+func TestPolicyTree_DiffRoles(t *testing.T) {
+	tree := NewPolicyTree()
+	tree.LoadPolicies([]StandardPolicy{
+		{`/articles/:id`, []PermissionGroup{
+			{Operation: CRUD, RoleID: []int64{1}},
+			{Operation: RU, RoleID: []int64{2}},
+		}},
+		{`/stats`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}},
+	})
+
+	assert := assert.New(t)
+	diff := tree.DiffRoles(1, 2)
+	assert.Equal(PermissionDiff{
+		Added:   []Grant{{URI: `/stats`, Operation: Read, Effect: Allow}},
+		Removed: []Grant{{URI: `/articles/:id`, Operation: Create | Delete, Effect: Allow}},
+		Common:  []Grant{{URI: `/articles/:id`, Operation: RU, Effect: Allow}},
+	}, diff)
+
+	data, err := json.Marshal(diff)
+	assert.Nil(err)
+	assert.JSONEq(`{
+		"added": [{"uri": "/stats", "operations": ["read"], "effect": "allow"}],
+		"removed": [{"uri": "/articles/:id", "operations": ["create", "delete"], "effect": "allow"}],
+		"common": [{"uri": "/articles/:id", "operations": ["read", "update"], "effect": "allow"}]
+	}`, string(data))
+
+	var decoded PermissionDiff
+	assert.Nil(json.Unmarshal(data, &decoded))
+	assert.Equal(diff, decoded)
+}
+
+func TestRolePermissions(t *testing.T) {
+	editor := &StandardRole{Id: 2, Name: `editor`, ParentId: 1, Permissions: NewPermissionTree()}
+	editor.Permissions.Add(&StandardPermission{URI: `/articles/:id`, Operation: RU})
+	editor.Permissions.Add(&StandardPermission{URI: `/articles/:id`, Operation: Delete, Effect: Deny})
+	viewer := &StandardRole{Id: 3, Name: `viewer`, ParentId: 2, Permissions: NewPermissionList()}
+	viewer.Permissions.Add(&StandardPermission{URI: `/articles/**`, Operation: Read})
+
+	roles := NewRoleManager()
+	roles.SetRole(&StandardRole{Id: 1, Name: `admin`})
+	roles.SetRole(editor)
+	roles.SetRole(viewer)
+
+	assert := assert.New(t)
+	assert.Equal([]Grant{
+		{URI: `/articles/:id`, Operation: RU, Effect: Allow, From: 2},
+		{URI: `/articles/:id`, Operation: Delete, Effect: Deny, From: 2},
+		{URI: `/articles/**`, Operation: Read, Effect: Allow, From: 3},
+	}, RolePermissions(roles, 1))
+	assert.Equal([]Grant{{URI: `/articles/**`, Operation: Read, Effect: Allow}}, RolePermissions(roles, 3))
+	assert.Equal([]Grant{}, RolePermissions(roles, 9))
+
+	assert.Equal([]int64{1, 2, 3}, RolesFor(roles, `/articles/1/comments`, Read))
+	assert.Equal([]int64{1, 2}, RolesFor(roles, `/articles/1`, Update))
+	assert.Equal([]int64{}, RolesFor(roles, `/articles/1`, Delete))
+
+	diff := DiffPermissions(RolePermissions(roles, 3), RolePermissions(roles, 2))
+	assert.Equal(2, len(diff.Added))
+	assert.Equal([]Grant{}, diff.Removed)
+	assert.Equal([]Grant{{URI: `/articles/**`, Operation: Read, Effect: Allow}}, diff.Common)
+}
+
+func TestPermissions_Operations(t *testing.T) {
+	permissions := []StandardPermission{
+		{URI: `/articles/**`, Operation: Read},
+		{URI: `/articles/:id`, Operation: RU},
+		{URI: `/articles/:id`, Operation: Update, Effect: Deny},
+		{URI: `/admin`, Operation: CRUD},
+	}
+	tree := NewPermissionTree()
+	tree.Load(permissions)
+	list := NewPermissionList()
+	list.Load(permissions)
+
+	assert := assert.New(t)
+	for _, p := range []interface{ Operations(string) Operation }{tree, list} {
+		assert.Equal(Read, p.Operations(`/articles/1`))
+		assert.Equal(Read, p.Operations(`/articles/1/comments`))
+		assert.Equal(CRUD, p.Operations(`/admin`))
+		assert.Equal(Nil, p.Operations(`/users`))
+	}
+}
@@ -1,41 +1,308 @@
+// Package rbac decides whether roles may operate resources by policies of URI patterns.
+//
+// Policies grant operations to roles, and deny rules forbid them. How the rules of every policy which matches
+// a request are combined is chosen by CombiningAlgorithm. The default, MostSpecific, lets the most specific
+// policy with rules for an operation decide alone, for every role: a policy at "/data/secret/**" which only
+// denies role 7 also hides the allow of "/data/**" from every other role. To let role 7 read "/data/**"
+// except "/data/secret/**" while other roles keep reading it, use DenyOverrides:
+//
+//	tree := rbac.NewPolicyTree()
+//	tree.SetCombiningAlgorithm(rbac.DenyOverrides)
+//	tree.LoadPolicies([]rbac.StandardPolicy{
+//		{URI: "/data/**", Groups: []rbac.PermissionGroup{{Operation: rbac.Read, RoleID: []int64{7, 8}}}},
+//		{URI: "/data/secret/**", Groups: []rbac.PermissionGroup{{Operation: rbac.Read, RoleID: []int64{7}, Effect: rbac.Deny}}},
+//	})
 package rbac
 
-import "sync"
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pandora/pkg/audit"
+	"github.com/go-pandora/pkg/metrics"
+	"go.opentelemetry.io/otel/trace"
+)
 
 type AccessControl struct {
 	Policies
 	Roles
+
+	// Audit receives an event for every authorization decision, if it is set.
+	Audit audit.Sink
+
+	// Metrics receives the count of decisions and the latency of policy lookups, if it is set.
+	Metrics metrics.Recorder
+
+	// TracerProvider creates spans around policy lookups.
+	// The global TracerProvider of OpenTelemetry is used if it is nil.
+	TracerProvider trace.TracerProvider
+
+	// Assignments provides roles of users for Enforce, if it is set.
+	Assignments Assignments
+
+	// MethodOperations maps HTTP methods onto operations for the middlewares.
+	// Requests of a method which is not in it are not authorized.
+	// DefaultMethodOperations is used if it is nil.
+	MethodOperations map[string]Operation
+
+	// Conditions are referred by PermissionGroup.Conditions of policies.
+	Conditions *Conditions
+
+	// ResourceResolver provides attributes of resources to conditions, if it is set.
+	ResourceResolver ResourceResolver
+
+	// Relationships grant requests to subjects related to requested objects in Check, if it is set.
+	Relationships *Relationships
+
+	// Constraints deny requests of subjects whose roles break them together, if it is set.
+	Constraints *Constraints
 }
 
+// PolicyManager holds policies which are rebuilt aside and swapped in as a whole on every load,
+// so reads never wait for a reload. Every swap makes a new version, and the previous one is kept for Rollback.
 type PolicyManager struct {
-	mu       sync.RWMutex
-	policies Policies
+	// mu serializes writers. Readers only load current.
+	mu        sync.Mutex
+	factory   func() Policies
+	current   atomic.Pointer[PolicyVersion]
+	previous  *PolicyVersion
+	version   uint64
+	listeners []func(PolicyEvent)
+
+	// swaps counts every swap, including rollbacks which bring an older version back.
+	swaps atomic.Uint64
+}
+
+// NewPolicyManager returns a PolicyManager which builds policies of every version with factory,
+// so that options such as the hierarchy of a PolicyTree can be set on them. NewPolicyTree is used if it is nil.
+func NewPolicyManager(factory func() Policies) *PolicyManager {
+	p := &PolicyManager{factory: factory}
+	p.current.Store(&PolicyVersion{Policies: p.build(nil), Hash: hashPolicies(nil)})
+	return p
 }
 
 func NewAccessControl(policies Policies, roles Roles) *AccessControl {
-	return &AccessControl{policies, roles}
+	return &AccessControl{Policies: policies, Roles: roles}
+}
+
+// IsGranted shows whether a user who have the role can operate a resource and audits the decision.
+// Conditions of policies are evaluated without any attribute of the user.
+// A nil role is a user without roles, which is only granted resources no policy requires a role for.
+func (ac *AccessControl) IsGranted(uri string, op Operation, role Role) bool {
+	var roleID []int64
+	if role != nil {
+		roleID = []int64{role.ID()}
+	}
+	return ac.Authorize(context.Background(), &Request{
+		URI:       uri,
+		Operation: op,
+		Subject:   Subject{RoleID: roleID},
+		Env:       Environment{Time: time.Now()},
+	}).Granted
 }
 
+// Require determines whether a request needs authorization and returns all roles that have the permission.
+func (ac *AccessControl) Require(uri string, op Operation) ([]int64, bool) {
+	return ac.require(context.Background(), uri, op)
+}
+
+// LoadPolicies builds new policies and swaps them in. It does nothing if policies have not changed.
 func (p *PolicyManager) LoadPolicies(policies []StandardPolicy) {
+	p.Load(policies, "")
+}
+
+// Load builds new policies from source and swaps them in, unless they have the same hash as the current ones.
+// It returns the current version.
+func (p *PolicyManager) Load(policies []StandardPolicy, source string) *PolicyVersion {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.policies.LoadPolicies(policies)
+	return p.swap(p.load(), policies, source)
 }
 
-func (p *PolicyManager) Require(uri string, op Operation) ([]int64, bool) {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return p.policies.Require(uri, op)
+// LoadIf is like Load, but only swaps policies in while version is the current one, so that policies
+// changed from the current ones are not lost to a concurrent load. It returns ErrVersionConflict otherwise.
+func (p *PolicyManager) LoadIf(version uint64, policies []StandardPolicy, source string) (*PolicyVersion, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current := p.load()
+	if current.Version != version {
+		return current, fmt.Errorf("%w: version %d is current, not %d", ErrVersionConflict, current.Version, version)
+	}
+	return p.swap(current, policies, source), nil
 }
 
-func (p *PolicyManager) Destroy() {
+// swap builds policies and swaps them in for current, unless they have the same hash.
+// It must be called with mu held.
+func (p *PolicyManager) swap(current *PolicyVersion, policies []StandardPolicy, source string) *PolicyVersion {
+	hash := hashPolicies(policies)
+	if current.Hash == hash {
+		return current
+	}
+	// Policies are built before the swap, so that readers keep using the current ones meanwhile.
+	p.version++
+	next := &PolicyVersion{
+		Version:  p.version,
+		Hash:     hash,
+		Source:   source,
+		LoadedAt: time.Now(),
+		Policies: p.build(policies),
+		policies: policies,
+	}
+	p.current.Store(next)
+	p.swaps.Add(1)
+	p.previous = current
+	p.emit(PolicyEvent{Type: PolicyLoaded, Version: next.Version, Previous: current.Version, Hash: hash, Source: source})
+	return next
+}
+
+// Rollback swaps the previous version in again. Rolling back twice restores the version rolled back from.
+func (p *PolicyManager) Rollback() (*PolicyVersion, error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.policies.Destroy()
+	if p.previous == nil {
+		return nil, ErrNoPreviousVersion
+	}
+	current, previous := p.load(), p.previous
+	p.current.Store(previous)
+	p.swaps.Add(1)
+	p.previous = current
+	p.emit(PolicyEvent{Type: PolicyRolledBack, Version: previous.Version, Previous: current.Version, Hash: previous.Hash, Source: previous.Source})
+	return previous, nil
+}
+
+// Current returns the version of the policies in use.
+func (p *PolicyManager) Current() *PolicyVersion {
+	return p.load()
+}
+
+// Generation changes whenever policies are swapped, by a load or a rollback.
+func (p *PolicyManager) Generation() uint64 {
+	return p.swaps.Load()
+}
+
+// Previous returns the version which Rollback would swap in, or nil.
+func (p *PolicyManager) Previous() *PolicyVersion {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.previous
+}
+
+// Subscribe registers f to receive an event whenever policies are swapped or fail to load.
+// f is called while loading, so it must not load policies itself.
+func (p *PolicyManager) Subscribe(f func(PolicyEvent)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.listeners = append(p.listeners, f)
+}
+
+// Watch loads policies from source whenever they change until ctx is done.
+// A failed fetch keeps the current policies and is reported as a PolicyLoadFailed event.
+func (p *PolicyManager) Watch(ctx context.Context, source PolicySource) error {
+	return source.Watch(ctx, func(policies []StandardPolicy, err error) {
+		if err != nil {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			p.emit(PolicyEvent{Type: PolicyLoadFailed, Version: p.load().Version, Source: source.Name(), Err: err})
+			return
+		}
+		p.Load(policies, source.Name())
+	})
+}
+
+func (p *PolicyManager) Require(uri string, op Operation) ([]int64, bool) {
+	return p.load().Policies.Require(uri, op)
+}
+
+// Destroy swaps empty policies in.
+func (p *PolicyManager) Destroy() {
+	p.Load(nil, "")
 }
 
 func (p *PolicyManager) IsGranted(uri string, op Operation, role Role) bool {
-	p.mu.RLock()
-	defer p.mu.RUnlock()
-	return p.policies.IsGranted(uri, op, role)
+	return p.load().Policies.IsGranted(uri, op, role)
+}
+
+// Lookup finds the policies which apply to a request. It finds nothing if CanLookup is false,
+// which must not be taken for a request no policy applies to.
+func (p *PolicyManager) Lookup(uri string, op Operation) (PolicyMatch, bool) {
+	lookup, ok := policyLookup(p.load().Policies)
+	if !ok {
+		return PolicyMatch{}, false
+	}
+	return lookup.Lookup(uri, op)
+}
+
+// CanLookup shows whether the policies built by the factory implement PolicyLookup,
+// otherwise AccessControl decides requests by Require.
+func (p *PolicyManager) CanLookup() bool {
+	_, ok := policyLookup(p.load().Policies)
+	return ok
+}
+
+// HasHierarchy shows whether the policies built by the factory grant permissions along the hierarchy of roles
+// as SetHierarchy of PolicyTree decides, otherwise AccessControl grants superiors of the required roles.
+func (p *PolicyManager) HasHierarchy() bool {
+	return hasHierarchy(p.load().Policies)
+}
+
+// load returns the current version, creating an empty one for a PolicyManager which is not made by NewPolicyManager.
+func (p *PolicyManager) load() *PolicyVersion {
+	if current := p.current.Load(); current != nil {
+		return current
+	}
+	p.current.CompareAndSwap(nil, &PolicyVersion{Policies: p.build(nil), Hash: hashPolicies(nil)})
+	return p.current.Load()
+}
+
+func (p *PolicyManager) build(policies []StandardPolicy) Policies {
+	var built Policies
+	if p.factory != nil {
+		built = p.factory()
+	} else {
+		built = NewPolicyTree()
+	}
+	built.LoadPolicies(policies)
+	return built
+}
+
+func (p *PolicyManager) emit(e PolicyEvent) {
+	e.Time = time.Now()
+	for _, f := range p.listeners {
+		f(e)
+	}
+}
+
+// RoleIDs converts a value holding role ids, such as a claim decoded from a JSON Web Token, into []int64.
+func RoleIDs(v interface{}) ([]int64, bool) {
+	switch ids := v.(type) {
+	case []int64:
+		return ids, true
+	case int64:
+		return []int64{ids}, true
+	case float64:
+		return []int64{int64(ids)}, true
+	case int:
+		return []int64{int64(ids)}, true
+	case []int:
+		roleID := make([]int64, 0, len(ids))
+		for _, id := range ids {
+			roleID = append(roleID, int64(id))
+		}
+		return roleID, true
+	case []interface{}:
+		roleID := make([]int64, 0, len(ids))
+		for _, id := range ids {
+			converted, ok := RoleIDs(id)
+			if !ok || len(converted) != 1 {
+				return nil, false
+			}
+			roleID = append(roleID, converted[0])
+		}
+		return roleID, true
+	default:
+		return nil, false
+	}
 }
@@ -1,18 +1,22 @@
 package rbac
 
 import (
-	"github.com/stretchr/testify/assert"
+	"errors"
+	"sync"
 	"testing"
+
+	"github.com/go-pandora/pkg/audit"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestPolicyManager_LoadPolicies(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CR, []int64{1, 2, 3}},
-			{Read, []int64{9, 10}},
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
+			{Operation: Read, RoleID: []int64{9, 10}},
 		}},
 		{`/auth/user/*`, []PermissionGroup{
-			{CRUD, []int64{5}},
+			{Operation: CRUD, RoleID: []int64{5}},
 		}},
 	}
 
@@ -23,11 +27,11 @@ func TestPolicyManager_LoadPolicies(t *testing.T) {
 func TestPolicyManager_RequireAuth(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CR, []int64{1, 2, 3}},
-			{Read, []int64{9, 10}},
+			{Operation: CR, RoleID: []int64{1, 2, 3}},
+			{Operation: Read, RoleID: []int64{9, 10}},
 		}},
 		{`/auth/user/*`, []PermissionGroup{
-			{CRUD, []int64{5}},
+			{Operation: CRUD, RoleID: []int64{5}},
 		}},
 	}
 
@@ -51,9 +55,9 @@ func TestPolicyManager_RequireAuth(t *testing.T) {
 func TestPolicyManager_IsGranted(t *testing.T) {
 	policies := []StandardPolicy{
 		{`/data/**`, []PermissionGroup{
-			{CRUD, []int64{1}},
-			{CR, []int64{2, 3}},
-			{Read, []int64{5, 10}},
+			{Operation: CRUD, RoleID: []int64{1}},
+			{Operation: CR, RoleID: []int64{2, 3}},
+			{Operation: Read, RoleID: []int64{5, 10}},
 		}},
 	}
 
@@ -79,4 +83,212 @@ func TestPolicyManager_IsGranted(t *testing.T) {
 	assert.False(ac.IsGranted(`/data/image`, Create, &roles[4]))
 	assert.False(ac.IsGranted(`/data/image`, Read, &roles[4]))
 	assert.False(ac.IsGranted(`/data/image`, Update, &roles[5]))
+	assert.False(ac.IsGranted(`/data/image`, Read, nil))
+	assert.True(ac.IsGranted(`/public`, Read, nil))
+}
+
+func TestAccessControl_IsGranted_Inheritance(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{3, `role1`, nil, 1},
+	}
+	manager := NewRoleManager()
+	for i := range roles {
+		manager.SetRole(&roles[i])
+	}
+
+	assert := assert.New(t)
+	for _, c := range []struct {
+		inheritance Inheritance
+		admin       bool
+	}{
+		{NoInheritance, false},
+		{ChildInherits, false},
+		{ParentInherits, true},
+	} {
+		tree := NewPolicyTree()
+		tree.SetHierarchy(manager, c.inheritance)
+		ac := NewAccessControl(tree, manager)
+		ac.LoadPolicies(policies)
+		assert.Equal(c.admin, ac.IsGranted(`/data/image`, Read, &roles[0]), c.inheritance)
+		assert.True(ac.IsGranted(`/data/image`, Read, &roles[1]))
+	}
+
+	// without a hierarchy of the policies, superiors are granted through roles of the access control
+	ac := NewAccessControl(NewPolicyTree(), manager)
+	ac.LoadPolicies(policies)
+	assert.True(ac.IsGranted(`/data/image`, Read, &roles[0]))
+	assert.False(ac.IsGranted(`/data/image`, Read, nil))
+	ac = NewAccessControl(NewPolicyManager(nil), manager)
+	ac.LoadPolicies(policies)
+	assert.True(ac.IsGranted(`/data/image`, Read, &roles[0]))
+}
+
+func TestAccessControl_Audit(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{2}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{2, `roleManager`, nil, 1},
+	}
+
+	var events []audit.Event
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.Audit = audit.SinkFunc(func(e audit.Event) {
+		events = append(events, e)
+	})
+	ac.LoadPolicies(policies)
+
+	assert := assert.New(t)
+	assert.True(ac.IsGranted(`/data/image`, Read, &roles[1]))
+	assert.False(ac.IsGranted(`/data/image`, Read, &roles[0]))
+	assert.Equal(2, len(events))
+	assert.Equal(audit.AccessGranted, events[0].Type)
+	assert.Equal(`/data/image`, events[0].Resource)
+	assert.Equal([]int64{2}, events[0].RoleID)
+	assert.Equal(audit.AccessDenied, events[1].Type)
+	assert.Equal([]int64{1}, events[1].RoleID)
+}
+
+func TestPolicyManager_Load(t *testing.T) {
+	v1 := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{1}},
+		}},
+	}
+	v2 := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{2}},
+		}},
+	}
+
+	var events []PolicyEvent
+	manager := NewPolicyManager(func() Policies {
+		tree := NewPolicyTree()
+		tree.SetCombiningAlgorithm(DenyOverrides)
+		return tree
+	})
+	manager.Subscribe(func(e PolicyEvent) {
+		events = append(events, e)
+	})
+
+	assert := assert.New(t)
+	assert.Equal(uint64(0), manager.Current().Version)
+	_, required := manager.Require(`/data/image`, Read)
+	assert.False(required)
+
+	first := manager.Load(v1, `v1`)
+	assert.Equal(uint64(1), first.Version)
+	assert.Equal(`v1`, first.Source)
+	assert.Equal(v1, first.StandardPolicies())
+	assert.Equal(DenyOverrides, first.Policies.(*PolicyTree).CombiningAlgorithm())
+	assert.Same(first, manager.Load(v1, `v1 again`))
+
+	second := manager.Load(v2, `v2`)
+	assert.Equal(uint64(2), second.Version)
+	assert.NotEqual(first.Hash, second.Hash)
+	assert.Same(first, manager.Previous())
+	roleID, _ := manager.Require(`/data/image`, Read)
+	assert.Equal([]int64{2}, roleID)
+
+	rolledBack, err := manager.Rollback()
+	assert.Nil(err)
+	assert.Same(first, rolledBack)
+	assert.Same(first, manager.Current())
+	roleID, _ = manager.Require(`/data/image`, Read)
+	assert.Equal([]int64{1}, roleID)
+
+	manager.Destroy()
+	assert.Equal(uint64(3), manager.Current().Version)
+	_, required = manager.Require(`/data/image`, Read)
+	assert.False(required)
+
+	assert.Equal(4, len(events))
+	assert.Equal(PolicyLoaded, events[0].Type)
+	assert.Equal(PolicyEvent{Type: PolicyLoaded, Version: 2, Previous: 1, Hash: second.Hash, Source: `v2`, Time: events[1].Time}, events[1])
+	assert.Equal(PolicyRolledBack, events[2].Type)
+	assert.Equal(uint64(1), events[2].Version)
+	assert.Equal(uint64(2), events[2].Previous)
+	assert.Equal(uint64(3), events[3].Version)
+
+	_, err = (&PolicyManager{}).Rollback()
+	assert.Equal(ErrNoPreviousVersion, err)
+}
+
+func TestPolicyManager_LoadIf(t *testing.T) {
+	v1 := []StandardPolicy{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}}
+	v2 := []StandardPolicy{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}}}
+	manager := NewPolicyManager(nil)
+
+	assert := assert.New(t)
+	read := manager.Current()
+	version, err := manager.LoadIf(read.Version, v1, `admin`)
+	assert.Nil(err)
+	assert.Equal(uint64(1), version.Version)
+
+	// policies loaded from another source since they were read are not overwritten
+	manager.Load(v2, `watch`)
+	current, err := manager.LoadIf(version.Version, nil, `admin`)
+	assert.True(errors.Is(err, ErrVersionConflict))
+	assert.Equal(uint64(2), current.Version)
+	assert.Equal(v2, manager.Current().StandardPolicies())
+}
+
+func TestPolicyManager_ConcurrentLoad(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: CR, RoleID: []int64{1}},
+		}},
+	}
+	var manager PolicyManager
+	ac := NewAccessControl(&manager, NewRoleManager())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				ac.Require(`/data/image`, Read)
+				ac.IsSubjectGranted(`/data/image`, Read, Subject{RoleID: []int64{1}})
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			ac.LoadPolicies(policies)
+		} else {
+			ac.Destroy()
+		}
+	}
+	wg.Wait()
+	assert.Equal(t, uint64(100), manager.Current().Version)
+}
+
+// requirePolicies hide every method of policies but the ones of Policies.
+type requirePolicies struct {
+	Policies
+}
+
+func TestPolicyManager_WithoutLookup(t *testing.T) {
+	manager := NewPolicyManager(func() Policies { return requirePolicies{NewPolicyTree()} })
+	manager.LoadPolicies([]StandardPolicy{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}})
+	ac := NewAccessControl(manager, NewRoleManager())
+
+	assert := assert.New(t)
+	assert.False(manager.CanLookup())
+	roleID, required := ac.Require(`/data/x`, Read)
+	assert.True(required)
+	assert.Equal([]int64{1}, roleID)
+	assert.False(ac.IsGranted(`/data/x`, Read, &StandardRole{Id: 99}))
+	assert.True(ac.IsGranted(`/data/x`, Read, &StandardRole{Id: 1}))
+	assert.True(ac.IsGranted(`/public`, Read, &StandardRole{Id: 99}))
 }
@@ -0,0 +1,366 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTuple = errors.New("RBAC: invalid tuple")
+
+// Tuple relates a subject to an object, such as user "42" being the "editor" of "document:17".
+// Objects are written as "type:id". Subjects are user ids, or "role:<id>" for every user holding a role,
+// so user ids must not contain ':' to be told apart from roles.
+type Tuple struct {
+	Subject  string
+	Relation string
+	Object   string
+}
+
+// String returns the tuple as "object#relation@subject".
+func (t Tuple) String() string {
+	return t.Object + "#" + t.Relation + "@" + t.Subject
+}
+
+func (t Tuple) validate() error {
+	if t.Subject == "" || t.Relation == "" || !strings.Contains(t.Object, ":") {
+		return fmt.Errorf("%w: %s", ErrInvalidTuple, t)
+	}
+	if strings.Contains(t.Subject, ":") && !isRoleSubject(t.Subject) {
+		return fmt.Errorf("%w: subject %q is neither a user id nor a role", ErrInvalidTuple, t.Subject)
+	}
+	return nil
+}
+
+// isRoleSubject shows whether subject is written by RoleSubject.
+func isRoleSubject(subject string) bool {
+	id, ok := strings.CutPrefix(subject, "role:")
+	if !ok {
+		return false
+	}
+	_, err := strconv.ParseInt(id, 10, 64)
+	return err == nil
+}
+
+// ObjectType returns the type of an object, such as "document" of "document:17".
+func ObjectType(object string) string {
+	if i := strings.IndexByte(object, ':'); i >= 0 {
+		return object[:i]
+	}
+	return ""
+}
+
+// RoleSubject returns the subject of tuples which relate every user holding a role to objects.
+func RoleSubject(roleID int64) string {
+	return "role:" + strconv.FormatInt(roleID, 10)
+}
+
+// Relations define the operations every relation grants on its object.
+// A relation implies another one if it grants all operations of the other one.
+type Relations map[string]Operation
+
+// DefaultRelations grant every operation to owners, reading and updating to editors and reading to viewers.
+var DefaultRelations = Relations{
+	"owner":  CRUD,
+	"editor": Read | Update,
+	"viewer": Read,
+}
+
+// Grants shows whether a relation grants op.
+func (r Relations) Grants(relation string, op Operation) bool {
+	granted, ok := r[relation]
+	return ok && op != Nil && granted&op == op
+}
+
+// Implies returns the relations which relation implies, including itself, in order.
+func (r Relations) Implies(relation string) []string {
+	granted, ok := r[relation]
+	if !ok {
+		return nil
+	}
+	var implied []string
+	for name, op := range r {
+		if granted&op == op {
+			implied = append(implied, name)
+		}
+	}
+	sort.Strings(implied)
+	return implied
+}
+
+// Tuples store relationship tuples.
+type Tuples interface {
+	// Write should add tuples, ignoring the ones which exist.
+	Write(tuples ...Tuple) error
+
+	// Delete should remove tuples, ignoring the ones which do not exist.
+	Delete(tuples ...Tuple) error
+
+	// Read should return the tuples which match filter, whose empty fields match anything.
+	Read(filter Tuple) ([]Tuple, error)
+}
+
+// TupleStore keeps tuples in memory, indexed by their subjects and objects.
+type TupleStore struct {
+	mu        sync.RWMutex
+	bySubject map[string]map[Tuple]struct{}
+	byObject  map[string]map[Tuple]struct{}
+}
+
+func NewTupleStore() *TupleStore {
+	return &TupleStore{
+		bySubject: make(map[string]map[Tuple]struct{}),
+		byObject:  make(map[string]map[Tuple]struct{}),
+	}
+}
+
+func (s *TupleStore) Write(tuples ...Tuple) error {
+	for _, t := range tuples {
+		if err := t.validate(); err != nil {
+			return err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		addTuple(s.bySubject, t.Subject, t)
+		addTuple(s.byObject, t.Object, t)
+	}
+	return nil
+}
+
+func (s *TupleStore) Delete(tuples ...Tuple) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range tuples {
+		removeTuple(s.bySubject, t.Subject, t)
+		removeTuple(s.byObject, t.Object, t)
+	}
+	return nil
+}
+
+// Read returns the tuples which match filter, sorted by object, relation and subject.
+func (s *TupleStore) Read(filter Tuple) ([]Tuple, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var tuples []Tuple
+	collect := func(index map[Tuple]struct{}) {
+		for t := range index {
+			if (filter.Subject == "" || t.Subject == filter.Subject) &&
+				(filter.Relation == "" || t.Relation == filter.Relation) &&
+				(filter.Object == "" || t.Object == filter.Object) {
+				tuples = append(tuples, t)
+			}
+		}
+	}
+	switch {
+	case filter.Object != "":
+		collect(s.byObject[filter.Object])
+	case filter.Subject != "":
+		collect(s.bySubject[filter.Subject])
+	default:
+		for _, index := range s.byObject {
+			collect(index)
+		}
+	}
+	sort.Slice(tuples, func(i, j int) bool {
+		a, b := tuples[i], tuples[j]
+		if a.Object != b.Object {
+			return a.Object < b.Object
+		}
+		if a.Relation != b.Relation {
+			return a.Relation < b.Relation
+		}
+		return a.Subject < b.Subject
+	})
+	return tuples, nil
+}
+
+func addTuple(index map[string]map[Tuple]struct{}, key string, t Tuple) {
+	tuples, ok := index[key]
+	if !ok {
+		tuples = make(map[Tuple]struct{})
+		index[key] = tuples
+	}
+	tuples[t] = struct{}{}
+}
+
+func removeTuple(index map[string]map[Tuple]struct{}, key string, t Tuple) {
+	delete(index[key], t)
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// ObjectResolver returns the object a URI refers to, such as "document:17" of "/documents/17".
+type ObjectResolver func(uri string) (object string, ok bool)
+
+// ObjectPattern maps URIs matching a pattern onto objects. Parameters of the pattern
+// are put into Object by their names in braces, such as "document:{id}" for "/documents/:id".
+type ObjectPattern struct {
+	URI    string
+	Object string
+}
+
+// MapObjects returns an ObjectResolver which maps a URI by the first of patterns it matches.
+func MapObjects(patterns ...ObjectPattern) (ObjectResolver, error) {
+	parsed := make([][]segment, len(patterns))
+	for i, p := range patterns {
+		if err := ValidatePattern(p.URI); err != nil {
+			return nil, err
+		}
+		if ObjectType(p.Object) == "" {
+			return nil, fmt.Errorf("%w: object %q of %s has no type", ErrInvalidTuple, p.Object, p.URI)
+		}
+		parsed[i] = parsePattern(p.URI)
+	}
+	return func(uri string) (string, bool) {
+		paths := handleURI(uri)
+		for i, pattern := range parsed {
+			var params Params
+			if !matchPattern(pattern, paths, &params) {
+				continue
+			}
+			object := patterns[i].Object
+			for _, param := range params {
+				object = strings.ReplaceAll(object, "{"+param.Key+"}", param.Value)
+			}
+			return object, true
+		}
+		return "", false
+	}, nil
+}
+
+// Relationships grant operations on objects to subjects related to them, besides policies.
+type Relationships struct {
+	Tuples Tuples
+
+	// Relations define operations relations grant. DefaultRelations are used if it is nil.
+	Relations Relations
+
+	// Objects map requested URIs onto objects.
+	Objects ObjectResolver
+}
+
+func (r *Relationships) relations() Relations {
+	if r.Relations == nil {
+		return DefaultRelations
+	}
+	return r.Relations
+}
+
+// subjects returns the tuple subjects a subject is: its user id and its roles.
+// A user id containing ':' is left out, so that it can not be taken for a role.
+func subjects(sub Subject) []string {
+	var list []string
+	if sub.UserID != "" && !strings.Contains(sub.UserID, ":") {
+		list = append(list, sub.UserID)
+	}
+	for _, id := range sub.RoleID {
+		list = append(list, RoleSubject(id))
+	}
+	return list
+}
+
+// Related returns a tuple relating a subject to an object by a relation which grants op.
+func (r *Relationships) Related(sub Subject, object string, op Operation) (Tuple, bool, error) {
+	relations := r.relations()
+	for _, subject := range subjects(sub) {
+		tuples, err := r.Tuples.Read(Tuple{Subject: subject, Object: object})
+		if err != nil {
+			return Tuple{}, false, err
+		}
+		for _, t := range tuples {
+			if relations.Grants(t.Relation, op) {
+				return t, true, nil
+			}
+		}
+	}
+	return Tuple{}, false, nil
+}
+
+// ListObjects returns the objects of a type, such as "document", a subject can operate by its relations.
+func (r *Relationships) ListObjects(sub Subject, objectType string, op Operation) ([]string, error) {
+	relations := r.relations()
+	var objects []string
+	seen := make(map[string]bool)
+	for _, subject := range subjects(sub) {
+		tuples, err := r.Tuples.Read(Tuple{Subject: subject})
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range tuples {
+			if ObjectType(t.Object) == objectType && !seen[t.Object] && relations.Grants(t.Relation, op) {
+				seen[t.Object] = true
+				objects = append(objects, t.Object)
+			}
+		}
+	}
+	sort.Strings(objects)
+	return objects, nil
+}
+
+// ListSubjects returns the subjects which can operate an object by their relations.
+func (r *Relationships) ListSubjects(object string, op Operation) ([]string, error) {
+	tuples, err := r.Tuples.Read(Tuple{Object: object})
+	if err != nil {
+		return nil, err
+	}
+	relations := r.relations()
+	var list []string
+	for _, t := range tuples {
+		if relations.Grants(t.Relation, op) && !containsString(list, t.Subject) {
+			list = append(list, t.Subject)
+		}
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Check is like Authorize, but also decides requests to objects by relations of the subject to them.
+// A request to an object is granted if policies grant it, or if the subject is related to the object
+// by a relation granting the operation, unless a deny rule of a policy applies to it.
+// Unlike Authorize, a request to an object is not granted only because no policy applies.
+func (ac *AccessControl) Check(ctx context.Context, req *Request) (Decision, error) {
+	if req.Env.Time.IsZero() {
+		req.Env.Time = time.Now()
+	}
+	decision := ac.decide(ctx, req)
+	r := ac.Relationships
+	if r == nil || r.Objects == nil || (decision.Granted && decision.Required) || decision.Pattern != "" {
+		ac.auditDecision(req, decision)
+		return decision, nil
+	}
+	object, ok := r.Objects(req.URI)
+	if !ok {
+		ac.auditDecision(req, decision)
+		return decision, nil
+	}
+	t, related, err := r.Related(req.Subject, object, req.Operation)
+	if err != nil {
+		return Decision{}, err
+	}
+	decision.Required, decision.Granted = true, related
+	if related {
+		decision.Tuple = &t
+		decision.Reason = fmt.Sprintf("%s is %s of %s", t.Subject, t.Relation, t.Object)
+	} else if decision.Reason == "no policy applies" {
+		decision.Reason = fmt.Sprintf("no relation to %s", object)
+	}
+	ac.auditDecision(req, decision)
+	return decision, nil
+}
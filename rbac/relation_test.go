@@ -0,0 +1,153 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTupleStore(t *testing.T) {
+	store := NewTupleStore()
+
+	assert := assert.New(t)
+	assert.Nil(store.Write(
+		Tuple{`42`, `owner`, `document:17`},
+		Tuple{`42`, `viewer`, `document:18`},
+		Tuple{`7`, `editor`, `document:17`},
+		Tuple{`42`, `owner`, `document:17`},
+	))
+	assert.True(errors.Is(store.Write(Tuple{`42`, `owner`, `17`}), ErrInvalidTuple))
+	assert.True(errors.Is(store.Write(Tuple{`user:42`, `owner`, `document:17`}), ErrInvalidTuple))
+	assert.True(errors.Is(store.Write(Tuple{`role:x`, `owner`, `document:17`}), ErrInvalidTuple))
+
+	tuples, _ := store.Read(Tuple{Object: `document:17`})
+	assert.Equal([]Tuple{{`7`, `editor`, `document:17`}, {`42`, `owner`, `document:17`}}, tuples)
+	tuples, _ = store.Read(Tuple{Subject: `42`, Relation: `viewer`})
+	assert.Equal([]Tuple{{`42`, `viewer`, `document:18`}}, tuples)
+	tuples, _ = store.Read(Tuple{})
+	assert.Equal(3, len(tuples))
+
+	assert.Nil(store.Delete(Tuple{`42`, `owner`, `document:17`}, Tuple{`1`, `owner`, `document:1`}))
+	tuples, _ = store.Read(Tuple{Subject: `42`})
+	assert.Equal([]Tuple{{`42`, `viewer`, `document:18`}}, tuples)
+	assert.Equal(`document:18#viewer@42`, tuples[0].String())
+}
+
+func TestRelations(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(DefaultRelations.Grants(`owner`, Delete))
+	assert.True(DefaultRelations.Grants(`editor`, Read|Update))
+	assert.False(DefaultRelations.Grants(`viewer`, Update))
+	assert.False(DefaultRelations.Grants(`viewer`, Nil))
+	assert.False(DefaultRelations.Grants(`stranger`, Read))
+	assert.Equal([]string{`editor`, `owner`, `viewer`}, DefaultRelations.Implies(`owner`))
+	assert.Equal([]string{`editor`, `viewer`}, DefaultRelations.Implies(`editor`))
+	assert.Nil(DefaultRelations.Implies(`stranger`))
+}
+
+func TestMapObjects(t *testing.T) {
+	resolve, err := MapObjects(
+		ObjectPattern{`/documents/:id/comments/:comment`, `comment:{comment}`},
+		ObjectPattern{`/documents/{id:[0-9]+}/**`, `document:{id}`},
+		ObjectPattern{`/documents/:id`, `document:{id}`},
+	)
+
+	assert := assert.New(t)
+	assert.Nil(err)
+	for uri, expected := range map[string]string{
+		`/documents/17`:             `document:17`,
+		`/documents/17/`:            `document:17`,
+		`/documents/17/attachments`: `document:17`,
+		`/documents/17/comments/3`:  `comment:3`,
+	} {
+		object, ok := resolve(uri)
+		assert.True(ok, uri)
+		assert.Equal(expected, object, uri)
+	}
+	_, ok := resolve(`/folders/1`)
+	assert.False(ok)
+
+	_, err = MapObjects(ObjectPattern{`/documents/:id`, `{id}`})
+	assert.True(errors.Is(err, ErrInvalidTuple))
+	_, err = MapObjects(ObjectPattern{`/documents/{id:[}`, `document:{id}`})
+	assert.NotNil(err)
+}
+
+func TestAccessControl_Check(t *testing.T) {
+	store := NewTupleStore()
+	store.Write(
+		Tuple{`42`, `owner`, `document:17`},
+		Tuple{`7`, `viewer`, `document:17`},
+		Tuple{RoleSubject(3), `editor`, `document:18`},
+		Tuple{`7`, `owner`, `document:19`},
+	)
+	objects, _ := MapObjects(ObjectPattern{`/documents/:id`, `document:{id}`})
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies([]StandardPolicy{
+		{`/documents/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}},
+		{`/documents/19`, []PermissionGroup{{Operation: Delete, RoleID: []int64{2}, Effect: Deny}}},
+	})
+	ac.Relationships = &Relationships{Tuples: store, Objects: objects}
+
+	check := func(uri string, op Operation, sub Subject) Decision {
+		decision, err := ac.Check(context.Background(), &Request{URI: uri, Operation: op, Subject: sub})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision
+	}
+
+	assert := assert.New(t)
+	decision := check(`/documents/17`, Update, Subject{UserID: `42`})
+	assert.True(decision.Granted)
+	assert.Equal(&Tuple{`42`, `owner`, `document:17`}, decision.Tuple)
+	assert.Equal(`42 is owner of document:17`, decision.Reason)
+
+	assert.True(check(`/documents/17`, Read, Subject{UserID: `7`}).Granted)
+	assert.False(check(`/documents/17`, Update, Subject{UserID: `7`}).Granted)
+	assert.True(check(`/documents/18`, Update, Subject{UserID: `8`, RoleID: []int64{3}}).Granted)
+	assert.False(check(`/documents/18`, Delete, Subject{UserID: `8`, RoleID: []int64{3}}).Granted)
+	assert.False(check(`/documents/18`, Update, Subject{UserID: RoleSubject(3)}).Granted)
+
+	// policies still grant, and deny rules are not overridden by relations
+	decision = check(`/documents/20`, Read, Subject{RoleID: []int64{1}})
+	assert.True(decision.Granted)
+	assert.Nil(decision.Tuple)
+	assert.True(check(`/documents/19`, Delete, Subject{UserID: `7`}).Granted)
+	assert.False(check(`/documents/19`, Delete, Subject{UserID: `7`, RoleID: []int64{2}}).Granted)
+
+	// objects are not open because no policy applies
+	decision = check(`/documents/17`, Delete, Subject{UserID: `8`})
+	assert.False(decision.Granted)
+	assert.True(decision.Required)
+	assert.Equal(`no relation to document:17`, decision.Reason)
+	assert.True(check(`/folders/1`, Delete, Subject{UserID: `8`}).Granted)
+}
+
+func TestRelationships_List(t *testing.T) {
+	store := NewTupleStore()
+	store.Write(
+		Tuple{`42`, `owner`, `document:17`},
+		Tuple{`42`, `viewer`, `document:18`},
+		Tuple{`42`, `owner`, `folder:1`},
+		Tuple{RoleSubject(3), `viewer`, `document:19`},
+		Tuple{`7`, `editor`, `document:17`},
+	)
+	r := &Relationships{Tuples: store}
+
+	assert := assert.New(t)
+	objects, err := r.ListObjects(Subject{UserID: `42`, RoleID: []int64{3}}, `document`, Read)
+	assert.Nil(err)
+	assert.Equal([]string{`document:17`, `document:18`, `document:19`}, objects)
+	objects, _ = r.ListObjects(Subject{UserID: `42`}, `document`, Update)
+	assert.Equal([]string{`document:17`}, objects)
+
+	subjects, err := r.ListSubjects(`document:17`, Update)
+	assert.Nil(err)
+	assert.Equal([]string{`42`, `7`}, subjects)
+	subjects, _ = r.ListSubjects(`document:17`, Delete)
+	assert.Equal([]string{`42`}, subjects)
+}
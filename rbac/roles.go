@@ -1,7 +1,21 @@
 package rbac
 
 import (
+	"errors"
+	"fmt"
+	"iter"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrRoleNotFound    = errors.New("RBAC: role is not found")
+	ErrRoleCycle       = errors.New("RBAC: role hierarchy has a cycle")
+	ErrRoleHasChildren = errors.New("RBAC: role has children")
+	ErrRoleImmutable   = errors.New("RBAC: role can not be changed")
 )
 
 type Roles interface {
@@ -10,8 +24,78 @@ type Roles interface {
 	IsSuperior(superior, subordinate Role) bool
 }
 
+// RoleManager holds roles in memory. Roles are read without locking, and changes are serialized.
 type RoleManager struct {
-	manager sync.Map
+	manager    sync.Map
+	generation uint64
+
+	// mu serializes changes and guards listeners.
+	mu        sync.Mutex
+	listeners []func(RoleEvent)
+}
+
+// RemoveMode tells what RemoveRole does with children of a role.
+type RemoveMode uint8
+
+const (
+	// RejectChildren refuses to remove a role which has children.
+	RejectChildren RemoveMode = iota
+
+	// CascadeChildren removes all descendants of the role with it.
+	CascadeChildren
+
+	// ReparentChildren makes children of the role children of its parent.
+	ReparentChildren
+)
+
+// RoleEventType is the kind of a change of roles.
+type RoleEventType uint8
+
+const (
+	RoleSet RoleEventType = iota
+	RoleDeleted
+)
+
+func (t RoleEventType) String() string {
+	switch t {
+	case RoleSet:
+		return "set"
+	case RoleDeleted:
+		return "deleted"
+	}
+	return "unknown"
+}
+
+// RoleEvent tells a change of a role of a RoleManager.
+type RoleEvent struct {
+	Type RoleEventType
+
+	// Role is the role which is set or deleted, and Previous is the one it replaced, if any.
+	Role     Role
+	Previous Role
+
+	// Generation is the generation of the roles after the event.
+	Generation uint64
+	Time       time.Time
+}
+
+// RoleFilter selects roles listed by ListRoles. Zero fields select every role.
+type RoleFilter struct {
+	// Parent selects children of a role.
+	Parent int64
+
+	// Ancestor selects descendants of a role.
+	Ancestor int64
+
+	// Roots selects roles whose parent does not exist.
+	Roots bool
+
+	// Name selects roles whose name contains it, ignoring case.
+	Name string
+
+	// Offset and Limit page roles sorted by id. A Limit which is not positive does not limit them.
+	Offset int
+	Limit  int
 }
 
 func NewRoleManager() *RoleManager {
@@ -19,8 +103,100 @@ func NewRoleManager() *RoleManager {
 	return &manager
 }
 
+// SetRole sets a role without checking its parent, so that roles can be loaded before their parents.
+// It is the unchecked path: a parent which does not exist or makes a cycle is kept as it is,
+// and IsSuperior stops at a cycle. SaveRole and SetParent reject such parents.
 func (r *RoleManager) SetRole(role Role) {
-	r.manager.Store(role.ID(), role)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(role)
+}
+
+// SaveRole sets a role unless its parent does not exist or is one of its descendants.
+func (r *RoleManager) SaveRole(role Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.checkParent(role.ID(), role.ParentID()); err != nil {
+		return err
+	}
+	r.set(role)
+	return nil
+}
+
+// SetParent makes parent the parent of a role, or makes it a root if parent is 0.
+// It rejects a parent which does not exist or is the role or one of its descendants.
+func (r *RoleManager) SetParent(id, parent int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role := r.GetRole(id)
+	if role == nil {
+		return fmt.Errorf("%w: %d", ErrRoleNotFound, id)
+	}
+	if err := r.checkParent(id, parent); err != nil {
+		return err
+	}
+	return r.change(role, func(s *StandardRole) { s.ParentId = parent })
+}
+
+// RenameRole changes the name of a role.
+func (r *RoleManager) RenameRole(id int64, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role := r.GetRole(id)
+	if role == nil {
+		return fmt.Errorf("%w: %d", ErrRoleNotFound, id)
+	}
+	return r.change(role, func(s *StandardRole) { s.Name = name })
+}
+
+// DeleteRole removes a role. Children of the role keep its id as their parent.
+//
+// Deprecated: DeleteRole leaves children pointing at a role which does not exist. Use RemoveRole,
+// which rejects a role with children unless it is told to remove or reparent them.
+func (r *RoleManager) DeleteRole(id int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if role := r.GetRole(id); role != nil {
+		r.delete(role)
+	}
+}
+
+// RemoveRole removes a role and does what mode tells with its children.
+// It returns ids of the removed roles, the role itself first.
+func (r *RoleManager) RemoveRole(id int64, mode RemoveMode) ([]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	role := r.GetRole(id)
+	if role == nil {
+		return nil, fmt.Errorf("%w: %d", ErrRoleNotFound, id)
+	}
+	children := r.children()
+	switch mode {
+	case RejectChildren:
+		if len(children[id]) > 0 {
+			return nil, fmt.Errorf("%w: role %d is the parent of %d", ErrRoleHasChildren, id, children[id][0].ID())
+		}
+	case ReparentChildren:
+		// Children are checked first, so that a role which can not be changed leaves the hierarchy intact.
+		for _, child := range children[id] {
+			if _, ok := child.(*StandardRole); !ok {
+				return nil, fmt.Errorf("%w: %d", ErrRoleImmutable, child.ID())
+			}
+		}
+		for _, child := range children[id] {
+			r.change(child, func(s *StandardRole) { s.ParentId = role.ParentID() })
+		}
+	case CascadeChildren:
+		removed := []int64{id}
+		r.delete(role)
+		for descendant := range descendants(children, id) {
+			r.delete(descendant)
+			removed = append(removed, descendant.ID())
+		}
+		return removed, nil
+	}
+	r.delete(role)
+	return []int64{id}, nil
 }
 
 func (r *RoleManager) GetRole(id int64) Role {
@@ -31,8 +207,11 @@ func (r *RoleManager) GetRole(id int64) Role {
 	return role.(Role)
 }
 
+// IsSuperior shows whether superior is an ancestor of subordinate.
+// It stops at a role which has been visited, so a cycle in the hierarchy can not loop forever.
 func (r *RoleManager) IsSuperior(superior, subordinate Role) bool {
 	parent := subordinate
+	visited := map[int64]bool{subordinate.ID(): true}
 	for {
 		if parent = r.GetRole(parent.ParentID()); parent == nil {
 			return false
@@ -40,5 +219,197 @@ func (r *RoleManager) IsSuperior(superior, subordinate Role) bool {
 		if parent.ID() == superior.ID() {
 			return true
 		}
+		if visited[parent.ID()] {
+			return false
+		}
+		visited[parent.ID()] = true
+	}
+}
+
+// Range calls f for every role until f returns false.
+func (r *RoleManager) Range(f func(Role) bool) {
+	r.manager.Range(func(_, role interface{}) bool {
+		return f(role.(Role))
+	})
+}
+
+// ListRoles returns roles selected by filter, sorted by id.
+func (r *RoleManager) ListRoles(filter RoleFilter) []Role {
+	var ancestors map[int64]bool
+	if filter.Ancestor != 0 {
+		ancestors = make(map[int64]bool)
+		for descendant := range r.Descendants(filter.Ancestor) {
+			ancestors[descendant.ID()] = true
+		}
+	}
+	name := strings.ToLower(filter.Name)
+	roles := make([]Role, 0)
+	r.Range(func(role Role) bool {
+		switch {
+		case filter.Parent != 0 && role.ParentID() != filter.Parent,
+			ancestors != nil && !ancestors[role.ID()],
+			filter.Roots && r.GetRole(role.ParentID()) != nil,
+			name != "" && !strings.Contains(strings.ToLower(roleName(role)), name):
+		default:
+			roles = append(roles, role)
+		}
+		return true
+	})
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID() < roles[j].ID() })
+	if filter.Offset > 0 {
+		roles = roles[min(filter.Offset, len(roles)):]
+	}
+	if filter.Limit > 0 && filter.Limit < len(roles) {
+		roles = roles[:filter.Limit]
+	}
+	return roles
+}
+
+// Children returns the children of a role, sorted by id.
+func (r *RoleManager) Children(id int64) []Role {
+	return r.ListRoles(RoleFilter{Parent: id})
+}
+
+// Ancestors yields the ancestors of a role, from its parent to the root.
+// It stops at a role which has been yielded, so a cycle in the hierarchy can not loop forever.
+func (r *RoleManager) Ancestors(id int64) iter.Seq[Role] {
+	return func(yield func(Role) bool) {
+		role := r.GetRole(id)
+		if role == nil {
+			return
+		}
+		visited := map[int64]bool{id: true}
+		for {
+			if role = r.GetRole(role.ParentID()); role == nil || visited[role.ID()] {
+				return
+			}
+			visited[role.ID()] = true
+			if !yield(role) {
+				return
+			}
+		}
+	}
+}
+
+// Descendants yields the descendants of a role breadth first, children sorted by id before grandchildren.
+// The hierarchy is read when iterating starts.
+func (r *RoleManager) Descendants(id int64) iter.Seq[Role] {
+	return func(yield func(Role) bool) {
+		for role := range descendants(r.children(), id) {
+			if !yield(role) {
+				return
+			}
+		}
+	}
+}
+
+// Subscribe registers f to receive an event whenever a role is set or deleted.
+// f is called while roles are changed, so it must not change roles itself.
+func (r *RoleManager) Subscribe(f func(RoleEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, f)
+}
+
+// Generation increases whenever a role is set, so that caches built from roles can tell they are stale.
+func (r *RoleManager) Generation() uint64 {
+	return atomic.LoadUint64(&r.generation)
+}
+
+// set stores a role and emits its event. It must be called with mu held.
+func (r *RoleManager) set(role Role) {
+	previous, _ := r.manager.Swap(role.ID(), role)
+	event := RoleEvent{Type: RoleSet, Role: role, Generation: atomic.AddUint64(&r.generation, 1)}
+	if previous != nil {
+		event.Previous = previous.(Role)
+	}
+	r.emit(event)
+}
+
+// delete removes a role and emits its event. It must be called with mu held.
+func (r *RoleManager) delete(role Role) {
+	r.manager.Delete(role.ID())
+	r.emit(RoleEvent{Type: RoleDeleted, Role: role, Generation: atomic.AddUint64(&r.generation, 1)})
+}
+
+// change sets a copy of a StandardRole modified by f. It must be called with mu held.
+func (r *RoleManager) change(role Role, f func(*StandardRole)) error {
+	standard, ok := role.(*StandardRole)
+	if !ok {
+		return fmt.Errorf("%w: %d", ErrRoleImmutable, role.ID())
+	}
+	changed := *standard
+	f(&changed)
+	r.set(&changed)
+	return nil
+}
+
+func (r *RoleManager) emit(e RoleEvent) {
+	e.Time = time.Now()
+	for _, f := range r.listeners {
+		f(e)
+	}
+}
+
+// checkParent checks that parent exists and is not id or one of its descendants. A parent of 0 is no parent.
+func (r *RoleManager) checkParent(id, parent int64) error {
+	if parent == 0 {
+		return nil
+	}
+	if parent == id {
+		return fmt.Errorf("%w: role %d can not be its own parent", ErrRoleCycle, id)
+	}
+	role := r.GetRole(parent)
+	if role == nil {
+		return fmt.Errorf("%w: parent %d", ErrRoleNotFound, parent)
+	}
+	for ancestor := range r.Ancestors(parent) {
+		if ancestor.ID() == id {
+			return fmt.Errorf("%w: role %d can not be a child of %d", ErrRoleCycle, id, parent)
+		}
+	}
+	return nil
+}
+
+// children returns the children of every role, sorted by id.
+func (r *RoleManager) children() map[int64][]Role {
+	children := make(map[int64][]Role)
+	r.Range(func(role Role) bool {
+		if role.ParentID() != role.ID() {
+			children[role.ParentID()] = append(children[role.ParentID()], role)
+		}
+		return true
+	})
+	for _, roles := range children {
+		sort.Slice(roles, func(i, j int) bool { return roles[i].ID() < roles[j].ID() })
+	}
+	return children
+}
+
+// descendants yields descendants of a role breadth first, skipping a role which has been yielded.
+func descendants(children map[int64][]Role, id int64) iter.Seq[Role] {
+	return func(yield func(Role) bool) {
+		visited := map[int64]bool{id: true}
+		queue := children[id]
+		for len(queue) > 0 {
+			role := queue[0]
+			queue = queue[1:]
+			if visited[role.ID()] {
+				continue
+			}
+			visited[role.ID()] = true
+			if !yield(role) {
+				return
+			}
+			queue = append(queue[:len(queue):len(queue)], children[role.ID()]...)
+		}
+	}
+}
+
+// roleName returns the name of a StandardRole, or "" for other roles.
+func roleName(role Role) string {
+	if standard, ok := role.(*StandardRole); ok {
+		return standard.Name
 	}
+	return ""
 }
@@ -93,3 +93,183 @@ func TestRoleManager_IsSuperior(t *testing.T) {
 	assert.False(manager.IsSuperior(&roles[5], &roles[1]))
 	assert.False(manager.IsSuperior(&roles[5], &roles[0]))
 }
+
+func TestRoleManager_IsSuperiorCycle(t *testing.T) {
+	roles := []StandardRole{
+		{1, `role1`, nil, 3},
+		{2, `role2`, nil, 1},
+		{3, `role3`, nil, 2},
+		{4, `role4`, nil, 0},
+	}
+	manager := NewRoleManager()
+	for i := range roles {
+		manager.SetRole(&roles[i])
+	}
+
+	assert := assert.New(t)
+	assert.True(manager.IsSuperior(&roles[0], &roles[1]))
+	assert.True(manager.IsSuperior(&roles[1], &roles[0]))
+	assert.False(manager.IsSuperior(&roles[3], &roles[0]))
+}
+
+func newRoleTree() *RoleManager {
+	manager := NewRoleManager()
+	for _, role := range []*StandardRole{
+		{1, `admin`, nil, 0},
+		{2, `editor`, nil, 1},
+		{3, `Auditor`, nil, 1},
+		{5, `writer`, nil, 2},
+		{7, `reviewer`, nil, 2},
+		{10, `guest`, nil, 5},
+		{11, `bot`, nil, 9},
+	} {
+		manager.SetRole(role)
+	}
+	return manager
+}
+
+func roleIDs(roles []Role) []int64 {
+	ids := make([]int64, len(roles))
+	for i, role := range roles {
+		ids[i] = role.ID()
+	}
+	return ids
+}
+
+func TestRoleManager_SaveRole(t *testing.T) {
+	manager := newRoleTree()
+
+	assert := assert.New(t)
+	assert.ErrorIs(manager.SaveRole(&StandardRole{Id: 2, ParentId: 10}), ErrRoleCycle)
+	assert.ErrorIs(manager.SaveRole(&StandardRole{Id: 2, ParentId: 2}), ErrRoleCycle)
+	assert.ErrorIs(manager.SaveRole(&StandardRole{Id: 12, ParentId: 9}), ErrRoleNotFound)
+	assert.Equal(int64(1), manager.GetRole(2).ParentID())
+	assert.Nil(manager.SaveRole(&StandardRole{Id: 12, ParentId: 10}))
+
+	assert.ErrorIs(manager.SetParent(1, 5), ErrRoleCycle)
+	assert.ErrorIs(manager.SetParent(9, 1), ErrRoleNotFound)
+	assert.Nil(manager.SetParent(5, 3))
+	assert.Equal(`writer`, roleName(manager.GetRole(5)))
+	assert.True(manager.IsSuperior(manager.GetRole(3), manager.GetRole(12)))
+	assert.Nil(manager.SetParent(5, 0))
+	assert.Equal(int64(0), manager.GetRole(5).ParentID())
+
+	assert.Nil(manager.RenameRole(5, `author`))
+	assert.Equal(`author`, roleName(manager.GetRole(5)))
+	assert.ErrorIs(manager.RenameRole(9, `x`), ErrRoleNotFound)
+
+	manager.SetRole(&customRole{StandardRole{Id: 20}})
+	assert.ErrorIs(manager.RenameRole(20, `x`), ErrRoleImmutable)
+}
+
+type customRole struct {
+	StandardRole
+}
+
+func TestRoleManager_RemoveRole(t *testing.T) {
+	manager := newRoleTree()
+
+	assert := assert.New(t)
+	_, err := manager.RemoveRole(2, RejectChildren)
+	assert.ErrorIs(err, ErrRoleHasChildren)
+	_, err = manager.RemoveRole(9, CascadeChildren)
+	assert.ErrorIs(err, ErrRoleNotFound)
+
+	removed, err := manager.RemoveRole(7, RejectChildren)
+	assert.Nil(err)
+	assert.Equal([]int64{7}, removed)
+
+	removed, err = manager.RemoveRole(5, ReparentChildren)
+	assert.Nil(err)
+	assert.Equal([]int64{5}, removed)
+	assert.Equal(int64(2), manager.GetRole(10).ParentID())
+	assert.Equal(`guest`, roleName(manager.GetRole(10)))
+
+	manager.SetRole(&customRole{StandardRole{Id: 20, ParentId: 10}})
+	_, err = manager.RemoveRole(10, ReparentChildren)
+	assert.ErrorIs(err, ErrRoleImmutable)
+	assert.NotNil(manager.GetRole(10))
+
+	removed, err = manager.RemoveRole(1, CascadeChildren)
+	assert.Nil(err)
+	assert.Equal([]int64{1, 2, 3, 10, 20}, removed)
+	assert.Equal([]int64{11}, roleIDs(manager.ListRoles(RoleFilter{})))
+}
+
+func TestRoleManager_ListRoles(t *testing.T) {
+	manager := newRoleTree()
+
+	assert := assert.New(t)
+	assert.Equal([]int64{1, 2, 3, 5, 7, 10, 11}, roleIDs(manager.ListRoles(RoleFilter{})))
+	assert.Equal([]int64{5, 7}, roleIDs(manager.ListRoles(RoleFilter{Parent: 2})))
+	assert.Equal([]int64{5, 7}, roleIDs(manager.Children(2)))
+	assert.Equal([]int64{5, 7, 10}, roleIDs(manager.ListRoles(RoleFilter{Ancestor: 2})))
+	assert.Equal([]int64{1, 11}, roleIDs(manager.ListRoles(RoleFilter{Roots: true})))
+	assert.Equal([]int64{2, 3, 5}, roleIDs(manager.ListRoles(RoleFilter{Name: `IT`})))
+	assert.Equal([]int64{3, 5}, roleIDs(manager.ListRoles(RoleFilter{Offset: 2, Limit: 2})))
+	assert.Equal([]int64{}, roleIDs(manager.ListRoles(RoleFilter{Offset: 10})))
+	assert.Equal([]int64{}, roleIDs(manager.ListRoles(RoleFilter{Parent: 10})))
+}
+
+func TestRoleManager_Ancestors(t *testing.T) {
+	manager := newRoleTree()
+
+	assert := assert.New(t)
+	var ids []int64
+	for role := range manager.Ancestors(10) {
+		ids = append(ids, role.ID())
+	}
+	assert.Equal([]int64{5, 2, 1}, ids)
+
+	ids = nil
+	for role := range manager.Descendants(1) {
+		ids = append(ids, role.ID())
+		if role.ID() == 7 {
+			break
+		}
+	}
+	assert.Equal([]int64{2, 3, 5, 7}, ids)
+
+	// a cycle does not loop forever
+	manager.SetRole(&StandardRole{Id: 1, ParentId: 10})
+	ids = nil
+	for role := range manager.Ancestors(5) {
+		ids = append(ids, role.ID())
+	}
+	assert.Equal([]int64{2, 1, 10}, ids)
+	ids = nil
+	for role := range manager.Descendants(5) {
+		ids = append(ids, role.ID())
+	}
+	assert.Equal([]int64{10, 1, 2, 3, 7}, ids)
+}
+
+func TestRoleManager_Subscribe(t *testing.T) {
+	manager := newRoleTree()
+	tree := NewPolicyTree()
+	tree.SetHierarchy(manager, ParentInherits)
+	cache := NewDecisionCache(tree, nil, 0)
+	cache.LoadPolicies([]StandardPolicy{{`/articles`, []PermissionGroup{{Operation: Read, RoleID: []int64{10}}}}})
+
+	var events []RoleEvent
+	manager.Subscribe(func(e RoleEvent) {
+		events = append(events, e)
+		cache.Purge()
+	})
+
+	assert := assert.New(t)
+	assert.True(cache.IsGranted(`/articles`, Read, manager.GetRole(2)))
+	_, err := manager.RemoveRole(5, CascadeChildren)
+	assert.Nil(err)
+	assert.False(cache.IsGranted(`/articles`, Read, manager.GetRole(2)))
+
+	assert.Equal(2, len(events))
+	assert.Equal(RoleDeleted, events[1].Type)
+	assert.Equal(int64(10), events[1].Role.ID())
+	assert.Equal(manager.Generation(), events[1].Generation)
+
+	manager.SetParent(7, 3)
+	assert.Equal(`set`, events[2].Type.String())
+	assert.Equal(int64(2), events[2].Previous.ParentID())
+	assert.Equal(int64(3), events[2].Role.ParentID())
+}
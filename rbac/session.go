@@ -0,0 +1,84 @@
+package rbac
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Session holds the roles a user has activated out of the ones assigned to them,
+// so that a user can hold roles which Constraints forbid to be active together, one at a time.
+// Requests of a session are authorized with its Subject.
+type Session struct {
+	UserID string
+	Tenant string
+
+	ac     *AccessControl
+	mu     sync.Mutex
+	active []int64
+}
+
+// NewSession starts a session of a user within a tenant without any active role.
+func (ac *AccessControl) NewSession(userID, tenant string) *Session {
+	return &Session{UserID: userID, Tenant: tenant, ac: ac}
+}
+
+// Activate activates roles in the session. Every role must be assigned to the user by Assignments,
+// and the active roles must not break Constraints. Nothing is activated if it fails.
+func (s *Session) Activate(roleID ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var assigned []int64
+	if s.ac.Assignments != nil {
+		var err error
+		if assigned, err = s.ac.Assignments.RolesOf(s.UserID, s.Tenant, time.Now()); err != nil {
+			return err
+		}
+	}
+	active := append([]int64(nil), s.active...)
+	for _, id := range roleID {
+		if !containsID(assigned, id) {
+			return fmt.Errorf("%w: role %d to user %q", ErrRoleNotAssigned, id, s.UserID)
+		}
+		if !containsID(active, id) {
+			active = append(active, id)
+		}
+	}
+	return s.set(active)
+}
+
+// Deactivate deactivates roles in the session, unless an active role requires one of them.
+func (s *Session) Deactivate(roleID ...int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := make([]int64, 0, len(s.active))
+	for _, id := range s.active {
+		if !containsID(roleID, id) {
+			active = append(active, id)
+		}
+	}
+	return s.set(active)
+}
+
+// Roles returns the active roles in the order they were activated.
+func (s *Session) Roles() []int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]int64(nil), s.active...)
+}
+
+// Subject returns the user of the session holding its active roles.
+func (s *Session) Subject() Subject {
+	return Subject{UserID: s.UserID, Tenant: s.Tenant, RoleID: s.Roles()}
+}
+
+// set makes active the active roles after checking Constraints. It must be called with mu held.
+func (s *Session) set(active []int64) error {
+	if s.ac.Constraints != nil {
+		if err := s.ac.Constraints.CheckActivate(s.UserID, active); err != nil {
+			return err
+		}
+	}
+	s.active = active
+	return nil
+}
@@ -0,0 +1,129 @@
+package rbac
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrNoPreviousVersion = errors.New("RBAC: no previous version of policies")
+
+	// ErrVersionConflict is returned by PolicyManager.LoadIf when another version has been swapped in.
+	ErrVersionConflict = errors.New("RBAC: policies have been changed")
+
+	// ErrNotModified is returned by PollingSource.Fetch when policies have not changed since the last fetch.
+	ErrNotModified = errors.New("RBAC: policies are not modified")
+)
+
+// PolicyVersion is a set of policies a PolicyManager has swapped in.
+type PolicyVersion struct {
+	// Version increases with every load. The empty policies a PolicyManager starts with are version 0.
+	Version uint64
+
+	// Hash is the SHA-256 of the policies the version is built from.
+	Hash     string
+	Source   string
+	LoadedAt time.Time
+
+	// Policies are built from the policies of the version. They must not be modified.
+	Policies Policies
+	policies []StandardPolicy
+}
+
+// StandardPolicies returns the policies the version is built from.
+func (v *PolicyVersion) StandardPolicies() []StandardPolicy {
+	return v.policies
+}
+
+type PolicyEventType uint8
+
+const (
+	PolicyLoaded PolicyEventType = iota
+	PolicyRolledBack
+	PolicyLoadFailed
+)
+
+func (t PolicyEventType) String() string {
+	switch t {
+	case PolicyLoaded:
+		return "loaded"
+	case PolicyRolledBack:
+		return "rolled_back"
+	case PolicyLoadFailed:
+		return "load_failed"
+	}
+	return "unknown"
+}
+
+// PolicyEvent tells a change of the policies of a PolicyManager.
+type PolicyEvent struct {
+	Type PolicyEventType
+
+	// Version is the version in use after the event, and Previous is the one before it.
+	Version  uint64
+	Previous uint64
+	Hash     string
+	Source   string
+	Err      error
+	Time     time.Time
+}
+
+// PolicySource provides policies to PolicyManager.Watch.
+type PolicySource interface {
+	// Name describes the source in events, like the path of a file.
+	Name() string
+
+	// Watch calls update with the current policies, and again whenever they may have changed,
+	// until ctx is done. Failures to fetch policies are passed to update as well.
+	Watch(ctx context.Context, update func([]StandardPolicy, error)) error
+}
+
+// PollingSource fetches policies every Interval, from a callback.
+type PollingSource struct {
+	SourceName string
+	Interval   time.Duration
+
+	// Fetch returns the current policies, or ErrNotModified if they have not changed since the last call.
+	Fetch func(ctx context.Context) ([]StandardPolicy, error)
+}
+
+func (s *PollingSource) Name() string {
+	return s.SourceName
+}
+
+func (s *PollingSource) Watch(ctx context.Context, update func([]StandardPolicy, error)) error {
+	interval := s.Interval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		policies, err := s.Fetch(ctx)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if !errors.Is(err, ErrNotModified) {
+			update(policies, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// hashPolicies returns the SHA-256 of policies in hex.
+func hashPolicies(policies []StandardPolicy) string {
+	if len(policies) == 0 {
+		policies = nil
+	}
+	data, _ := json.Marshal(policies)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
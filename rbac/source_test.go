@@ -0,0 +1,58 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicyManager_Watch(t *testing.T) {
+	versions := [][]StandardPolicy{
+		{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{1}}}}},
+		nil,
+		{{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{2}}}}},
+	}
+	fetches := 0
+	source := &PollingSource{
+		SourceName: `callback`,
+		Interval:   time.Millisecond,
+		Fetch: func(context.Context) ([]StandardPolicy, error) {
+			fetches++
+			switch fetches {
+			case 1:
+				return versions[0], nil
+			case 2:
+				return nil, ErrNotModified
+			case 3:
+				return nil, errors.New(`unavailable`)
+			}
+			return versions[2], nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []PolicyEvent
+	manager := NewPolicyManager(nil)
+	manager.Subscribe(func(e PolicyEvent) {
+		events = append(events, e)
+		if e.Version == 2 {
+			cancel()
+		}
+	})
+
+	assert := assert.New(t)
+	assert.ErrorIs(manager.Watch(ctx, source), context.Canceled)
+	assert.Equal(3, len(events))
+	assert.Equal(PolicyLoaded, events[0].Type)
+	assert.Equal(`callback`, events[0].Source)
+	assert.Equal(PolicyLoadFailed, events[1].Type)
+	assert.Equal(uint64(1), events[1].Version)
+	assert.EqualError(events[1].Err, `unavailable`)
+	assert.Equal(PolicyLoaded, events[2].Type)
+	roleID, _ := manager.Require(`/data/image`, Read)
+	assert.Equal([]int64{2}, roleID)
+}
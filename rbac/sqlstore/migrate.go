@@ -0,0 +1,97 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// migrations upgrade the schema one version after another. Applied versions are recorded in
+// rbac_schema_migrations, so a migration must never change once it is released; add a new one instead.
+var migrations = [][]string{
+	1: {
+		`CREATE TABLE rbac_roles (
+			id        BIGINT PRIMARY KEY,
+			name      VARCHAR(255) NOT NULL DEFAULT '',
+			parent_id BIGINT NULL
+		)`,
+		`CREATE INDEX rbac_roles_parent_id ON rbac_roles (parent_id)`,
+		`CREATE TABLE rbac_role_permissions (
+			role_id   BIGINT NOT NULL,
+			position  INTEGER NOT NULL,
+			uri       VARCHAR(1024) NOT NULL,
+			operation BIGINT NOT NULL,
+			effect    SMALLINT NOT NULL DEFAULT 0,
+			PRIMARY KEY (role_id, position)
+		)`,
+		`CREATE TABLE rbac_policies (
+			uri VARCHAR(1024) PRIMARY KEY
+		)`,
+		`CREATE TABLE rbac_policy_groups (
+			uri        VARCHAR(1024) NOT NULL,
+			position   INTEGER NOT NULL,
+			operation  BIGINT NOT NULL,
+			effect     SMALLINT NOT NULL DEFAULT 0,
+			conditions TEXT NOT NULL DEFAULT '',
+			PRIMARY KEY (uri, position)
+		)`,
+		`CREATE TABLE rbac_policy_group_roles (
+			uri      VARCHAR(1024) NOT NULL,
+			position INTEGER NOT NULL,
+			ordinal  INTEGER NOT NULL,
+			role_id  BIGINT NOT NULL,
+			PRIMARY KEY (uri, position, ordinal)
+		)`,
+		`CREATE INDEX rbac_policy_group_roles_role_id ON rbac_policy_group_roles (role_id)`,
+		`CREATE TABLE rbac_assignments (
+			user_id    VARCHAR(255) NOT NULL,
+			role_id    BIGINT NOT NULL,
+			tenant     VARCHAR(255) NOT NULL DEFAULT '',
+			not_before TIMESTAMP NULL,
+			expires_at TIMESTAMP NULL,
+			PRIMARY KEY (user_id, role_id, tenant)
+		)`,
+		`CREATE INDEX rbac_assignments_role_id ON rbac_assignments (role_id)`,
+	},
+}
+
+// SchemaVersion is the version of the schema Migrate upgrades to.
+const SchemaVersion = 1
+
+// Migrate creates or upgrades the schema to SchemaVersion. Every migration runs in its own transaction.
+func (s *Store) Migrate(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS rbac_schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+	current, err := s.Version(ctx)
+	if err != nil {
+		return err
+	}
+	for version := current + 1; version < len(migrations); version++ {
+		err := s.inTx(ctx, func(tx *sql.Tx) error {
+			for _, statement := range migrations[version] {
+				if _, err := tx.ExecContext(ctx, statement); err != nil {
+					return err
+				}
+			}
+			_, err := tx.ExecContext(ctx, `INSERT INTO rbac_schema_migrations (version, applied_at) VALUES ($1, $2)`,
+				version, time.Now().UTC())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Version returns the version of the schema in the database. The table of versions is created by Migrate.
+func (s *Store) Version(ctx context.Context) (int, error) {
+	var version sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM rbac_schema_migrations`).Scan(&version)
+	return int(version.Int64), err
+}
@@ -0,0 +1,556 @@
+// Package sqlstore keeps roles, policies and assignments of rbac in a SQL database through database/sql.
+//
+// Queries use $1 style placeholders, which PostgreSQL and SQLite both understand.
+// Call Migrate to create or upgrade the schema before using a Store.
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-pandora/pkg/rbac"
+)
+
+var (
+	ErrNotFound = errors.New("RBAC: not found")
+	ErrInvalid  = errors.New("RBAC: invalid record")
+)
+
+// Store reads and writes rbac records in db.
+type Store struct {
+	db *sql.DB
+}
+
+func New(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// inTx runs f in a transaction, which is committed if f returns nil and rolled back otherwise.
+func (s *Store) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// CreateRole inserts a role and its permissions, if they can be listed like those of *rbac.PermissionTree.
+func (s *Store) CreateRole(ctx context.Context, role *rbac.StandardRole) error {
+	if role.Id <= 0 {
+		return fmt.Errorf("%w: role id %d", ErrInvalid, role.Id)
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `INSERT INTO rbac_roles (id, name, parent_id) VALUES ($1, $2, $3)`,
+			role.Id, role.Name, nullID(role.ParentId))
+		if err != nil {
+			return err
+		}
+		return setPermissions(ctx, tx, role.Id, listPermissions(role.Permissions))
+	})
+}
+
+// UpdateRole updates the name and the parent of a role, and replaces its permissions if they can be listed.
+func (s *Store) UpdateRole(ctx context.Context, role *rbac.StandardRole) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, `UPDATE rbac_roles SET name = $1, parent_id = $2 WHERE id = $3`,
+			role.Name, nullID(role.ParentId), role.Id)
+		if err != nil {
+			return err
+		}
+		if err := affected(result, "role", role.Id); err != nil {
+			return err
+		}
+		if role.Permissions == nil {
+			return nil
+		}
+		return setPermissions(ctx, tx, role.Id, listPermissions(role.Permissions))
+	})
+}
+
+// DeleteRole deletes a role with its permissions and assignments. Children of the role lose their parent.
+func (s *Store) DeleteRole(ctx context.Context, id int64) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		for _, query := range []string{
+			`DELETE FROM rbac_role_permissions WHERE role_id = $1`,
+			`DELETE FROM rbac_assignments WHERE role_id = $1`,
+			`DELETE FROM rbac_policy_group_roles WHERE role_id = $1`,
+			`UPDATE rbac_roles SET parent_id = NULL WHERE parent_id = $1`,
+		} {
+			if _, err := tx.ExecContext(ctx, query, id); err != nil {
+				return err
+			}
+		}
+		result, err := tx.ExecContext(ctx, `DELETE FROM rbac_roles WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+		return affected(result, "role", id)
+	})
+}
+
+// SetPermissions replaces the permissions of a role.
+func (s *Store) SetPermissions(ctx context.Context, roleID int64, permissions []rbac.StandardPermission) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM rbac_roles WHERE id = $1`, roleID).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: role %d", ErrNotFound, roleID)
+		}
+		if err != nil {
+			return err
+		}
+		return setPermissions(ctx, tx, roleID, permissions)
+	})
+}
+
+func setPermissions(ctx context.Context, tx *sql.Tx, roleID int64, permissions []rbac.StandardPermission) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM rbac_role_permissions WHERE role_id = $1`, roleID); err != nil {
+		return err
+	}
+	for i, p := range permissions {
+		if err := rbac.ValidatePattern(p.URI); err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalid, err)
+		}
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO rbac_role_permissions (role_id, position, uri, operation, effect) VALUES ($1, $2, $3, $4, $5)`,
+			roleID, i, p.URI, int64(p.Operation), int(p.Effect))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetRole returns a role with its permissions in a *rbac.PermissionTree.
+func (s *Store) GetRole(ctx context.Context, id int64) (*rbac.StandardRole, error) {
+	roles, err := s.queryRoles(ctx, `WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, fmt.Errorf("%w: role %d", ErrNotFound, id)
+	}
+	return roles[0], nil
+}
+
+// ListRoles returns all roles by their ids, with their permissions in *rbac.PermissionTree.
+func (s *Store) ListRoles(ctx context.Context) ([]*rbac.StandardRole, error) {
+	return s.queryRoles(ctx, ``)
+}
+
+func (s *Store) queryRoles(ctx context.Context, where string, args ...interface{}) ([]*rbac.StandardRole, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, name, parent_id FROM rbac_roles `+where+` ORDER BY id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		roles []*rbac.StandardRole
+		index = make(map[int64]*rbac.StandardRole)
+	)
+	for rows.Next() {
+		var (
+			role   = &rbac.StandardRole{Permissions: rbac.NewPermissionTree()}
+			parent sql.NullInt64
+		)
+		if err := rows.Scan(&role.Id, &role.Name, &parent); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		role.ParentId = parent.Int64
+		roles = append(roles, role)
+		index[role.Id] = role
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+	if len(roles) == 0 {
+		return nil, nil
+	}
+
+	query := `SELECT role_id, uri, operation, effect FROM rbac_role_permissions ORDER BY role_id, position`
+	if where != `` {
+		query = `SELECT role_id, uri, operation, effect FROM rbac_role_permissions
+			WHERE role_id IN (SELECT id FROM rbac_roles ` + where + `) ORDER BY role_id, position`
+	}
+	rows, err = s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			roleID, operation int64
+			effect            int
+			p                 rbac.StandardPermission
+		)
+		if err := rows.Scan(&roleID, &p.URI, &operation, &effect); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		p.Operation, p.Effect = rbac.Operation(operation), rbac.Effect(effect)
+		if role, ok := index[roleID]; ok {
+			role.Permissions.Add(&p)
+		}
+	}
+	return roles, closeRows(rows)
+}
+
+// PutPolicy inserts a policy, or replaces the policy of the same uri.
+// Conditions are stored separated by commas, so names of conditions must be neither empty nor contain commas.
+func (s *Store) PutPolicy(ctx context.Context, policy rbac.StandardPolicy) error {
+	if err := rbac.ValidatePattern(policy.URI); err != nil || policy.URI == "" {
+		return fmt.Errorf("%w: policy uri %q", ErrInvalid, policy.URI)
+	}
+	for _, group := range policy.Groups {
+		for _, condition := range group.Conditions {
+			if condition == "" || strings.Contains(condition, ",") {
+				return fmt.Errorf("%w: condition %q of policy %q", ErrInvalid, condition, policy.URI)
+			}
+		}
+	}
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		if err := deletePolicy(ctx, tx, policy.URI); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO rbac_policies (uri) VALUES ($1)`, policy.URI); err != nil {
+			return err
+		}
+		for i, group := range policy.Groups {
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO rbac_policy_groups (uri, position, operation, effect, conditions) VALUES ($1, $2, $3, $4, $5)`,
+				policy.URI, i, int64(group.Operation), int(group.Effect), strings.Join(group.Conditions, ","))
+			if err != nil {
+				return err
+			}
+			for j, roleID := range group.RoleID {
+				_, err := tx.ExecContext(ctx,
+					`INSERT INTO rbac_policy_group_roles (uri, position, ordinal, role_id) VALUES ($1, $2, $3, $4)`,
+					policy.URI, i, j, roleID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Store) DeletePolicy(ctx context.Context, uri string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var exists int
+		err := tx.QueryRowContext(ctx, `SELECT 1 FROM rbac_policies WHERE uri = $1`, uri).Scan(&exists)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: policy %q", ErrNotFound, uri)
+		}
+		if err != nil {
+			return err
+		}
+		return deletePolicy(ctx, tx, uri)
+	})
+}
+
+func deletePolicy(ctx context.Context, tx *sql.Tx, uri string) error {
+	for _, query := range []string{
+		`DELETE FROM rbac_policy_group_roles WHERE uri = $1`,
+		`DELETE FROM rbac_policy_groups WHERE uri = $1`,
+		`DELETE FROM rbac_policies WHERE uri = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, uri); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetPolicy(ctx context.Context, uri string) (rbac.StandardPolicy, error) {
+	policies, err := s.queryPolicies(ctx, `WHERE uri = $1`, uri)
+	if err != nil {
+		return rbac.StandardPolicy{}, err
+	}
+	if len(policies) == 0 {
+		return rbac.StandardPolicy{}, fmt.Errorf("%w: policy %q", ErrNotFound, uri)
+	}
+	return policies[0], nil
+}
+
+// ListPolicies returns all policies by their uris.
+func (s *Store) ListPolicies(ctx context.Context) ([]rbac.StandardPolicy, error) {
+	return s.queryPolicies(ctx, ``)
+}
+
+func (s *Store) queryPolicies(ctx context.Context, where string, args ...interface{}) ([]rbac.StandardPolicy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT uri FROM rbac_policies `+where+` ORDER BY uri`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		policies []rbac.StandardPolicy
+		index    = make(map[string]int)
+	)
+	for rows.Next() {
+		var uri string
+		if err := rows.Scan(&uri); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		index[uri] = len(policies)
+		policies = append(policies, rbac.StandardPolicy{URI: uri, Groups: []rbac.PermissionGroup{}})
+	}
+	if err := closeRows(rows); err != nil || len(policies) == 0 {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT uri, operation, effect, conditions FROM rbac_policy_groups `+
+		where+` ORDER BY uri, position`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			uri, conditions string
+			operation       int64
+			effect          int
+			group           rbac.PermissionGroup
+		)
+		if err := rows.Scan(&uri, &operation, &effect, &conditions); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		group.Operation, group.Effect = rbac.Operation(operation), rbac.Effect(effect)
+		if conditions != "" {
+			group.Conditions = strings.Split(conditions, ",")
+		}
+		if i, ok := index[uri]; ok {
+			policies[i].Groups = append(policies[i].Groups, group)
+		}
+	}
+	if err := closeRows(rows); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `SELECT uri, position, role_id FROM rbac_policy_group_roles `+
+		where+` ORDER BY uri, position, ordinal`, args...)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var (
+			uri      string
+			position int
+			roleID   int64
+		)
+		if err := rows.Scan(&uri, &position, &roleID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[uri]; ok && position < len(policies[i].Groups) {
+			group := &policies[i].Groups[position]
+			group.RoleID = append(group.RoleID, roleID)
+		}
+	}
+	return policies, closeRows(rows)
+}
+
+// Assign adds an assignment or replaces the one of the same user, role and tenant.
+func (s *Store) Assign(ctx context.Context, a rbac.Assignment) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, `DELETE FROM rbac_assignments WHERE user_id = $1 AND role_id = $2 AND tenant = $3`,
+			a.UserID, a.RoleID, a.Tenant)
+		if err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			`INSERT INTO rbac_assignments (user_id, role_id, tenant, not_before, expires_at) VALUES ($1, $2, $3, $4, $5)`,
+			a.UserID, a.RoleID, a.Tenant, nullTime(a.NotBefore), nullTime(a.ExpiresAt))
+		return err
+	})
+}
+
+func (s *Store) Unassign(ctx context.Context, userID string, roleID int64, tenant string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM rbac_assignments WHERE user_id = $1 AND role_id = $2 AND tenant = $3`,
+		userID, roleID, tenant)
+	return err
+}
+
+// ListAssignments returns all assignments of a user, including ones which are not in effect.
+func (s *Store) ListAssignments(ctx context.Context, userID string) ([]rbac.Assignment, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT user_id, role_id, tenant, not_before, expires_at FROM rbac_assignments WHERE user_id = $1 ORDER BY tenant, role_id`,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+	var assignments []rbac.Assignment
+	for rows.Next() {
+		var (
+			a                    rbac.Assignment
+			notBefore, expiresAt sql.NullTime
+		)
+		if err := rows.Scan(&a.UserID, &a.RoleID, &a.Tenant, &notBefore, &expiresAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		a.NotBefore, a.ExpiresAt = notBefore.Time, expiresAt.Time
+		assignments = append(assignments, a)
+	}
+	return assignments, closeRows(rows)
+}
+
+// RolesOf returns ids of roles assigned to a user within a tenant, including roles assigned in every tenant,
+// whose assignments are in effect at t.
+func (s *Store) RolesOf(ctx context.Context, userID, tenant string, t time.Time) ([]int64, error) {
+	assignments, err := s.ListAssignments(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var roleID []int64
+	for _, a := range assignments {
+		if (a.Tenant == "" || a.Tenant == tenant) && a.ActiveAt(t) && !containsID(roleID, a.RoleID) {
+			roleID = append(roleID, a.RoleID)
+		}
+	}
+	return roleID, nil
+}
+
+// DeleteExpired deletes assignments which have expired at t, and returns how many are deleted.
+func (s *Store) DeleteExpired(ctx context.Context, t time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM rbac_assignments WHERE expires_at IS NOT NULL AND expires_at <= $1`,
+		t.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Assignments returns the store as rbac.Assignments, for AccessControl.Assignments.
+func (s *Store) Assignments() rbac.Assignments {
+	return assignments{s}
+}
+
+type assignments struct {
+	store *Store
+}
+
+func (a assignments) Assign(assignment rbac.Assignment) error {
+	return a.store.Assign(context.Background(), assignment)
+}
+
+func (a assignments) Unassign(userID string, roleID int64, tenant string) error {
+	return a.store.Unassign(context.Background(), userID, roleID, tenant)
+}
+
+func (a assignments) RolesOf(userID, tenant string, t time.Time) ([]int64, error) {
+	return a.store.RolesOf(context.Background(), userID, tenant, t)
+}
+
+// Load sets all roles into roles, if it is not nil, and loads all policies into policies.
+// Roles which the database no longer has are deleted from roles which can be ranged over and deleted from,
+// like *rbac.RoleManager. A *rbac.PolicyManager swaps the policies in as a new version from "sqlstore".
+func (s *Store) Load(ctx context.Context, policies rbac.Policies, roles rbac.Roles) error {
+	if roles != nil {
+		list, err := s.ListRoles(ctx)
+		if err != nil {
+			return err
+		}
+		stored := make(map[int64]bool, len(list))
+		for _, role := range list {
+			roles.SetRole(role)
+			stored[role.Id] = true
+		}
+		deleteMissing(roles, stored)
+	}
+	list, err := s.ListPolicies(ctx)
+	if err != nil {
+		return err
+	}
+	if manager, ok := policies.(*rbac.PolicyManager); ok {
+		manager.Load(list, "sqlstore")
+		return nil
+	}
+	policies.LoadPolicies(list)
+	return nil
+}
+
+// Source returns a PolicySource which reads policies every interval, for PolicyManager.Watch.
+// PolicyManager only swaps them in when they change.
+func (s *Store) Source(interval time.Duration) *rbac.PollingSource {
+	return &rbac.PollingSource{
+		SourceName: "sqlstore",
+		Interval:   interval,
+		Fetch:      s.ListPolicies,
+	}
+}
+
+// deleteMissing removes roles which are not stored, if roles can be ranged over and removed from.
+// Stored roles have lost a deleted parent already, so only children which are missing as well are reparented.
+func deleteMissing(roles rbac.Roles, stored map[int64]bool) {
+	manager, ok := roles.(interface {
+		Range(func(rbac.Role) bool)
+		RemoveRole(int64, rbac.RemoveMode) ([]int64, error)
+	})
+	if !ok {
+		return
+	}
+	var missing []int64
+	manager.Range(func(role rbac.Role) bool {
+		if !stored[role.ID()] {
+			missing = append(missing, role.ID())
+		}
+		return true
+	})
+	for _, id := range missing {
+		manager.RemoveRole(id, rbac.ReparentChildren)
+	}
+}
+
+func affected(result sql.Result, what string, id interface{}) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s %v", ErrNotFound, what, id)
+	}
+	return nil
+}
+
+func closeRows(rows *sql.Rows) error {
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	return rows.Close()
+}
+
+func listPermissions(permissions rbac.Permissions) []rbac.StandardPermission {
+	if lister, ok := permissions.(interface {
+		Permissions() []rbac.StandardPermission
+	}); ok {
+		return lister.Permissions()
+	}
+	return nil
+}
+
+func nullID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+func containsID(roleID []int64, id int64) bool {
+	for _, r := range roleID {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,195 @@
+package sqlstore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-pandora/pkg/rbac"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStore(t *testing.T) *Store {
+	db, err := sql.Open(`sqlite3`, filepath.Join(t.TempDir(), `rbac.db`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	store := New(db)
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestStore_Migrate(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	assert := assert.New(t)
+	assert.Nil(store.Migrate(ctx))
+	version, err := store.Version(ctx)
+	assert.Nil(err)
+	assert.Equal(SchemaVersion, version)
+}
+
+func TestStore_Roles(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	permissions := rbac.NewPermissionTree()
+	permissions.Add(&rbac.StandardPermission{URI: `/articles/**`, Operation: rbac.CRU})
+	permissions.Add(&rbac.StandardPermission{URI: `/articles/secret`, Operation: rbac.Read, Effect: rbac.Deny})
+
+	assert := assert.New(t)
+	assert.Nil(store.CreateRole(ctx, &rbac.StandardRole{Id: 1, Name: `admin`}))
+	assert.Nil(store.CreateRole(ctx, &rbac.StandardRole{Id: 2, Name: `editor`, Permissions: permissions, ParentId: 1}))
+	assert.ErrorIs(store.CreateRole(ctx, &rbac.StandardRole{Name: `nobody`}), ErrInvalid)
+	assert.NotNil(store.CreateRole(ctx, &rbac.StandardRole{Id: 1, Name: `again`}))
+
+	editor, err := store.GetRole(ctx, 2)
+	assert.Nil(err)
+	assert.Equal(`editor`, editor.Name)
+	assert.Equal(int64(1), editor.ParentId)
+	assert.True(editor.HasPermission(`/articles/1`, rbac.CRU))
+	assert.False(editor.HasPermission(`/articles/secret`, rbac.Read))
+
+	assert.Nil(store.UpdateRole(ctx, &rbac.StandardRole{Id: 2, Name: `writer`, ParentId: 1}))
+	editor, err = store.GetRole(ctx, 2)
+	assert.Nil(err)
+	assert.Equal(`writer`, editor.Name)
+	assert.True(editor.HasPermission(`/articles/1`, rbac.Update))
+	assert.ErrorIs(store.UpdateRole(ctx, &rbac.StandardRole{Id: 3}), ErrNotFound)
+
+	assert.Nil(store.SetPermissions(ctx, 2, []rbac.StandardPermission{{URI: `/comments/*`, Operation: rbac.Read}}))
+	editor, err = store.GetRole(ctx, 2)
+	assert.Nil(err)
+	assert.False(editor.HasPermission(`/articles/1`, rbac.Read))
+	assert.True(editor.HasPermission(`/comments/1`, rbac.Read))
+	assert.ErrorIs(store.SetPermissions(ctx, 3, nil), ErrNotFound)
+
+	assert.Nil(store.DeleteRole(ctx, 1))
+	roles, err := store.ListRoles(ctx)
+	assert.Nil(err)
+	assert.Equal(1, len(roles))
+	assert.Equal(int64(0), roles[0].ParentId)
+	_, err = store.GetRole(ctx, 1)
+	assert.ErrorIs(err, ErrNotFound)
+	assert.ErrorIs(store.DeleteRole(ctx, 1), ErrNotFound)
+}
+
+func TestStore_Policies(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	policies := []rbac.StandardPolicy{
+		{URI: `/articles/**`, Groups: []rbac.PermissionGroup{
+			{Operation: rbac.CR, RoleID: []int64{2, 1}},
+			{Operation: rbac.Update, RoleID: []int64{2}, Conditions: []string{`owner`, `business_hours`}},
+		}},
+		{URI: `/articles/secret`, Groups: []rbac.PermissionGroup{
+			{Operation: rbac.Read, RoleID: []int64{2}, Effect: rbac.Deny},
+		}},
+	}
+
+	assert := assert.New(t)
+	for _, policy := range policies {
+		assert.Nil(store.PutPolicy(ctx, policy))
+	}
+	assert.ErrorIs(store.PutPolicy(ctx, rbac.StandardPolicy{URI: `/data/{id:[}`}), ErrInvalid)
+	for _, condition := range []string{`owner,admin`, ``} {
+		assert.ErrorIs(store.PutPolicy(ctx, rbac.StandardPolicy{URI: `/data`, Groups: []rbac.PermissionGroup{
+			{Operation: rbac.Read, RoleID: []int64{1}, Conditions: []string{condition}},
+		}}), ErrInvalid)
+	}
+
+	list, err := store.ListPolicies(ctx)
+	assert.Nil(err)
+	assert.Equal(policies, list)
+	policy, err := store.GetPolicy(ctx, `/articles/secret`)
+	assert.Nil(err)
+	assert.Equal(policies[1], policy)
+
+	assert.Nil(store.PutPolicy(ctx, rbac.StandardPolicy{URI: `/articles/secret`, Groups: []rbac.PermissionGroup{}}))
+	policy, err = store.GetPolicy(ctx, `/articles/secret`)
+	assert.Nil(err)
+	assert.Empty(policy.Groups)
+
+	assert.Nil(store.DeletePolicy(ctx, `/articles/secret`))
+	_, err = store.GetPolicy(ctx, `/articles/secret`)
+	assert.ErrorIs(err, ErrNotFound)
+	assert.ErrorIs(store.DeletePolicy(ctx, `/articles/secret`), ErrNotFound)
+}
+
+func TestStore_Assignments(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	assert := assert.New(t)
+	assignments := store.Assignments()
+	assert.Nil(assignments.Assign(rbac.Assignment{UserID: `alice`, RoleID: 1}))
+	assert.Nil(assignments.Assign(rbac.Assignment{UserID: `alice`, RoleID: 2, Tenant: `acme`}))
+	assert.Nil(assignments.Assign(rbac.Assignment{UserID: `alice`, RoleID: 3, ExpiresAt: now.Add(-time.Minute)}))
+	assert.Nil(assignments.Assign(rbac.Assignment{UserID: `alice`, RoleID: 4, NotBefore: now.Add(time.Hour)}))
+	assert.Nil(assignments.Assign(rbac.Assignment{UserID: `alice`, RoleID: 2, Tenant: `acme`, ExpiresAt: now.Add(time.Hour)}))
+
+	roleID, err := assignments.RolesOf(`alice`, `acme`, now)
+	assert.Nil(err)
+	assert.ElementsMatch([]int64{1, 2}, roleID)
+	roleID, err = assignments.RolesOf(`alice`, `other`, now.Add(2*time.Hour))
+	assert.Nil(err)
+	assert.ElementsMatch([]int64{1, 4}, roleID)
+
+	list, err := store.ListAssignments(ctx, `alice`)
+	assert.Nil(err)
+	assert.Equal(4, len(list))
+	assert.True(now.Add(time.Hour).Equal(list[3].ExpiresAt))
+
+	deleted, err := store.DeleteExpired(ctx, now)
+	assert.Nil(err)
+	assert.Equal(int64(1), deleted)
+	assert.Nil(assignments.Unassign(`alice`, 1, ``))
+	roleID, err = assignments.RolesOf(`alice`, `acme`, now)
+	assert.Nil(err)
+	assert.Equal([]int64{2}, roleID)
+}
+
+func TestStore_Load(t *testing.T) {
+	store := newStore(t)
+	ctx := context.Background()
+
+	assert := assert.New(t)
+	assert.Nil(store.CreateRole(ctx, &rbac.StandardRole{Id: 1, Name: `admin`}))
+	assert.Nil(store.CreateRole(ctx, &rbac.StandardRole{Id: 2, Name: `editor`, ParentId: 1}))
+	assert.Nil(store.PutPolicy(ctx, rbac.StandardPolicy{URI: `/articles/*`, Groups: []rbac.PermissionGroup{
+		{Operation: rbac.Read, RoleID: []int64{2}},
+	}}))
+
+	roles := rbac.NewRoleManager()
+	manager := rbac.NewPolicyManager(func() rbac.Policies {
+		tree := rbac.NewPolicyTree()
+		tree.SetHierarchy(roles, rbac.ParentInherits)
+		return tree
+	})
+	assert.Nil(store.Load(ctx, manager, roles))
+	assert.Equal(`sqlstore`, manager.Current().Source)
+	assert.True(manager.IsGranted(`/articles/1`, rbac.Read, roles.GetRole(2)))
+	assert.True(manager.IsGranted(`/articles/1`, rbac.Read, roles.GetRole(1)))
+	assert.True(roles.IsSuperior(roles.GetRole(1), roles.GetRole(2)))
+
+	tree := rbac.NewPolicyTree()
+	assert.Nil(store.Load(ctx, tree, nil))
+	assert.True(tree.IsGranted(`/articles/1`, rbac.Read, roles.GetRole(2)))
+
+	// roles deleted from the database are deleted by the next load
+	assert.Nil(store.DeleteRole(ctx, 1))
+	assert.Nil(store.Load(ctx, manager, roles))
+	assert.Nil(roles.GetRole(1))
+	assert.NotNil(roles.GetRole(2))
+
+	policies, err := store.Source(time.Minute).Fetch(ctx)
+	assert.Nil(err)
+	assert.Equal(1, len(policies))
+}
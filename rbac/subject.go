@@ -0,0 +1,269 @@
+package rbac
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Subject is a user and all roles it holds.
+type Subject struct {
+	UserID string
+
+	// Tenant scopes roles of the user. It is empty if roles are not scoped.
+	Tenant string
+
+	RoleID []int64
+
+	// Attributes are evaluated by conditions of policies.
+	Attributes map[string]interface{}
+}
+
+// Attribute returns an attribute of the subject. "user_id" and "tenant" are the fields of the subject.
+func (s *Subject) Attribute(key string) (interface{}, bool) {
+	switch key {
+	case "user_id":
+		return s.UserID, s.UserID != ""
+	case "tenant":
+		return s.Tenant, s.Tenant != ""
+	}
+	value, ok := s.Attributes[key]
+	return value, ok
+}
+
+// attributeEquals shows whether an attribute of the subject equals value, compared by their text.
+func (s *Subject) attributeEquals(key string, value interface{}) bool {
+	attribute, ok := s.Attribute(key)
+	return ok && fmt.Sprint(attribute) == fmt.Sprint(value)
+}
+
+// Assignment assigns a role to a user, optionally within a tenant and for a limited time.
+type Assignment struct {
+	UserID string
+	RoleID int64
+
+	// Tenant is empty if the role is assigned in every tenant.
+	Tenant string
+
+	// NotBefore is the time the assignment starts. A zero time means it starts at once.
+	NotBefore time.Time
+
+	// ExpiresAt is the time the assignment ends. A zero time means it never ends.
+	ExpiresAt time.Time
+}
+
+// ActiveAt shows whether the assignment is in effect at t.
+func (a *Assignment) ActiveAt(t time.Time) bool {
+	if !a.NotBefore.IsZero() && t.Before(a.NotBefore) {
+		return false
+	}
+	return a.ExpiresAt.IsZero() || t.Before(a.ExpiresAt)
+}
+
+type Assignments interface {
+	// Assign should add an assignment or replace the one of the same user, role and tenant.
+	Assign(Assignment) error
+
+	// Unassign should remove the assignment of a role to a user within a tenant.
+	Unassign(userID string, roleID int64, tenant string) error
+
+	// RolesOf should return ids of roles assigned to a user within a tenant, including roles
+	// assigned in every tenant, whose assignments are in effect at t.
+	RolesOf(userID, tenant string, t time.Time) ([]int64, error)
+}
+
+type assignmentKey struct {
+	userID string
+	roleID int64
+	tenant string
+}
+
+// AssignmentStore keeps assignments in memory.
+// An assignment which has expired is kept until DeleteExpired deletes it.
+type AssignmentStore struct {
+	// Constraints are checked by Assign and Unassign, if they are set.
+	// Assignments which have not expired count, including ones which have not started yet.
+	Constraints *Constraints
+
+	mu          sync.Mutex
+	assignments map[string]map[assignmentKey]Assignment
+}
+
+func NewAssignmentStore() *AssignmentStore {
+	return &AssignmentStore{assignments: make(map[string]map[assignmentKey]Assignment)}
+}
+
+func (s *AssignmentStore) Assign(a Assignment) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(a, false); err != nil {
+		return err
+	}
+	user, ok := s.assignments[a.UserID]
+	if !ok {
+		user = make(map[assignmentKey]Assignment)
+		s.assignments[a.UserID] = user
+	}
+	user[assignmentKey{a.UserID, a.RoleID, a.Tenant}] = a
+	return nil
+}
+
+func (s *AssignmentStore) Unassign(userID string, roleID int64, tenant string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.check(Assignment{UserID: userID, RoleID: roleID, Tenant: tenant}, true); err != nil {
+		return err
+	}
+	delete(s.assignments[userID], assignmentKey{userID, roleID, tenant})
+	return nil
+}
+
+func (s *AssignmentStore) RolesOf(userID, tenant string, t time.Time) ([]int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var roleID []int64
+	for _, a := range s.assignments[userID] {
+		if (a.Tenant == "" || a.Tenant == tenant) && a.ActiveAt(t) && !containsID(roleID, a.RoleID) {
+			roleID = append(roleID, a.RoleID)
+		}
+	}
+	return roleID, nil
+}
+
+// DeleteExpired deletes assignments which have expired at t, and returns how many are deleted.
+func (s *AssignmentStore) DeleteExpired(t time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := 0
+	for userID, user := range s.assignments {
+		for key, a := range user {
+			if !a.ExpiresAt.IsZero() && !t.Before(a.ExpiresAt) {
+				delete(user, key)
+				deleted++
+			}
+		}
+		if len(user) == 0 {
+			delete(s.assignments, userID)
+		}
+	}
+	return deleted
+}
+
+// List returns all assignments of a user, including ones which are not in effect.
+func (s *AssignmentStore) List(userID string) []Assignment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Assignment, 0, len(s.assignments[userID]))
+	for _, a := range s.assignments[userID] {
+		list = append(list, a)
+	}
+	return list
+}
+
+// check checks Constraints before a is assigned, or unassigned if remove is true, in every tenant it affects.
+// It must be called with mu held.
+func (s *AssignmentStore) check(a Assignment, remove bool) error {
+	if s.Constraints == nil {
+		return nil
+	}
+	now := time.Now()
+	user := s.assignments[a.UserID]
+	key := assignmentKey{a.UserID, a.RoleID, a.Tenant}
+	live := func(b Assignment) bool {
+		return b.ExpiresAt.IsZero() || now.Before(b.ExpiresAt)
+	}
+
+	// An assignment in every tenant affects roles of the user in each of them.
+	tenants := []string{a.Tenant}
+	if a.Tenant == "" {
+		for k := range user {
+			if k.tenant != "" && !containsString(tenants, k.tenant) {
+				tenants = append(tenants, k.tenant)
+			}
+		}
+	}
+	for _, tenant := range tenants {
+		var held []int64
+		for k, b := range user {
+			if k == key || !live(b) || (b.Tenant != "" && b.Tenant != tenant) || containsID(held, b.RoleID) {
+				continue
+			}
+			// The role of an assignment is added to held by CheckAssign.
+			if remove || b.RoleID != a.RoleID {
+				held = append(held, b.RoleID)
+			}
+		}
+		if remove {
+			if err := s.Constraints.CheckUnassign(a.UserID, held); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := s.Constraints.CheckAssign(a.UserID, a.RoleID, held, s.members(a, live)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// members counts other users who are assigned the role of a in a tenant it overlaps. It must be called with mu held.
+func (s *AssignmentStore) members(a Assignment, live func(Assignment) bool) int {
+	members := 0
+	for userID, user := range s.assignments {
+		if userID == a.UserID {
+			continue
+		}
+		for _, b := range user {
+			if b.RoleID == a.RoleID && live(b) && (a.Tenant == "" || b.Tenant == "" || a.Tenant == b.Tenant) {
+				members++
+				break
+			}
+		}
+	}
+	return members
+}
+
+// IsSubjectGranted shows whether one of roles of a subject can operate a resource.
+func (ac *AccessControl) IsSubjectGranted(uri string, op Operation, sub Subject) bool {
+	return ac.Authorize(context.Background(), &Request{
+		URI:       uri,
+		Operation: op,
+		Subject:   sub,
+		Env:       Environment{Time: time.Now()},
+	}).Granted
+}
+
+// Enforce adds roles assigned to a subject by Assignments to the ones it already holds,
+// and shows whether the subject can operate a resource.
+// It fails if the roles of the subject break Constraints together, which a Session can avoid.
+func (ac *AccessControl) Enforce(uri string, op Operation, sub Subject) (bool, error) {
+	if ac.Assignments != nil {
+		assigned, err := ac.Assignments.RolesOf(sub.UserID, sub.Tenant, time.Now())
+		if err != nil {
+			return false, err
+		}
+		roleID := append([]int64(nil), sub.RoleID...)
+		for _, id := range assigned {
+			if !containsID(roleID, id) {
+				roleID = append(roleID, id)
+			}
+		}
+		sub.RoleID = roleID
+	}
+	if ac.Constraints != nil {
+		if err := ac.Constraints.CheckActivate(sub.UserID, sub.RoleID); err != nil {
+			return false, err
+		}
+	}
+	return ac.IsSubjectGranted(uri, op, sub), nil
+}
+
+func containsID(roleID []int64, id int64) bool {
+	for _, r := range roleID {
+		if r == id {
+			return true
+		}
+	}
+	return false
+}
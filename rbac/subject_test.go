@@ -0,0 +1,82 @@
+package rbac
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAssignmentStore_RolesOf(t *testing.T) {
+	now := time.Date(2019, 3, 10, 8, 0, 0, 0, time.UTC)
+	store := NewAssignmentStore()
+	store.Assign(Assignment{UserID: `alice`, RoleID: 1})
+	store.Assign(Assignment{UserID: `alice`, RoleID: 2, Tenant: `acme`})
+	store.Assign(Assignment{UserID: `alice`, RoleID: 3, ExpiresAt: now.Add(time.Hour)})
+	store.Assign(Assignment{UserID: `alice`, RoleID: 4, NotBefore: now.Add(time.Hour)})
+
+	assert := assert.New(t)
+	roleID, err := store.RolesOf(`alice`, ``, now)
+	assert.NoError(err)
+	assert.ElementsMatch([]int64{1, 3}, roleID)
+
+	roleID, _ = store.RolesOf(`alice`, `acme`, now)
+	assert.ElementsMatch([]int64{1, 2, 3}, roleID)
+
+	roleID, _ = store.RolesOf(`alice`, `acme`, now.Add(2*time.Hour))
+	assert.ElementsMatch([]int64{1, 2, 4}, roleID)
+	// reading roles at a later time does not remove assignments which are in effect now
+	assert.Equal(4, len(store.List(`alice`)))
+	roleID, _ = store.RolesOf(`alice`, ``, now)
+	assert.ElementsMatch([]int64{1, 3}, roleID)
+
+	assert.Equal(0, store.DeleteExpired(now))
+	assert.Equal(1, store.DeleteExpired(now.Add(2*time.Hour)))
+	assert.Equal(3, len(store.List(`alice`)))
+
+	store.Unassign(`alice`, 2, `acme`)
+	roleID, _ = store.RolesOf(`alice`, `acme`, now.Add(2*time.Hour))
+	assert.ElementsMatch([]int64{1, 4}, roleID)
+
+	roleID, _ = store.RolesOf(`bob`, ``, now)
+	assert.Empty(roleID)
+}
+
+func TestAccessControl_Enforce(t *testing.T) {
+	policies := []StandardPolicy{
+		{`/data/**`, []PermissionGroup{
+			{Operation: Read, RoleID: []int64{3}},
+			{Operation: Delete, RoleID: []int64{1}},
+		}},
+	}
+	roles := []StandardRole{
+		{1, `admin`, nil, 0},
+		{3, `role1`, nil, 0},
+		{7, `guest`, nil, 0},
+	}
+
+	ac := NewAccessControl(NewPolicyTree(), NewRoleManager())
+	ac.LoadPolicies(policies)
+	for i := range roles {
+		ac.SetRole(&roles[i])
+	}
+	store := NewAssignmentStore()
+	store.Assign(Assignment{UserID: `alice`, RoleID: 3, Tenant: `acme`})
+	store.Assign(Assignment{UserID: `bob`, RoleID: 1, ExpiresAt: time.Now().Add(-time.Minute)})
+	ac.Assignments = store
+
+	assert := assert.New(t)
+	assert.True(ac.IsSubjectGranted(`/data/1`, Read, Subject{RoleID: []int64{7, 3}}))
+	assert.False(ac.IsSubjectGranted(`/data/1`, Delete, Subject{RoleID: []int64{7, 3}}))
+	assert.True(ac.IsSubjectGranted(`/public`, Delete, Subject{}))
+
+	granted, err := ac.Enforce(`/data/1`, Read, Subject{UserID: `alice`, Tenant: `acme`})
+	assert.NoError(err)
+	assert.True(granted)
+	granted, _ = ac.Enforce(`/data/1`, Read, Subject{UserID: `alice`, Tenant: `other`})
+	assert.False(granted)
+	granted, _ = ac.Enforce(`/data/1`, Delete, Subject{UserID: `bob`})
+	assert.False(granted)
+	granted, _ = ac.Enforce(`/data/1`, Delete, Subject{UserID: `bob`, RoleID: []int64{1}})
+	assert.True(granted)
+}
@@ -0,0 +1,502 @@
+package rbac
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	ErrUnknownTenant  = errors.New("RBAC: unknown tenant")
+	ErrTooManyTenants = errors.New("RBAC: too many tenants")
+	ErrTooManyRoles   = errors.New("RBAC: too many roles")
+)
+
+// TenantResolver returns the tenant of a request. It should return false if the request has no tenant.
+type TenantResolver func(c *gin.Context) (tenant string, ok bool)
+
+// HeaderTenant returns a TenantResolver which reads the tenant from a header, such as "X-Tenant-ID".
+func HeaderTenant(header string) TenantResolver {
+	return func(c *gin.Context) (string, bool) {
+		tenant := strings.TrimSpace(c.GetHeader(header))
+		return tenant, tenant != ""
+	}
+}
+
+// SubdomainTenant returns a TenantResolver which takes the subdomain of domain as the tenant,
+// such as "acme" of "acme.example.com" for "example.com".
+func SubdomainTenant(domain string) TenantResolver {
+	suffix := "." + strings.ToLower(strings.Trim(domain, "."))
+	return func(c *gin.Context) (string, bool) {
+		host := strings.ToLower(c.Request.Host)
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if !strings.HasSuffix(host, suffix) {
+			return "", false
+		}
+		tenant := strings.TrimSuffix(host, suffix)
+		return tenant, tenant != "" && !strings.Contains(tenant, ".")
+	}
+}
+
+// ClaimTenant returns a TenantResolver which reads the tenant from the field key of "user_info",
+// which is set by jwt.Token.Authenticator from data of a token.
+func ClaimTenant(key string) TenantResolver {
+	return func(c *gin.Context) (string, bool) {
+		value, ok := c.Get("user_info")
+		if !ok {
+			return "", false
+		}
+		info, ok := value.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		switch tenant := info[key].(type) {
+		case string:
+			return tenant, tenant != ""
+		case float64:
+			return fmt.Sprint(int64(tenant)), true
+		}
+		return "", false
+	}
+}
+
+// TenantLoader loads policies and roles of a tenant when it is first used.
+// It should return an error wrapping ErrUnknownTenant if the tenant does not exist.
+type TenantLoader func(ctx context.Context, tenant string) ([]StandardPolicy, []Role, error)
+
+// TenantAccessControl keeps an AccessControl for every tenant, with its own policies and roles.
+// Tenants are loaded on first use by Loader, and the least recently used ones are evicted
+// when there are more than MaxTenants, to be loaded again when they are used.
+type TenantAccessControl struct {
+	// Global roles are shared by all tenants. Ids of roles of tenants should not collide with them;
+	// a role of a tenant hides a global role of the same id.
+	Global *RoleManager
+
+	Loader TenantLoader
+
+	// MaxTenants limits the number of tenants held at once, if it is positive.
+	// Only tenants which Loader can load again are evicted for new ones, once the new ones are loaded,
+	// so ErrTooManyTenants is returned when none of them can be.
+	MaxTenants int
+
+	// MaxRoles limits the number of roles of a tenant, global roles excluded, if it is positive.
+	// Roles beyond it are not set, even by SetRole of the AccessControl of the tenant.
+	MaxRoles int
+
+	// UnknownTTL is how long a tenant which Loader does not find is remembered, so that it is not loaded
+	// again for every request. A minute is used if it is 0, and unknown tenants are not remembered if it is negative.
+	UnknownTTL time.Duration
+
+	// Configure is called with the AccessControl of every tenant when it is created,
+	// to set options such as Audit, Conditions or Assignments.
+	Configure func(tenant string, ac *AccessControl)
+
+	// PolicyFactory builds policies of every tenant like the factory of NewPolicyManager.
+	// A PolicyTree granting a parent what its children are granted, through roles of the tenant, is built if it is nil.
+	PolicyFactory func(roles Roles) Policies
+
+	mu      sync.Mutex
+	tenants map[string]*tenantEntry
+	lru     list.List
+	unknown map[string]time.Time
+}
+
+// maxUnknownTenants limits the number of unknown tenants remembered at once.
+const maxUnknownTenants = 1024
+
+type tenantEntry struct {
+	tenant   string
+	ac       *AccessControl
+	policies *PolicyManager
+	roles    *tenantRoles
+	loaded   bool // by Loader, so that it can be evicted
+	lastUsed atomic.Int64
+	element  *list.Element
+
+	ready chan struct{}
+	err   error
+}
+
+func NewTenantAccessControl(loader TenantLoader) *TenantAccessControl {
+	return &TenantAccessControl{Global: NewRoleManager(), Loader: loader}
+}
+
+// Tenant returns the AccessControl of a tenant, loading the tenant if it is not held.
+func (t *TenantAccessControl) Tenant(ctx context.Context, tenant string) (*AccessControl, error) {
+	t.mu.Lock()
+	if e, ok := t.tenants[tenant]; ok {
+		t.lru.MoveToFront(e.element)
+		t.mu.Unlock()
+		select {
+		case <-e.ready:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if e.err != nil {
+			return nil, e.err
+		}
+		e.lastUsed.Store(time.Now().UnixNano())
+		return e.ac, nil
+	}
+	if t.Loader == nil || time.Now().Before(t.unknown[tenant]) {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+	e, err := t.insert(tenant, true)
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	policies, roles, err := t.Loader(ctx, tenant)
+	if err == nil {
+		err = t.fill(e, policies, roles)
+	}
+	t.mu.Lock()
+	if err == nil {
+		err = t.evict(e)
+	}
+	if err != nil {
+		t.remove(e)
+		if errors.Is(err, ErrUnknownTenant) {
+			t.remember(tenant)
+		}
+	}
+	t.mu.Unlock()
+	e.err = err
+	close(e.ready)
+	if err != nil {
+		return nil, err
+	}
+	return e.ac, nil
+}
+
+// Load sets policies and roles of a tenant, replacing the ones it holds. A tenant which is set by Load
+// is never evicted for other tenants or by EvictIdle, since Loader may not load it again, but Evict drops it.
+func (t *TenantAccessControl) Load(tenant string, policies []StandardPolicy, roles []Role) error {
+	if t.MaxRoles > 0 && len(roles) > t.MaxRoles {
+		return fmt.Errorf("%w: tenant %q has %d roles, more than %d", ErrTooManyRoles, tenant, len(roles), t.MaxRoles)
+	}
+	t.mu.Lock()
+	e, ok := t.tenants[tenant]
+	if ok {
+		t.remove(e)
+	}
+	delete(t.unknown, tenant)
+	e, err := t.insert(tenant, false)
+	t.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	err = t.fill(e, policies, roles)
+	t.mu.Lock()
+	if err == nil {
+		err = t.evict(e)
+	}
+	if err != nil {
+		t.remove(e)
+	}
+	t.mu.Unlock()
+	e.err = err
+	close(e.ready)
+	return err
+}
+
+// SetRole sets a role of a tenant, which must be held. It waits until the tenant is loaded or ctx is done.
+func (t *TenantAccessControl) SetRole(ctx context.Context, tenant string, role Role) error {
+	t.mu.Lock()
+	e, ok := t.tenants[tenant]
+	t.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownTenant, tenant)
+	}
+	select {
+	case <-e.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if e.err != nil {
+		return e.err
+	}
+	return t.setRole(e, role)
+}
+
+// Evict drops a tenant, which is loaded again by Loader when it is used, even if Loader did not find it before.
+func (t *TenantAccessControl) Evict(tenant string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if e, ok := t.tenants[tenant]; ok {
+		t.remove(e)
+	}
+	delete(t.unknown, tenant)
+}
+
+// EvictIdle drops tenants which Loader can load again and have not been used since before,
+// and returns how many are dropped. Call it periodically to release inactive tenants.
+func (t *TenantAccessControl) EvictIdle(before time.Time) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	evicted := 0
+	for _, e := range t.tenants {
+		if e.loaded && e.lastUsed.Load() < before.UnixNano() && isReady(e) {
+			t.remove(e)
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Tenants returns the tenants held, in order.
+func (t *TenantAccessControl) Tenants() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tenants := make([]string, 0, len(t.tenants))
+	for tenant := range t.tenants {
+		tenants = append(tenants, tenant)
+	}
+	sort.Strings(tenants)
+	return tenants
+}
+
+// Authorize decides a request within a tenant, which becomes the tenant of its subject.
+func (t *TenantAccessControl) Authorize(ctx context.Context, tenant string, req *Request) (Decision, error) {
+	ac, err := t.Tenant(ctx, tenant)
+	if err != nil {
+		return Decision{}, err
+	}
+	req.Subject.Tenant = tenant
+	return ac.Authorize(ctx, req), nil
+}
+
+// Enforcer is like AccessControl.Enforcer within the tenant of every request. It aborts with 400
+// if the tenant can not be resolved, with 404 if it does not exist, and with 503 if it can not be loaded.
+func (t *TenantAccessControl) Enforcer(resolve TenantResolver, extract RoleExtractor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant, ok := resolve(c)
+		if !ok {
+			c.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		ac, err := t.Tenant(c.Request.Context(), tenant)
+		switch {
+		case errors.Is(err, ErrUnknownTenant):
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		case err != nil:
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		c.Set("tenant", tenant)
+		ac.enforce(c, extract, tenant)
+	}
+}
+
+// insert adds an entry of a tenant, unless there are too many tenants and none can be evicted for it.
+// The least recently used tenant is only evicted by evict once the entry is filled, so that a tenant
+// which fails to load evicts none. It must be called with mu held.
+func (t *TenantAccessControl) insert(tenant string, loaded bool) (*tenantEntry, error) {
+	if t.tenants == nil {
+		t.tenants = make(map[string]*tenantEntry)
+	}
+	if t.MaxTenants > 0 && len(t.tenants) >= t.MaxTenants && t.victim(nil) == nil {
+		return nil, fmt.Errorf("%w: more than %d", ErrTooManyTenants, t.MaxTenants)
+	}
+
+	roles := &tenantRoles{tenant: NewRoleManager(), global: t.Global, name: tenant, max: t.MaxRoles}
+	factory := func() Policies {
+		if t.PolicyFactory != nil {
+			return t.PolicyFactory(roles)
+		}
+		tree := NewPolicyTree()
+		tree.SetHierarchy(roles, ParentInherits)
+		return tree
+	}
+	e := &tenantEntry{tenant: tenant, roles: roles, policies: NewPolicyManager(factory), loaded: loaded, ready: make(chan struct{})}
+	e.ac = NewAccessControl(e.policies, roles)
+	if t.Configure != nil {
+		t.Configure(tenant, e.ac)
+	}
+	e.lastUsed.Store(time.Now().UnixNano())
+	e.element = t.lru.PushFront(e)
+	t.tenants[tenant] = e
+	return e, nil
+}
+
+// evict drops the least recently used tenants other than e while there are too many.
+// It must be called with mu held.
+func (t *TenantAccessControl) evict(e *tenantEntry) error {
+	for t.MaxTenants > 0 && len(t.tenants) > t.MaxTenants {
+		victim := t.victim(e)
+		if victim == nil {
+			return fmt.Errorf("%w: more than %d", ErrTooManyTenants, t.MaxTenants)
+		}
+		t.remove(victim)
+	}
+	return nil
+}
+
+// victim returns the least recently used tenant other than e which Loader can load again.
+// It must be called with mu held.
+func (t *TenantAccessControl) victim(e *tenantEntry) *tenantEntry {
+	for element := t.lru.Back(); element != nil; element = element.Prev() {
+		if v := element.Value.(*tenantEntry); v != e && v.loaded && isReady(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// remember keeps a tenant which Loader does not find for UnknownTTL. It must be called with mu held.
+func (t *TenantAccessControl) remember(tenant string) {
+	ttl := t.UnknownTTL
+	if ttl == 0 {
+		ttl = time.Minute
+	}
+	if ttl < 0 {
+		return
+	}
+	now := time.Now()
+	if len(t.unknown) >= maxUnknownTenants {
+		for name, expires := range t.unknown {
+			if !now.Before(expires) {
+				delete(t.unknown, name)
+			}
+		}
+		if len(t.unknown) >= maxUnknownTenants {
+			return
+		}
+	}
+	if t.unknown == nil {
+		t.unknown = make(map[string]time.Time)
+	}
+	t.unknown[tenant] = now.Add(ttl)
+}
+
+// remove drops an entry. It must be called with mu held.
+func (t *TenantAccessControl) remove(e *tenantEntry) {
+	if t.tenants[e.tenant] == e {
+		delete(t.tenants, e.tenant)
+		t.lru.Remove(e.element)
+	}
+}
+
+func (t *TenantAccessControl) fill(e *tenantEntry, policies []StandardPolicy, roles []Role) error {
+	if t.MaxRoles > 0 && len(roles) > t.MaxRoles {
+		return fmt.Errorf("%w: tenant %q has %d roles, more than %d", ErrTooManyRoles, e.tenant, len(roles), t.MaxRoles)
+	}
+	for _, role := range roles {
+		e.roles.SetRole(role)
+	}
+	e.policies.Load(policies, e.tenant)
+	return nil
+}
+
+func (t *TenantAccessControl) setRole(e *tenantEntry, role Role) error {
+	e.roles.mu.Lock()
+	defer e.roles.mu.Unlock()
+	return e.roles.set(role)
+}
+
+func isReady(e *tenantEntry) bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// tenantRoles are roles of a tenant with the global roles behind them.
+type tenantRoles struct {
+	mu     sync.Mutex
+	count  int
+	tenant *RoleManager
+	global *RoleManager
+
+	// name is the tenant, and max limits its roles if it is positive.
+	name string
+	max  int
+}
+
+// SetRole sets a role of the tenant, unless it is a new role beyond the limit of roles of the tenant.
+func (r *tenantRoles) SetRole(role Role) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.set(role)
+}
+
+// set sets a role unless it is a new role beyond the limit. It must be called with mu held.
+func (r *tenantRoles) set(role Role) error {
+	if r.tenant.GetRole(role.ID()) == nil {
+		if r.max > 0 && r.count >= r.max {
+			return fmt.Errorf("%w: tenant %q has %d roles", ErrTooManyRoles, r.name, r.max)
+		}
+		r.count++
+	}
+	r.tenant.SetRole(role)
+	return nil
+}
+
+func (r *tenantRoles) GetRole(id int64) Role {
+	if role := r.tenant.GetRole(id); role != nil {
+		return role
+	}
+	if r.global == nil {
+		return nil
+	}
+	return r.global.GetRole(id)
+}
+
+// IsSuperior shows whether superior is an ancestor of subordinate, through roles of the tenant and global roles.
+func (r *tenantRoles) IsSuperior(superior, subordinate Role) bool {
+	visited := map[int64]bool{subordinate.ID(): true}
+	for parent := r.GetRole(subordinate.ParentID()); parent != nil; parent = r.GetRole(parent.ParentID()) {
+		if parent.ID() == superior.ID() {
+			return true
+		}
+		if visited[parent.ID()] {
+			return false
+		}
+		visited[parent.ID()] = true
+	}
+	return false
+}
+
+// Range calls f for every role of the tenant, then for every global role it does not hide.
+func (r *tenantRoles) Range(f func(Role) bool) {
+	more := true
+	r.tenant.Range(func(role Role) bool {
+		more = f(role)
+		return more
+	})
+	if !more || r.global == nil {
+		return
+	}
+	r.global.Range(func(role Role) bool {
+		if r.tenant.GetRole(role.ID()) != nil {
+			return true
+		}
+		return f(role)
+	})
+}
+
+// Generation changes whenever a role of the tenant or a global role is set.
+func (r *tenantRoles) Generation() uint64 {
+	generation := r.tenant.Generation()
+	if r.global != nil {
+		generation += r.global.Generation()
+	}
+	return generation
+}
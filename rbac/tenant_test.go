@@ -0,0 +1,291 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func tenantLoader(loads *int32) TenantLoader {
+	return func(ctx context.Context, tenant string) ([]StandardPolicy, []Role, error) {
+		atomic.AddInt32(loads, 1)
+		switch tenant {
+		case `acme`:
+			return []StandardPolicy{
+				{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{10}}, {Operation: Delete, RoleID: []int64{1}}}},
+			}, []Role{
+				&StandardRole{Id: 10, Name: `reader`, ParentId: 1},
+			}, nil
+		case `globex`:
+			return []StandardPolicy{
+				{`/data/**`, []PermissionGroup{{Operation: Read, RoleID: []int64{20}}}},
+			}, []Role{&StandardRole{Id: 20, Name: `reader`}}, nil
+		case `broken`:
+			return nil, nil, errors.New(`database is down`)
+		}
+		return nil, nil, ErrUnknownTenant
+	}
+}
+
+func TestTenantAccessControl(t *testing.T) {
+	var loads int32
+	tac := NewTenantAccessControl(tenantLoader(&loads))
+	tac.Global.SetRole(&StandardRole{Id: 1, Name: `admin`})
+	ctx := context.Background()
+
+	authorize := func(tenant, uri string, operation Operation, roleID ...int64) bool {
+		decision, err := tac.Authorize(ctx, tenant, &Request{URI: uri, Operation: operation, Subject: Subject{RoleID: roleID}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return decision.Granted
+	}
+
+	assert := assert.New(t)
+	assert.True(authorize(`acme`, `/data/1`, Read, 10))
+	assert.False(authorize(`acme`, `/data/1`, Read, 20))
+	assert.True(authorize(`globex`, `/data/1`, Read, 20))
+	assert.False(authorize(`globex`, `/data/1`, Read, 10))
+
+	// global roles are shared, and inherit roles of tenants
+	assert.True(authorize(`acme`, `/data/1`, Delete, 1))
+	assert.True(authorize(`acme`, `/data/1`, Read, 1))
+	assert.False(authorize(`globex`, `/data/1`, Read, 1))
+	assert.Equal(int32(2), loads)
+
+	_, err := tac.Tenant(ctx, `initech`)
+	assert.True(errors.Is(err, ErrUnknownTenant))
+	_, err = tac.Tenant(ctx, `broken`)
+	assert.EqualError(err, `database is down`)
+	assert.Equal([]string{`acme`, `globex`}, tac.Tenants())
+
+	assert.Nil(tac.SetRole(ctx, `globex`, &StandardRole{Id: 21, Name: `manager`}))
+	assert.False(authorize(`globex`, `/data/1`, Read, 21))
+	assert.Nil(tac.SetRole(ctx, `globex`, &StandardRole{Id: 20, Name: `reader`, ParentId: 21}))
+	assert.True(authorize(`globex`, `/data/1`, Read, 21))
+	assert.True(errors.Is(tac.SetRole(ctx, `initech`, &StandardRole{Id: 30}), ErrUnknownTenant))
+
+	tac.Evict(`acme`)
+	assert.Equal([]string{`globex`}, tac.Tenants())
+	assert.True(authorize(`acme`, `/data/1`, Read, 10))
+	assert.Equal(int32(5), loads)
+}
+
+func TestTenantAccessControl_Limits(t *testing.T) {
+	var loads int32
+	tac := NewTenantAccessControl(tenantLoader(&loads))
+	tac.MaxTenants = 1
+	tac.MaxRoles = 1
+	ctx := context.Background()
+
+	assert := assert.New(t)
+	_, err := tac.Tenant(ctx, `acme`)
+	assert.Nil(err)
+	_, err = tac.Tenant(ctx, `globex`)
+	assert.Nil(err)
+	assert.Equal([]string{`globex`}, tac.Tenants())
+
+	err = tac.SetRole(ctx, `globex`, &StandardRole{Id: 21})
+	assert.True(errors.Is(err, ErrTooManyRoles))
+	assert.Nil(tac.SetRole(ctx, `globex`, &StandardRole{Id: 20, Name: `renamed`}))
+	err = tac.Load(`globex`, nil, []Role{&StandardRole{Id: 20}, &StandardRole{Id: 21}})
+	assert.True(errors.Is(err, ErrTooManyRoles))
+
+	// tenants set by Load can not be evicted without a loader
+	tac = NewTenantAccessControl(nil)
+	tac.MaxTenants = 1
+	assert.Nil(tac.Load(`acme`, nil, nil))
+	assert.True(errors.Is(tac.Load(`globex`, nil, nil), ErrTooManyTenants))
+	assert.Nil(tac.Load(`acme`, nil, nil))
+	_, err = tac.Tenant(ctx, `globex`)
+	assert.True(errors.Is(err, ErrUnknownTenant))
+
+	// nor with a loader, which may not load them again
+	tac = NewTenantAccessControl(tenantLoader(&loads))
+	tac.MaxTenants = 1
+	assert.Nil(tac.Load(`initech`, nil, []Role{&StandardRole{Id: 30}}))
+	_, err = tac.Tenant(ctx, `acme`)
+	assert.True(errors.Is(err, ErrTooManyTenants))
+	assert.Equal(0, tac.EvictIdle(time.Now().Add(time.Second)))
+	ac, err := tac.Tenant(ctx, `initech`)
+	assert.Nil(err)
+	assert.NotNil(ac.GetRole(30))
+}
+
+func TestTenantAccessControl_Unknown(t *testing.T) {
+	var loads int32
+	tac := NewTenantAccessControl(tenantLoader(&loads))
+	tac.MaxTenants = 1
+	tac.MaxRoles = 1
+	ctx := context.Background()
+
+	assert := assert.New(t)
+	ac, err := tac.Tenant(ctx, `acme`)
+	assert.Nil(err)
+
+	// tenants which do not exist evict none, and are not loaded again
+	for i := 0; i < 3; i++ {
+		_, err = tac.Tenant(ctx, `initech`)
+		assert.True(errors.Is(err, ErrUnknownTenant))
+	}
+	_, err = tac.Tenant(ctx, `broken`)
+	assert.EqualError(err, `database is down`)
+	assert.Equal([]string{`acme`}, tac.Tenants())
+	assert.Equal(int32(3), loads)
+
+	tac.Evict(`initech`)
+	_, err = tac.Tenant(ctx, `initech`)
+	assert.True(errors.Is(err, ErrUnknownTenant))
+	assert.Equal(int32(4), loads)
+
+	// roles set through the AccessControl of a tenant are limited as well
+	ac.SetRole(&StandardRole{Id: 11, Name: `writer`})
+	assert.Nil(ac.GetRole(11))
+	assert.True(errors.Is(tac.SetRole(ctx, `acme`, &StandardRole{Id: 11}), ErrTooManyRoles))
+
+	tac = NewTenantAccessControl(tenantLoader(&loads))
+	tac.UnknownTTL = -1
+	_, err = tac.Tenant(ctx, `initech`)
+	assert.True(errors.Is(err, ErrUnknownTenant))
+	_, err = tac.Tenant(ctx, `initech`)
+	assert.True(errors.Is(err, ErrUnknownTenant))
+	assert.Equal(int32(6), loads)
+}
+
+func TestTenantAccessControl_EvictIdle(t *testing.T) {
+	var loads int32
+	tac := NewTenantAccessControl(tenantLoader(&loads))
+	ctx := context.Background()
+
+	assert := assert.New(t)
+	_, err := tac.Tenant(ctx, `acme`)
+	assert.Nil(err)
+	before := time.Now()
+	time.Sleep(time.Millisecond)
+	_, err = tac.Tenant(ctx, `globex`)
+	assert.Nil(err)
+
+	assert.Equal(1, tac.EvictIdle(before))
+	assert.Equal([]string{`globex`}, tac.Tenants())
+	assert.Equal(1, tac.EvictIdle(time.Now().Add(time.Second)))
+	assert.Empty(tac.Tenants())
+}
+
+func TestTenantAccessControl_Concurrent(t *testing.T) {
+	var loads int32
+	loader := tenantLoader(&loads)
+	tac := NewTenantAccessControl(func(ctx context.Context, tenant string) ([]StandardPolicy, []Role, error) {
+		time.Sleep(10 * time.Millisecond)
+		return loader(ctx, tenant)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ac, err := tac.Tenant(context.Background(), `acme`)
+			assert.Nil(t, err)
+			assert.NotNil(t, ac)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), loads)
+}
+
+func TestTenantAccessControl_Deadline(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	tac := NewTenantAccessControl(func(ctx context.Context, tenant string) ([]StandardPolicy, []Role, error) {
+		<-release
+		return nil, nil, nil
+	})
+	go tac.Tenant(context.Background(), `acme`)
+	for len(tac.Tenants()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// callers waiting for a slow load give up at their deadline
+	assert := assert.New(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := tac.Tenant(ctx, `acme`)
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+	err = tac.SetRole(ctx, `acme`, &StandardRole{Id: 10})
+	assert.True(errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestTenantAccessControl_Enforcer(t *testing.T) {
+	var loads int32
+	tac := NewTenantAccessControl(tenantLoader(&loads))
+	tac.Global.SetRole(&StandardRole{Id: 1, Name: `admin`})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		if roleID := c.GetHeader("X-Role"); roleID != "" {
+			c.Set("user_info", map[string]interface{}{
+				"role_id": []interface{}{float64(roleID[0] - '0')},
+			})
+		}
+	})
+	router.Use(tac.Enforcer(SubdomainTenant(`example.com`), UserInfoRoles("role_id")))
+	handler := func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("tenant"))
+	}
+	router.GET(`/data/:id`, handler)
+	router.DELETE(`/data/:id`, handler)
+
+	serve := func(method, host, roleID string) int {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, `/data/1`, nil)
+		r.Host = host
+		if roleID != "" {
+			r.Header.Set("X-Role", roleID)
+		}
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	assert := assert.New(t)
+	assert.Equal(http.StatusOK, serve("DELETE", `acme.example.com`, `1`))
+	assert.Equal(http.StatusOK, serve("GET", `acme.example.com`, `1`))
+	assert.Equal(http.StatusForbidden, serve("GET", `globex.example.com:8080`, `1`))
+	assert.Equal(http.StatusUnauthorized, serve("GET", `acme.example.com`, ``))
+	assert.Equal(http.StatusBadRequest, serve("GET", `example.com`, `1`))
+	assert.Equal(http.StatusBadRequest, serve("GET", `a.b.example.com`, `1`))
+	assert.Equal(http.StatusNotFound, serve("GET", `initech.example.com`, `1`))
+	assert.Equal(http.StatusServiceUnavailable, serve("GET", `broken.example.com`, `1`))
+}
+
+func TestTenantResolvers(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", `/`, nil)
+	c.Request.Header.Set("X-Tenant-ID", ` acme `)
+
+	assert := assert.New(t)
+	tenant, ok := HeaderTenant("X-Tenant-ID")(c)
+	assert.True(ok)
+	assert.Equal(`acme`, tenant)
+	_, ok = HeaderTenant("X-Org")(c)
+	assert.False(ok)
+
+	_, ok = ClaimTenant("tenant")(c)
+	assert.False(ok)
+	c.Set("user_info", map[string]interface{}{"tenant": `globex`, "org": float64(42)})
+	tenant, ok = ClaimTenant("tenant")(c)
+	assert.True(ok)
+	assert.Equal(`globex`, tenant)
+	tenant, ok = ClaimTenant("org")(c)
+	assert.True(ok)
+	assert.Equal(`42`, tenant)
+}